@@ -8,8 +8,9 @@ import ClientCounter from "./ClientCounter";
 import { useCode, type FileType } from "../context/globalCode";
 import { useAuth } from "../context/AuthContext";
 import { useNavigate } from "react-router";
-import { Play, Terminal, X } from "lucide-react";
+import { AlignLeft, Play, Terminal, X } from "lucide-react";
 import GeminiAssistant from "./GeminiAssistant";
+import { webSocketUrl } from "../services/backendApi";
 interface ClientInfo {
   user: string;
   userId: string;
@@ -29,15 +30,65 @@ interface WebSocketMessage {
   code?: string;
   language?: string;
   fileName?: string;
+  error?: string;
+  reason?: string;
+  files?: { name: string; language: string; content: string }[];
+  kind?: 'paste' | 'focus_lost' | 'tab_hidden';
+  chars?: number;
+  durationMs?: number;
+  diagnostics?: Diagnostic[];
+  position?: number;
 }
 
+// an error the server found in a run's output, lines and columns start at 1 and column 0 means the whole line
+interface Diagnostic {
+  file: string;
+  line: number;
+  column?: number;
+  severity: 'error' | 'warning' | 'info';
+  message: string;
+  source: string;
+}
+
+const MARKER_SEVERITY: Record<Diagnostic['severity'], monaco.MarkerSeverity> = {
+  error: monaco.MarkerSeverity.Error,
+  warning: monaco.MarkerSeverity.Warning,
+  info: monaco.MarkerSeverity.Info,
+};
+
+// underlines the word at the column, or the whole line when there is none
+const toMarker = (model: monaco.editor.ITextModel, d: Diagnostic): monaco.editor.IMarkerData => {
+  const line = Math.min(Math.max(d.line, 1), model.getLineCount());
+  const word = d.column ? model.getWordAtPosition({ lineNumber: line, column: d.column }) : null;
+  return {
+    severity: MARKER_SEVERITY[d.severity] ?? monaco.MarkerSeverity.Error,
+    message: d.message,
+    source: d.source,
+    startLineNumber: line,
+    endLineNumber: line,
+    startColumn: d.column || model.getLineFirstNonWhitespaceColumn(line) || 1,
+    endColumn: word?.endColumn ?? (d.column ? d.column + 1 : model.getLineMaxColumn(line)),
+  };
+};
+
+// sent by the server when the room is ended or deleted, reconnecting won't help
+const CLOSE_ROOM_CLOSED = 4000;
+
+type FormattedEdit = { code: string; fileName: string; formatted: true };
+
+const isFormattedEdit = (change: unknown): change is FormattedEdit =>
+  typeof change === 'object' && change !== null && (change as FormattedEdit).formatted === true;
+
+// pastes at least this long are reported to the interviewers
+const LARGE_PASTE_CHARS = 200;
+
 type CodeEditorProps = {
   roomId: string | undefined;
 }
 
 const CodeEditor: React.FC<CodeEditorProps> = ({ roomId: roomName }: CodeEditorProps) => {
   const navigate = useNavigate();
-  const { file, setFile, files, setFiles } = useCode();
+  const { file, setFile, files, setFiles, AddFile } = useCode();
   const { user } = useAuth();
   const editorRef = useRef<monaco.editor.IStandaloneCodeEditor | null>(null);
   const wsRef = useRef<WebSocket | null>(null);
@@ -65,101 +116,160 @@ const CodeEditor: React.FC<CodeEditorProps> = ({ roomId: roomName }: CodeEditorP
     setConnectionStatus('connecting');
     setIsReconnecting(false);
 
-    const ws = new WebSocket(`ws://localhost:8080/api/ws/${roomName}`);
-    wsRef.current = ws;
-
-    ws.onopen = () => {
-      console.log('✅ WebSocket connected to room:', roomName);
-      setConnectionStatus('connected');
+    let current: WebSocket | null = null;
+    let cancelled = false;
+
+    webSocketUrl(`/ws/${roomName}`).then((url) => {
+      if (cancelled) return;
+      const ws = new WebSocket(url);
+      current = ws;
+      wsRef.current = ws;
+
+      ws.onopen = () => {
+        console.log('✅ WebSocket connected to room:', roomName);
+        setConnectionStatus('connected');
+
+        // Join the room
+        const joinMessage: WebSocketMessage = {
+          action: "join",
+          room: roomName,
+          user: currentUser.username,
+          userId: currentUser.id?.toString() || currentUser.username
+        };
 
-      // Join the room
-      const joinMessage: WebSocketMessage = {
-        action: "join",
-        room: roomName,
-        user: currentUser.username,
-        userId: currentUser.id?.toString() || currentUser.username
+        console.log('Sending join message:', joinMessage);
+        ws.send(JSON.stringify(joinMessage));
+
+        // Request current room info
+        setTimeout(() => {
+          const roomInfoMessage: WebSocketMessage = {
+            action: "get_room_info",
+            room: roomName
+          };
+          console.log('Requesting room info');
+          ws.send(JSON.stringify(roomInfoMessage));
+        }, 100);
       };
 
-      console.log('Sending join message:', joinMessage);
-      ws.send(JSON.stringify(joinMessage));
-
-      // Request current room info
-      setTimeout(() => {
-        const roomInfoMessage: WebSocketMessage = {
-          action: "get_room_info",
-          room: roomName
-        };
-        console.log('Requesting room info');
-        ws.send(JSON.stringify(roomInfoMessage));
-      }, 100);
-    };
-
-    ws.onmessage = (event) => {
-      try {
-        const message: WebSocketMessage = JSON.parse(event.data);
-        console.log('📨 WebSocket message received:', message);
-
-        switch (message.action) {
-          case 'room_info':
-            if (message.clients) {
-              console.log('Room info received:', message.clients);
-              setClients(message.clients);
-              setClientCount(message.clientCount || message.clients.length);
-            }
-            break;
-
-          case 'room_update':
-            if (message.clients) {
-              console.log('Room update received:', message.clients);
-              setClients(message.clients);
-              setClientCount(message.clientCount || message.clients.length);
-            }
-            break;
-
-          case 'system':
-            console.log('📢 System message:', message.change);
-            break;
-
-          case 'edit':
-            console.log('✏️ Edit message received:', message.change);
-            // Handle code edits from other users
-            if (message.change && message.user !== currentUser.username) {
-              // Update the editor with changes from other users
-              // You can implement this based on your needs
-            }
-            break;
-
-          default:
-            console.log('❓ Unknown message action:', message.action);
+      ws.onmessage = (event) => {
+        try {
+          const message: WebSocketMessage = JSON.parse(event.data);
+          console.log('📨 WebSocket message received:', message);
+
+          switch (message.action) {
+            case 'room_info':
+              if (message.clients) {
+                console.log('Room info received:', message.clients);
+                setClients(message.clients);
+                setClientCount(message.clientCount || message.clients.length);
+              }
+              break;
+
+            case 'room_update':
+              if (message.clients) {
+                console.log('Room update received:', message.clients);
+                setClients(message.clients);
+                setClientCount(message.clientCount || message.clients.length);
+              }
+              break;
+
+            case 'system':
+              console.log('📢 System message:', message.change);
+              break;
+
+            case 'document_state':
+              // current content of the shared document (starter files for a fresh room)
+              message.files?.forEach((remote) => {
+                const existing = files.find((f) => f.name === remote.name);
+                if (existing) {
+                  existing.model.setValue(remote.content);
+                } else {
+                  AddFile({ name: remote.name, language: remote.language, value: remote.content });
+                }
+              });
+              break;
+
+            case 'run_queued':
+              // runs on the server wait in line with the other rooms' runs
+              console.log(`⏳ Run by ${message.user} is number ${message.position} in line`);
+              break;
+
+            case 'run_started':
+              console.log(`▶️ Run by ${message.user} started`);
+              break;
+
+            case 'room_closed':
+              console.log('🚪 Room closed:', message.reason);
+              break;
+
+            case 'error':
+              console.warn('⚠️ Server rejected action:', message.error);
+              break;
+
+            case 'diagnostics':
+              // sent after every run, an empty list clears what the previous run found
+              files.forEach((f) => {
+                const found = (message.diagnostics ?? []).filter((d) => d.file === f.name);
+                monaco.editor.setModelMarkers(f.model, 'run', found.map((d) => toMarker(f.model, d)));
+              });
+              break;
+
+            case 'edit':
+              console.log('✏️ Edit message received:', message.change);
+              // formatting is applied for everybody, the one who asked for it included
+              if (isFormattedEdit(message.change)) {
+                const target = files.find((f) => f.name === message.change.fileName);
+                if (target) {
+                  // one undoable edit rather than a reset, so ctrl+z gets the old layout back
+                  target.model.pushEditOperations([], [{ range: target.model.getFullModelRange(), text: message.change.code }], () => null);
+                }
+                break;
+              }
+              // Handle code edits from other users
+              if (message.change && message.user !== currentUser.username) {
+                // Update the editor with changes from other users
+                // You can implement this based on your needs
+              }
+              break;
+
+            default:
+              console.log('❓ Unknown message action:', message.action);
+          }
+        } catch (error) {
+          console.error('❌ Error parsing WebSocket message:', error);
         }
-      } catch (error) {
-        console.error('❌ Error parsing WebSocket message:', error);
-      }
-    };
+      };
 
-    ws.onclose = (event) => {
-      console.log('🔌 WebSocket connection closed:', event.code, event.reason);
-      setConnectionStatus('disconnected');
-      setClients([]);
-      setClientCount(0);
-
-      // Auto-reconnect if not intentionally closed
-      if (event.code !== 1000 && roomName) {
-        setIsReconnecting(true);
-        reconnectTimeoutRef.current = setTimeout(() => {
-          console.log('🔄 Attempting to reconnect...');
-          connectWebSocket();
-        }, 3000);
-      }
-    };
+      ws.onclose = (event) => {
+        console.log('🔌 WebSocket connection closed:', event.code, event.reason);
+        setConnectionStatus('disconnected');
+        setClients([]);
+        setClientCount(0);
+
+        // Auto-reconnect if not intentionally closed
+        if (event.code !== 1000 && event.code !== CLOSE_ROOM_CLOSED && roomName) {
+          setIsReconnecting(true);
+          reconnectTimeoutRef.current = setTimeout(() => {
+            console.log('🔄 Attempting to reconnect...');
+            connectWebSocket();
+          }, 3000);
+        }
+      };
 
-    ws.onerror = (error) => {
-      console.error('❌ WebSocket error:', error);
+      ws.onerror = (error) => {
+        console.error('❌ WebSocket error:', error);
+        setConnectionStatus('error');
+      };
+    }).catch((error) => {
+      console.error('❌ Could not get a WebSocket ticket:', error);
       setConnectionStatus('error');
-    };
+    });
 
     // Cleanup function
     return () => {
+      cancelled = true;
+      const ws = current;
+      if (!ws) return;
       if (ws.readyState === WebSocket.OPEN) {
         const leaveMessage: WebSocketMessage = {
           action: "leave",
@@ -202,9 +312,57 @@ const CodeEditor: React.FC<CodeEditorProps> = ({ roomId: roomName }: CodeEditorP
 
   }, []);
 
+  // the paste listener outlives renders, so it reads the open file from here
+  const fileNameRef = useRef<string | undefined>(undefined);
+  useEffect(() => {
+    fileNameRef.current = file?.name;
+  }, [file]);
+
+  // proctoring: tell the server when the page loses focus or gets hidden, and how long for
+  useEffect(() => {
+    let blurredAt: number | null = null;
+    let hiddenAt: number | null = null;
+
+    const handleBlur = () => {
+      blurredAt = Date.now();
+    };
+    const handleFocus = () => {
+      if (blurredAt === null) return;
+      sendWebSocketMessage({ action: 'integrity_event', kind: 'focus_lost', durationMs: Date.now() - blurredAt });
+      blurredAt = null;
+    };
+    const handleVisibility = () => {
+      if (document.visibilityState === 'hidden') {
+        hiddenAt = Date.now();
+      } else if (hiddenAt !== null) {
+        sendWebSocketMessage({ action: 'integrity_event', kind: 'tab_hidden', durationMs: Date.now() - hiddenAt });
+        hiddenAt = null;
+      }
+    };
+
+    window.addEventListener('blur', handleBlur);
+    window.addEventListener('focus', handleFocus);
+    document.addEventListener('visibilitychange', handleVisibility);
+    return () => {
+      window.removeEventListener('blur', handleBlur);
+      window.removeEventListener('focus', handleFocus);
+      document.removeEventListener('visibilitychange', handleVisibility);
+    };
+  }, [sendWebSocketMessage]);
+
   const handleEditorDidMount: OnMount = (editor) => {
     editorRef.current = editor;
     editor.focus();
+    editor.onDidPaste((e) => {
+      const pasted = editor.getModel()?.getValueInRange(e.range) ?? '';
+      if (pasted.length < LARGE_PASTE_CHARS) return;
+      sendWebSocketMessage({
+        action: 'integrity_event',
+        kind: 'paste',
+        chars: pasted.length,
+        fileName: fileNameRef.current,
+      });
+    });
     console.log('📝 Editor mounted');
   };
 
@@ -230,6 +388,7 @@ const CodeEditor: React.FC<CodeEditorProps> = ({ roomId: roomName }: CodeEditorP
       change: {
         code: newValue,
         language: file.language,
+        fileName: file.name,
         timestamp: new Date().toISOString()
       }
     });
@@ -293,6 +452,10 @@ const CodeEditor: React.FC<CodeEditorProps> = ({ roomId: roomName }: CodeEditorP
     }
   };
 
+  const formatCode = () => {
+    sendWebSocketMessage({ action: 'format_code', room: roomName, fileName: file.name });
+  };
+
   return (
     <div className="h-screen w-full flex flex-col bg-gray-900">
       {/* Top Bar */}
@@ -329,6 +492,14 @@ const CodeEditor: React.FC<CodeEditorProps> = ({ roomId: roomName }: CodeEditorP
             Run
           </button>
 
+          <button
+            onClick={formatCode}
+            className="flex items-center gap-2 px-4 py-2 bg-gray-700 hover:bg-gray-600 text-gray-300 rounded-md transition-colors"
+          >
+            <AlignLeft className="w-4 h-4" />
+            Format
+          </button>
+
           <button
             onClick={toggleTerminal}
             className={`flex items-center gap-2 px-4 py-2 rounded-md transition-colors ${isTerminalOpen
@@ -407,6 +578,8 @@ const CodeEditor: React.FC<CodeEditorProps> = ({ roomId: roomName }: CodeEditorP
           {/* AI Assistant */}
           <div className="p-4 border-b border-gray-700">
             <GeminiAssistant
+              roomId={roomName}
+              fileName={file?.name}
               isMinimized={isGeminiMinimized}
               onToggleMinimize={() => setIsGeminiMinimized(!isGeminiMinimized)}
             />
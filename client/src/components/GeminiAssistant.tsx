@@ -1,12 +1,56 @@
 import React, { useState } from 'react';
 import { Bot, Send, X, Minimize2, Maximize2 } from 'lucide-react';
+import { API_URL } from '../services/backendApi';
 
 interface GeminiAssistantProps {
+  roomId?: string;
+  fileName?: string;
   isMinimized?: boolean;
   onToggleMinimize?: () => void;
 }
 
+// the server holds the api key and adds the room's code to the question, answers stream back as server sent events
+const streamAnswer = async (
+  roomId: string,
+  body: { question: string; history: { role: string; content: string }[]; fileName?: string },
+  onText: (text: string) => void
+) => {
+  const response = await fetch(`${API_URL}/rooms/${roomId}/assistant`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      Authorization: `Bearer ${localStorage.getItem('token') || ''}`,
+    },
+    body: JSON.stringify(body),
+  });
+  if (!response.ok || !response.body) {
+    const data = await response.json().catch(() => ({}));
+    throw new Error(data.error || 'The assistant is not available right now.');
+  }
+
+  const reader = response.body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = '';
+  for (;;) {
+    const { done, value } = await reader.read();
+    if (done) break;
+    buffer += decoder.decode(value, { stream: true });
+    const events = buffer.split('\n\n');
+    buffer = events.pop() || '';
+    for (const event of events) {
+      const name = event.match(/^event:(.*)$/m)?.[1].trim();
+      const data = event.match(/^data:(.*)$/m)?.[1];
+      if (!data) continue;
+      const payload = JSON.parse(data);
+      if (name === 'chunk') onText(payload.text);
+      if (name === 'error') throw new Error(payload.error);
+    }
+  }
+};
+
 const GeminiAssistant: React.FC<GeminiAssistantProps> = ({
+  roomId,
+  fileName,
   isMinimized = false,
   onToggleMinimize
 }) => {
@@ -36,17 +80,20 @@ const GeminiAssistant: React.FC<GeminiAssistantProps> = ({
     setInputMessage('');
     setIsTyping(true);
 
-    // Simulate AI response (replace with actual Gemini API call)
-    setTimeout(() => {
-      const assistantMessage = {
-        id: messages.length + 2,
-        type: 'assistant',
-        content: 'I understand you\'re asking about: "' + inputMessage + '". This is a placeholder response. In the actual implementation, this would connect to the Gemini API to provide intelligent coding assistance.',
-        timestamp: new Date()
-      };
-      setMessages(prev => [...prev, assistantMessage]);
+    const answerId = messages.length + 2;
+    const history = messages.map(m => ({ role: m.type, content: m.content }));
+    setMessages(prev => [...prev, { id: answerId, type: 'assistant', content: '', timestamp: new Date() }]);
+    const appendToAnswer = (text: string) =>
+      setMessages(prev => prev.map(m => (m.id === answerId ? { ...m, content: m.content + text } : m)));
+
+    try {
+      if (!roomId) throw new Error('Join a room to use the assistant.');
+      await streamAnswer(roomId, { question: userMessage.content, history, fileName }, appendToAnswer);
+    } catch (err) {
+      appendToAnswer(err instanceof Error ? err.message : 'The assistant failed to answer.');
+    } finally {
       setIsTyping(false);
-    }, 1500);
+    }
   };
 
   if (isMinimized) {
@@ -1,6 +1,7 @@
-import React, { useState } from "react";
+import React, { useEffect, useState } from "react";
 import { LANGUAGE_OPTIONS } from "../utils/constants";
 import { useCode } from "../context/globalCode";
+import { getRuntimes, type Runtime } from "../services/languages";
 
 const languages = Object.keys(LANGUAGE_OPTIONS);
 
@@ -28,6 +29,11 @@ const FILE_MAP: Record<string, string> = {
 
 function LanguageSelector({ language, onSelect, setLanguage }: Props) {
   const [fileName, setFileName] = useState<string>("");
+  const [runtimes, setRuntimes] = useState<Runtime[]>([]);
+
+  useEffect(() => {
+    getRuntimes().then(setRuntimes);
+  }, []);
 
   const codeCtx = useCode();
   if (!codeCtx) return null;
@@ -48,14 +54,17 @@ function LanguageSelector({ language, onSelect, setLanguage }: Props) {
     const name = fileName.trim();
     if (!name) return;
 
+    // the server's registry decides which languages exist, the built in map covers an unreachable server
+    const runtime = runtimes.find((r) => r.extension && name.endsWith(r.extension));
     const ext = Object.keys(FILE_MAP).find((ext) => name.endsWith(ext));
-    if (!ext) {
-      alert("Unsupported File extension! Use .js, .py, .java, .cpp, or .c");
+    if (!runtime && !ext) {
+      const extensions = runtimes.length ? runtimes.map((r) => r.extension) : Object.keys(FILE_MAP);
+      alert(`Unsupported File extension! Use ${extensions.join(", ")}`);
       return;
     }
 
-    const detectedLanguage = FILE_MAP[ext];
-    const content = templates[detectedLanguage] ?? templates.plaintext;
+    const detectedLanguage = runtime?.name ?? FILE_MAP[ext!];
+    const content = runtime?.template ?? templates[detectedLanguage] ?? templates.plaintext;
 
     AddFile({
       name,
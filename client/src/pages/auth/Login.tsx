@@ -6,6 +6,7 @@ import { TextGenerateEffect } from "@/components/ui/text-generate-effect";
 
 import { useNavigate } from "react-router";
 import axios from "axios";
+import { API_URL } from "@/services/backendApi";
 
 type formData = {
   email: string;
@@ -30,11 +31,12 @@ function Login() {
     setIsLoading(true);
     try {
       const response = await axios.post(
-        "http://localhost:8080/api/auth/login",
+        `${API_URL}/auth/login`,
         formData
       );
       if (response.status === 200) {
         localStorage.setItem("token", response.data.token);
+        localStorage.setItem("refreshToken", response.data.refreshToken);
         console.log("User registered: ", response.data.user);
         navigate("/dashboard");
       }
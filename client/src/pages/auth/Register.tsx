@@ -4,6 +4,7 @@ import { ShootingStars } from "@/components/ui/shooting-stars";
 import { FaEnvelope, FaLock } from "react-icons/fa"; // Icons for inputs
 import { TextGenerateEffect } from "@/components/ui/text-generate-effect";
 import axios from "axios";
+import { API_URL } from "@/services/backendApi";
 import { useNavigate } from "react-router";
 
 type FormData = {
@@ -35,7 +36,7 @@ function Register() {
     try {
       //not using fetchdata because while doing auth, the user doesnt have any token
       const response = await axios.post(
-        "http://localhost:8080/api/auth/register",
+        `${API_URL}/auth/register`,
         formData
       );
 
@@ -51,6 +52,7 @@ function Register() {
           password: "",
         });
         localStorage.setItem("token", response.data.token);
+        localStorage.setItem("refreshToken", response.data.refreshToken);
         navigate("/dashboard");
       }
     } catch (err: any) {
@@ -1,14 +1,16 @@
 import axios from "axios";
 import { LANGUAGE_OPTIONS } from "../utils/constants";
+import { getRuntimes } from "./languages";
 
 const API = axios.create({
   baseURL: "https://emkc.org/api/v2/piston",
 });
 
 export const executeCode = async (language: string, sourceCode: string) => {
+  const runtime = (await getRuntimes()).find((r) => r.name === language);
   const response = await API.post("/execute", {
     language: language,
-    version: LANGUAGE_OPTIONS[language],
+    version: runtime?.version ?? LANGUAGE_OPTIONS[language],
     files: [
       {
         content: sourceCode,
@@ -1,7 +1,10 @@
 import axios from "axios";
 
+// set VITE_API_URL when the api isn't served from localhost:8080
+export const API_URL: string = import.meta.env.VITE_API_URL || "http://localhost:8080/api";
+
 export const fetchData = axios.create({
-  baseURL: "http://localhost:8080/api",
+  baseURL: API_URL,
 });
 
 // Add request interceptor to include token dynamically
@@ -17,3 +20,52 @@ fetchData.interceptors.request.use(
     return Promise.reject(error);
   }
 );
+
+// one refresh at a time: parallel requests that all got a 401 wait for the same rotation, a second
+// refresh with the old token would look like a stolen token to the server
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = (refreshToken: string): Promise<string> => {
+  if (!refreshing) {
+    refreshing = axios
+      .post(`${API_URL}/auth/refresh`, { refreshToken })
+      .then((response) => {
+        localStorage.setItem("token", response.data.token);
+        localStorage.setItem("refreshToken", response.data.refreshToken);
+        return response.data.token as string;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// Access tokens are short lived, so on a 401 we try to rotate the refresh token once and retry
+fetchData.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config;
+    const refreshToken = localStorage.getItem("refreshToken");
+    if (error.response?.status !== 401 || !refreshToken || original._retry) {
+      return Promise.reject(error);
+    }
+    original._retry = true;
+    try {
+      const token = await refreshAccessToken(refreshToken);
+      original.headers.Authorization = `Bearer ${token}`;
+      return fetchData(original);
+    } catch (refreshError) {
+      localStorage.removeItem("token");
+      localStorage.removeItem("refreshToken");
+      return Promise.reject(refreshError);
+    }
+  }
+);
+
+// browsers can't send headers when opening a websocket, so we trade the token for a single use ticket
+// that only lives for a few seconds instead of putting the token itself in the url
+export const webSocketUrl = async (path: string): Promise<string> => {
+  const { data } = await fetchData.post("/ws-ticket");
+  return `${API_URL.replace(/^http/, "ws")}${path}?ticket=${encodeURIComponent(data.ticket)}`;
+};
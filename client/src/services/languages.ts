@@ -0,0 +1,28 @@
+import { fetchData } from "./backendApi";
+
+export type Runtime = {
+  name: string;
+  displayName: string;
+  version: string;
+  extension: string;
+  fileName: string;
+  aliases?: string[];
+  template?: string;
+};
+
+let runtimes: Promise<Runtime[]> | null = null;
+
+// the server's language registry, fetched once. empty when the server can't be reached,
+// callers fall back on LANGUAGE_OPTIONS then
+export const getRuntimes = (): Promise<Runtime[]> => {
+  if (!runtimes) {
+    runtimes = fetchData
+      .get("/languages")
+      .then((response) => response.data.languages as Runtime[])
+      .catch(() => {
+        runtimes = null; // try again next time
+        return [];
+      });
+  }
+  return runtimes;
+};
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"geekCode/internal/auth"
 	"geekCode/internal/config"
+	"geekCode/internal/middleware"
 	"geekCode/internal/routes"
+	"geekCode/internal/services"
 	"log"
 	"os"
 	"time"
@@ -18,7 +21,9 @@ func main () {
 	}
 	
 	cfg := config.LoadConfig()
-	r := gin.Default()
+	//gin.Default without its logger, ours keeps the ws tickets out of the access log
+	r := gin.New()
+	r.Use(middleware.AccessLog(), gin.Recovery())
 
 	//handling cors
 	// Build allowed origins list
@@ -64,11 +69,29 @@ func main () {
 		log.Fatal("Failed to connect to database ", err)
 	}
 
-	if cfg.JWTSecret == "" {
+	if cfg.JWTSecret == "" && cfg.JWTSigningAlg == auth.AlgHS256 {
 		log.Fatal("Jwtsecret is needed but hasn't been set up yet")
 	}
 
-	routes.RegisterRoutes(r, db, cfg.JWTSecret)
+	keys, err := auth.Init(auth.KeyConfig{
+		Algorithm:         cfg.JWTSigningAlg,
+		Secret:            cfg.JWTSecret,
+		Dir:               cfg.JWTKeysDir,
+		Retention:         cfg.AccessTokenTTL + time.Hour, // rotated keys outlive every token they signed
+		Issuer:            cfg.JWTIssuer,
+		LegacySecretUntil: cfg.JWTLegacySecretUntil,
+	})
+	if err != nil {
+		log.Fatal("Failed to set up jwt signing keys ", err)
+	}
+	keys.StartRotation(cfg.JWTKeyRotation)
+
+	rooms := routes.RegisterRoutes(r, db)
+
+	//deleted rooms are kept for a while before they are removed for good
+	services.NewRoomPurger(db, cfg.RoomDeleteRetention).Start(time.Hour)
+	//opens scheduled rooms and ends them once their time is over
+	services.NewRoomScheduler(db, services.NewJoinWindow(cfg), rooms).Start(30 * time.Second)
 	
 	port := cfg.Port
 	if port == "" {
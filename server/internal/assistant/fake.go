@@ -0,0 +1,54 @@
+package assistant
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeProvider answers without a model, for local development and tests.
+// it streams Reply word by word, or echoes the question when Reply is empty
+type FakeProvider struct {
+	Reply string
+	Err   error // returned after the reply was streamed
+
+	mu      sync.Mutex
+	prompts []Prompt
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) Stream(ctx context.Context, prompt Prompt, onChunk func(text string) error) (Usage, error) {
+	f.mu.Lock()
+	f.prompts = append(f.prompts, prompt)
+	f.mu.Unlock()
+
+	reply := f.Reply
+	if reply == "" {
+		question := ""
+		if len(prompt.Messages) > 0 {
+			question = prompt.Messages[len(prompt.Messages)-1].Content
+		}
+		reply = "This is a canned answer from the fake assistant provider. You asked: " + question
+	}
+	usage := Usage{PromptTokens: estimatePrompt(prompt)}
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if err := ctx.Err(); err != nil {
+			return usage, err
+		}
+		if err := onChunk(word); err != nil {
+			return usage, err
+		}
+		usage.CompletionTokens += estimateTokens(word)
+	}
+	return usage, f.Err
+}
+
+// Prompts returns every prompt the fake was asked so far
+func (f *FakeProvider) Prompts() []Prompt {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Prompt(nil), f.prompts...)
+}
@@ -0,0 +1,144 @@
+package assistant
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// GeminiProvider talks to the Gemini REST api and streams with server sent events
+type GeminiProvider struct {
+	APIKey    string
+	Model     string
+	MaxTokens int
+	BaseURL   string // defaults to the public endpoint
+	Client    *http.Client
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	GenerationConfig  struct {
+		MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (g *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+func (g *GeminiProvider) Stream(ctx context.Context, prompt Prompt, onChunk func(text string) error) (Usage, error) {
+	var body geminiRequest
+	if prompt.System != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: prompt.System}}}
+	}
+	for _, msg := range prompt.Messages {
+		// gemini calls the assistant side "model"
+		role := "user"
+		if msg.Role == RoleAssistant {
+			role = "model"
+		}
+		body.Contents = append(body.Contents, geminiContent{Role: role, Parts: []geminiPart{{Text: msg.Content}}})
+	}
+	body.GenerationConfig.MaxOutputTokens = g.MaxTokens
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	base := g.BaseURL
+	if base == "" {
+		base = geminiBaseURL
+	}
+	endpoint := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", strings.TrimSuffix(base, "/"), url.PathEscape(g.Model))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return Usage{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// the key goes in a header so it doesn't end up in logged urls
+	req.Header.Set("x-goog-api-key", g.APIKey)
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Usage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return Usage{}, fmt.Errorf("gemini returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	// gemini reports the running totals with the chunks, estimate until it does
+	usage := Usage{PromptTokens: estimatePrompt(prompt)}
+	reported := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var event geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			return usage, fmt.Errorf("gemini sent an unreadable event: %w", err)
+		}
+		if event.Error != nil {
+			return usage, fmt.Errorf("gemini error %d: %s", event.Error.Code, event.Error.Message)
+		}
+		if event.UsageMetadata != nil {
+			usage = Usage{PromptTokens: event.UsageMetadata.PromptTokenCount, CompletionTokens: event.UsageMetadata.CandidatesTokenCount}
+			reported = true
+		}
+		for _, candidate := range event.Candidates {
+			for _, part := range candidate.Content.Parts {
+				if part.Text == "" {
+					continue
+				}
+				if !reported {
+					usage.CompletionTokens += estimateTokens(part.Text)
+				}
+				if err := onChunk(part.Text); err != nil {
+					return usage, err
+				}
+			}
+		}
+	}
+	return usage, scanner.Err()
+}
@@ -0,0 +1,182 @@
+package assistant
+
+import (
+	"fmt"
+	"geekCode/internal/config"
+	"geekCode/internal/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Limits caps assistant use over a rolling window, zero means unlimited
+type Limits struct {
+	Window       time.Duration
+	UserRequests int
+	UserTokens   int
+	OrgRequests  int
+	OrgTokens    int
+}
+
+func LimitsFromConfig(cfg *config.Config) Limits {
+	return Limits{
+		Window:       cfg.AssistantQuotaWindow,
+		UserRequests: cfg.AssistantUserRequests,
+		UserTokens:   cfg.AssistantUserTokens,
+		OrgRequests:  cfg.AssistantOrgRequests,
+		OrgTokens:    cfg.AssistantOrgTokens,
+	}
+}
+
+type Totals struct {
+	Requests int64 `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+type UserTotals struct {
+	UserID uint `json:"userId"`
+	Totals
+}
+
+// QuotaError is returned when the user or their org used up the assistant
+type QuotaError struct {
+	Scope   string // "user" or "org"
+	Kind    string // "requests" or "tokens"
+	Limit   int
+	ResetAt time.Time // when the oldest counted request leaves the window
+}
+
+func (e *QuotaError) Error() string {
+	owner := "your account"
+	if e.Scope == "org" {
+		owner = "your organization"
+	}
+	return fmt.Sprintf("the assistant %s limit of %d for %s is used up", e.Kind[:len(e.Kind)-1], e.Limit, owner)
+}
+
+// Meter records every question and enforces the quotas
+type Meter struct {
+	db     *gorm.DB
+	limits Limits
+	mu     sync.Mutex // stands in for the advisory locks on databases without them
+}
+
+// advisory lock keys (the first of the two ints) for the quota checks, the second is the user or org id
+const (
+	userQuotaLock int32 = 0x61710001
+	orgQuotaLock  int32 = 0x61710002
+)
+
+func NewMeter(db *gorm.DB, limits Limits) *Meter {
+	return &Meter{db: db, limits: limits}
+}
+
+func (m *Meter) Limits() Limits {
+	return m.limits
+}
+
+// Begin checks the quotas and records the request right away, so parallel questions count too.
+// the check and the insert share a transaction holding a lock on the user and the org, otherwise
+// questions asked at the same time would all see the same count and all get through
+func (m *Meter) Begin(userID uint, orgID *uint, roomID, provider string) (*models.AssistantUsage, error) {
+	record := &models.AssistantUsage{UserID: userID, OrgID: orgID, RoomID: roomID, Provider: provider}
+	postgres := m.db.Dialector.Name() == "postgres"
+	if !postgres {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		// always the user first, then the org, so two transactions can't wait on each other
+		if postgres {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", userQuotaLock, int32(userID)).Error; err != nil {
+				return err
+			}
+			if orgID != nil {
+				if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", orgQuotaLock, int32(*orgID)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if err := m.check(tx, "user_id", userID, "user", m.limits.UserRequests, m.limits.UserTokens); err != nil {
+			return err
+		}
+		if orgID != nil {
+			if err := m.check(tx, "org_id", *orgID, "org", m.limits.OrgRequests, m.limits.OrgTokens); err != nil {
+				return err
+			}
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Finish stores the tokens the answer used
+func (m *Meter) Finish(record *models.AssistantUsage, usage Usage, failed bool) error {
+	return m.db.Model(record).Updates(map[string]interface{}{
+		"prompt_tokens":     usage.PromptTokens,
+		"completion_tokens": usage.CompletionTokens,
+		"failed":            failed,
+	}).Error
+}
+
+func (m *Meter) UserTotals(userID uint) (Totals, error) {
+	return m.totals(m.db, "user_id", userID)
+}
+
+func (m *Meter) OrgTotals(orgID uint) (Totals, error) {
+	return m.totals(m.db, "org_id", orgID)
+}
+
+// OrgUsers breaks the org's usage in the window down per user, heaviest first
+func (m *Meter) OrgUsers(orgID uint) ([]UserTotals, error) {
+	var users []UserTotals
+	err := m.db.Model(&models.AssistantUsage{}).
+		Select("user_id, COUNT(*) AS requests, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS tokens").
+		Where("org_id = ? AND created_at > ?", orgID, m.since()).
+		Group("user_id").Order("tokens DESC").
+		Scan(&users).Error
+	return users, err
+}
+
+func (m *Meter) check(db *gorm.DB, column string, id uint, scope string, maxRequests, maxTokens int) error {
+	if maxRequests <= 0 && maxTokens <= 0 {
+		return nil
+	}
+	totals, err := m.totals(db, column, id)
+	if err != nil {
+		return err
+	}
+	kind, limit := "", 0
+	switch {
+	case maxRequests > 0 && totals.Requests >= int64(maxRequests):
+		kind, limit = "requests", maxRequests
+	case maxTokens > 0 && totals.Tokens >= int64(maxTokens):
+		kind, limit = "tokens", maxTokens
+	default:
+		return nil
+	}
+
+	var oldest models.AssistantUsage
+	resetAt := time.Now().Add(m.limits.Window)
+	if err := db.Where(column+" = ? AND created_at > ?", id, m.since()).Order("created_at").First(&oldest).Error; err == nil {
+		resetAt = oldest.CreatedAt.Add(m.limits.Window)
+	}
+	return &QuotaError{Scope: scope, Kind: kind, Limit: limit, ResetAt: resetAt}
+}
+
+func (m *Meter) totals(db *gorm.DB, column string, id uint) (Totals, error) {
+	var totals Totals
+	err := db.Model(&models.AssistantUsage{}).
+		Select("COUNT(*) AS requests, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS tokens").
+		Where(column+" = ? AND created_at > ?", id, m.since()).
+		Scan(&totals).Error
+	return totals, err
+}
+
+func (m *Meter) since() time.Time {
+	return time.Now().Add(-m.limits.Window)
+}
@@ -0,0 +1,81 @@
+package assistant
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"geekCode/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testMeter(t *testing.T, limits Limits) *Meter {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: is a database of its own
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.AssistantUsage{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewMeter(db, limits)
+}
+
+func TestMeterParallelRequests(t *testing.T) {
+	m := testMeter(t, Limits{Window: time.Hour, UserRequests: 3})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed, refused := 0, 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Begin(1, nil, "room-1", "fake")
+			mu.Lock()
+			defer mu.Unlock()
+			var quota *QuotaError
+			switch {
+			case err == nil:
+				allowed++
+			case errors.As(err, &quota):
+				refused++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 3 || refused != 17 {
+		t.Fatalf("%d allowed and %d refused, want 3 and 17", allowed, refused)
+	}
+}
+
+func TestMeterOrgQuota(t *testing.T) {
+	m := testMeter(t, Limits{Window: time.Hour, OrgTokens: 100})
+	orgID := uint(5)
+
+	first, err := m.Begin(1, &orgID, "room-1", "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Finish(first, Usage{PromptTokens: 80, CompletionTokens: 20}, false); err != nil {
+		t.Fatal(err)
+	}
+	// a colleague in the same org is out of tokens too, someone outside it isn't
+	_, err = m.Begin(2, &orgID, "room-2", "fake")
+	var quota *QuotaError
+	if !errors.As(err, &quota) || quota.Scope != "org" || quota.Kind != "tokens" {
+		t.Fatalf("got %v, want the org token quota", err)
+	}
+	if _, err := m.Begin(3, nil, "room-3", "fake"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,86 @@
+package assistant
+
+import (
+	"context"
+	"geekCode/internal/config"
+	"log"
+	"net/http"
+)
+
+// roles of the messages in a conversation
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Prompt is what gets sent to the model: instructions plus the conversation so far, ending with the question
+type Prompt struct {
+	System   string
+	Messages []Message
+}
+
+// Usage is the token count of one answer
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// LLMProvider is a chat model that streams its answer
+type LLMProvider interface {
+	Name() string
+	// Stream calls onChunk with every piece of the answer as it arrives, an error from onChunk stops the stream.
+	// the usage is returned even when the stream fails halfway
+	Stream(ctx context.Context, prompt Prompt, onChunk func(text string) error) (Usage, error)
+}
+
+// rough token count for providers that don't report usage, about four characters per token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func estimatePrompt(prompt Prompt) int {
+	tokens := estimateTokens(prompt.System)
+	for _, msg := range prompt.Messages {
+		tokens += estimateTokens(msg.Content)
+	}
+	return tokens
+}
+
+// picks the provider from ASSISTANT_PROVIDER (gemini when only a key is set), nil turns the assistant off
+func New(cfg *config.Config) LLMProvider {
+	name := cfg.AssistantProvider
+	if name == "" && cfg.GeminiAPIKey != "" {
+		name = "gemini"
+	}
+
+	switch name {
+	case "":
+		log.Printf("No assistant provider configured, the assistant is disabled")
+		return nil
+	case "gemini":
+		if cfg.GeminiAPIKey == "" {
+			log.Printf("GEMINI_API_KEY not set, the assistant is disabled")
+			return nil
+		}
+		return &GeminiProvider{
+			APIKey:    cfg.GeminiAPIKey,
+			Model:     cfg.GeminiModel,
+			MaxTokens: cfg.AssistantMaxTokens,
+			Client:    &http.Client{Timeout: cfg.AssistantTimeout},
+		}
+	case "fake":
+		log.Printf("Using the fake assistant provider, answers are canned")
+		return &FakeProvider{}
+	}
+	log.Printf("Unknown assistant provider %q, the assistant is disabled", name)
+	return nil
+}
@@ -0,0 +1,106 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"log"
+	"strings"
+)
+
+var (
+	ErrDisabled   = errors.New("the assistant is not configured")
+	ErrRoomPolicy = errors.New("the assistant is turned off in this room")
+	ErrRole       = errors.New("the assistant is not available to your role in this room")
+)
+
+// Service is the assistant as the handlers and the hub use it: the provider behind the room policy and the quotas
+type Service struct {
+	provider LLMProvider
+	meter    *Meter
+}
+
+func NewService(provider LLMProvider, meter *Meter) *Service {
+	return &Service{provider: provider, meter: meter}
+}
+
+func (s *Service) Meter() *Meter {
+	return s.meter
+}
+
+// Request is one question asked in a room
+type Request struct {
+	UserID uint
+	Room   *models.Room // needs at least the room id, org and settings
+	Roles  []rbac.Role  // the asker's roles on the room
+	Prompt Prompt
+}
+
+// Allowed checks the room's assistant settings against the asker's roles
+func Allowed(settings models.AssistantSettings, roles []rbac.Role) error {
+	if !settings.Enabled {
+		return ErrRoomPolicy
+	}
+	for _, allowed := range settings.Roles {
+		for _, role := range roles {
+			if string(role) == allowed {
+				return nil
+			}
+		}
+	}
+	return ErrRole
+}
+
+// Ask streams the answer to onChunk. errors returned before the first chunk mean nothing was asked:
+// ErrDisabled, ErrRoomPolicy, ErrRole or a *QuotaError
+func (s *Service) Ask(ctx context.Context, req Request, onChunk func(text string) error) error {
+	if s == nil || s.provider == nil {
+		return ErrDisabled
+	}
+	if err := Allowed(req.Room.Settings.Assistant(), req.Roles); err != nil {
+		return err
+	}
+	record, err := s.meter.Begin(req.UserID, req.Room.OrgID, req.Room.RoomID, s.provider.Name())
+	if err != nil {
+		return err
+	}
+
+	usage, err := s.provider.Stream(ctx, req.Prompt, onChunk)
+	if finishErr := s.meter.Finish(record, usage, err != nil); finishErr != nil {
+		log.Printf("Failed to record assistant usage for user %d: %v", req.UserID, finishErr)
+	}
+	if err != nil {
+		log.Printf("Assistant (%s) failed for room %s: %v", s.provider.Name(), req.Room.RoomID, err)
+	}
+	return err
+}
+
+// Complete asks without a room policy check and returns the whole answer, for work the server does on its
+// own (like summaries). the usage still counts against the given user and the room's org
+func (s *Service) Complete(ctx context.Context, userID uint, room *models.Room, prompt Prompt) (string, error) {
+	if s == nil || s.provider == nil {
+		return "", ErrDisabled
+	}
+	record, err := s.meter.Begin(userID, room.OrgID, room.RoomID, s.provider.Name())
+	if err != nil {
+		return "", err
+	}
+
+	var answer strings.Builder
+	usage, err := s.provider.Stream(ctx, prompt, func(text string) error {
+		answer.WriteString(text)
+		return nil
+	})
+	if finishErr := s.meter.Finish(record, usage, err != nil); finishErr != nil {
+		log.Printf("Failed to record assistant usage for user %d: %v", userID, finishErr)
+	}
+	return answer.String(), err
+}
+
+func (s *Service) Provider() string {
+	if s == nil || s.provider == nil {
+		return ""
+	}
+	return s.provider.Name()
+}
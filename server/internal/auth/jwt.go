@@ -5,50 +5,128 @@ import (
     "time"
     "strconv"
     "fmt"
+    "log"
     "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
 )
 
-var jwtKey []byte
+var keys *KeySet
 
-//initialize jwt secret key
+//access tokens are only good for the api, anything verifying them (including other services using
+//the jwks) has to require this audience and the at+jwt type, so no other token we sign passes for one
+const (
+    AccessAudience = "geekcode-api"
+    AccessTokenType = "at+jwt"
+)
+
+//audience and type of the short lived token handed out between the password and the otp step
+const (
+    mfaAudience = "mfa"
+    mfaTokenType = "mfa+jwt"
+)
+
+//initialize the signing keys (shared secret or rotating asymmetric keys)
 
-func Init(secret string){
-    jwtKey = []byte(secret)
+func Init(cfg KeyConfig) (*KeySet, error){
+    ks, err := NewKeySet(cfg)
+    if err != nil {
+        return nil, err
+    }
+    keys = ks
+    return ks, nil
+
+}
 
+//public keys for the jwks endpoint
+func JWKS() JWKSet {
+    return keys.JWKS()
 }
 
-//this func generates token for the user
-func GenerateToken(userId uint, secret string) (string,error){
+//this func generates a short lived access token for the user
+//the token id (jti) is returned as well so the token can be revoked later
+func GenerateToken(userId uint, ttl time.Duration) (string, string, error){
     claims := &jwt.RegisteredClaims{
+        ID: uuid.New().String(),
+        Issuer: keys.cfg.Issuer,
         Subject: strconv.FormatUint(uint64(userId), 10), //converting uint to string
-        ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 1day
+        Audience: jwt.ClaimStrings{AccessAudience},
+        ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
         IssuedAt : jwt.NewNumericDate(time.Now()),
     }
 
     fmt.Printf("Generating token for user ID: %d, Subject: %s\n", userId, claims.Subject) // Debug log
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims) 
-    return token.SignedString([]byte(secret))
+    signed, err := keys.Sign(claims, AccessTokenType)
+    if err != nil {
+        return "", "", err
+    }
+    return signed, claims.ID, nil
 
 }
 
-//this func checks if the user has a token
+//this func parses the token and returns its claims, used when we need the jti / expiry
+
+func ParseToken(tokenStr string) (*jwt.RegisteredClaims, error) {
+    //an mfa token only proves the password, it must never work as an access token
+    return parseClaims(tokenStr, AccessTokenType, jwt.WithAudience(AccessAudience))
+}
 
-func ValidateToken(tokenStr , secret string) (uint , error) {
+func parseClaims(tokenStr, typ string, extra ...jwt.ParserOption) (*jwt.RegisteredClaims, error) {
     claims := &jwt.RegisteredClaims{}
 
-    token, err := jwt.ParseWithClaims(tokenStr, claims , func(token *jwt.Token) (interface{}, error) {
-        return []byte(secret), nil
-    })
+    opts := []jwt.ParserOption{jwt.WithValidMethods(keys.Methods()), jwt.WithExpirationRequired()}
+    if keys.cfg.Issuer != "" {
+        opts = append(opts, jwt.WithIssuer(keys.cfg.Issuer))
+    }
+    token, err := jwt.ParseWithClaims(tokenStr, claims , keys.Keyfunc, append(opts, extra...)...)
 
     if err  != nil || !token.Valid{
-        fmt.Printf("Token parsing failed: %v\n", err) // Debug log
-        return 0, errors.New("Invalid token")
+        log.Printf("Token parsing failed: %v", err)
+        return nil, errors.New("Invalid token")
+    }
+    if token.Header["typ"] != typ {
+        return nil, errors.New("Invalid token")
+    }
+    return claims, nil
+}
+
+//issued after a correct password when the user has two factor auth, exchanged for real tokens with an otp
+func GenerateMFAToken(userId uint, ttl time.Duration) (string, error) {
+    claims := &jwt.RegisteredClaims{
+        ID: uuid.New().String(),
+        Issuer: keys.cfg.Issuer,
+        Subject: strconv.FormatUint(uint64(userId), 10),
+        Audience: jwt.ClaimStrings{mfaAudience},
+        ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+        IssuedAt: jwt.NewNumericDate(time.Now()),
+    }
+    return keys.Sign(claims, mfaTokenType)
+}
+
+func ValidateMFAToken(tokenStr string) (uint, error) {
+    claims, err := parseClaims(tokenStr, mfaTokenType, jwt.WithAudience(mfaAudience))
+    if err != nil {
+        return 0, err
+    }
+    return UserIDFromClaims(claims)
+}
+
+//this func checks if the user has a token
+
+func ValidateToken(tokenStr string) (uint , error) {
+    claims, err := ParseToken(tokenStr)
+    if err != nil {
+        return 0, err
     }
 
     //process of returning the user id
     fmt.Printf("Token Subject from claims: '%s'\n", claims.Subject) // Debug log
     
+    return UserIDFromClaims(claims)
+}
+
+//subject holds the user id as a string
+func UserIDFromClaims(claims *jwt.RegisteredClaims) (uint, error) {
     userID , err  := strconv.ParseUint(claims.Subject,10,64)
     if err != nil {
         fmt.Printf("Failed to parse user ID from subject '%s': %v\n", claims.Subject, err) // Debug log
@@ -57,4 +135,4 @@ func ValidateToken(tokenStr , secret string) (uint , error) {
     
     fmt.Printf("Successfully parsed user ID: %d\n", userID) // Debug log
     return uint(userID) , nil 
-}
\ No newline at end of file
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenKinds(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			if _, err := Init(KeyConfig{Algorithm: alg, Secret: "test-secret", Issuer: "geekcode-test"}); err != nil {
+				t.Fatal(err)
+			}
+			access, _, err := GenerateToken(7, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mfa, err := GenerateMFAToken(7, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if id, err := ValidateToken(access); err != nil || id != 7 {
+				t.Errorf("ValidateToken(access) = %d, %v", id, err)
+			}
+			if id, err := ValidateMFAToken(mfa); err != nil || id != 7 {
+				t.Errorf("ValidateMFAToken(mfa) = %d, %v", id, err)
+			}
+			if _, err := ValidateToken(mfa); err == nil {
+				t.Error("an mfa token passed as an access token")
+			}
+			if _, err := ValidateMFAToken(access); err == nil {
+				t.Error("an access token passed as an mfa token")
+			}
+
+			// what another service does with the jwks: it only has the public keys and the documented checks
+			verify := func(token string) error {
+				_, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+					if token.Header["typ"] != AccessTokenType {
+						return nil, jwt.ErrTokenUnverifiable
+					}
+					return keys.Keyfunc(token)
+				}, jwt.WithAudience(AccessAudience), jwt.WithIssuer("geekcode-test"))
+				return err
+			}
+			if err := verify(access); err != nil {
+				t.Errorf("access token rejected by an outside verifier: %v", err)
+			}
+			if err := verify(mfa); err == nil {
+				t.Error("mfa token accepted by an outside verifier")
+			}
+		})
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	if _, err := Init(KeyConfig{Algorithm: AlgHS256, Secret: "test-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	expired, _, _ := GenerateToken(7, -time.Minute)
+	if _, err := ValidateToken(expired); err == nil {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestLegacySecretCutoff(t *testing.T) {
+	legacy := func() string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Subject:   "7",
+			Audience:  jwt.ClaimStrings{AccessAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		})
+		token.Header["typ"] = AccessTokenType
+		signed, err := token.SignedString([]byte("test-secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	cases := []struct {
+		name   string
+		until  time.Time
+		retain time.Duration
+		ok     bool
+	}{
+		{"before the cutoff", time.Now().Add(time.Hour), 0, true},
+		{"after the cutoff", time.Now().Add(-time.Second), time.Hour, false},
+		{"no cutoff within the retention", time.Time{}, time.Hour, true},
+		{"no cutoff and no retention", time.Time{}, 0, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Init(KeyConfig{Algorithm: AlgEdDSA, Secret: "test-secret", Retention: tc.retain, LegacySecretUntil: tc.until}); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ValidateToken(legacy())
+			if ok := err == nil; ok != tc.ok {
+				t.Errorf("legacy token accepted = %v, want %v (%v)", ok, tc.ok, err)
+			}
+		})
+	}
+
+	// a running server stops accepting them once the cutoff passes
+	ks, err := NewKeySet(KeyConfig{Algorithm: AlgRS256, Secret: "test-secret", LegacySecretUntil: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.legacyExpired(time.Now()) || !ks.legacyExpired(time.Now().Add(2*time.Hour)) {
+		t.Error("cutoff not applied")
+	}
+}
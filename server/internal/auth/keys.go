@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// legacy tokens signed with the shared secret have no kid header
+const legacyKeyID = ""
+
+// kids start with their creation time so they sort by age
+const kidTimeLayout = "20060102T150405.000Z"
+
+type KeyConfig struct {
+	Algorithm string        // HS256, RS256 or EdDSA
+	Secret    string        // shared secret, used for HS256 and to keep verifying old HS256 tokens
+	Dir       string        // where asymmetric keys are persisted as <kid>.pem, empty keeps them in memory
+	Retention time.Duration // how long a rotated out key keeps verifying tokens
+	Issuer    string
+	// with RS256 or EdDSA, old HS256 tokens are only verified until this time, zero keeps them
+	// verifying for one Retention after startup (enough for the tokens issued before the switch)
+	LegacySecretUntil time.Time
+}
+
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   interface{} // []byte for HS256, crypto.Signer otherwise
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+	RetiredAt time.Time // zero while the key is the one being used to sign
+}
+
+// KeySet holds the current signing key plus the recently rotated ones, tokens are
+// verified against whichever key their kid points to
+type KeySet struct {
+	mu         sync.RWMutex
+	cfg        KeyConfig
+	current    *SigningKey
+	keys       map[string]*SigningKey
+	stopRotate chan struct{}
+}
+
+// the legacy HS256 key is the shared secret, so once the algorithm moved on it can't be
+// allowed to mint tokens forever
+func (ks *KeySet) legacyExpired(now time.Time) bool {
+	if ks.cfg.Algorithm == AlgHS256 {
+		return false
+	}
+	return !now.Before(ks.cfg.LegacySecretUntil)
+}
+
+func NewKeySet(cfg KeyConfig) (*KeySet, error) {
+	ks := &KeySet{cfg: cfg, keys: make(map[string]*SigningKey)}
+
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgHS256
+		ks.cfg.Algorithm = AlgHS256
+	}
+
+	if cfg.Secret != "" {
+		ks.keys[legacyKeyID] = &SigningKey{
+			ID:        legacyKeyID,
+			Method:    jwt.SigningMethodHS256,
+			Private:   []byte(cfg.Secret),
+			CreatedAt: time.Now(),
+		}
+	}
+
+	switch cfg.Algorithm {
+	case AlgHS256:
+		if cfg.Secret == "" {
+			return nil, errors.New("HS256 signing needs a JWT secret")
+		}
+		ks.current = ks.keys[legacyKeyID]
+		return ks, nil
+	case AlgRS256, AlgEdDSA:
+		if cfg.LegacySecretUntil.IsZero() {
+			ks.cfg.LegacySecretUntil = time.Now().Add(cfg.Retention)
+		}
+		if ks.legacyExpired(time.Now()) {
+			delete(ks.keys, legacyKeyID)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt signing algorithm %q", cfg.Algorithm)
+	}
+
+	if err := ks.loadKeys(); err != nil {
+		return nil, err
+	}
+	if ks.current == nil {
+		if err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// loads every persisted key, the newest one (kids sort by creation time) signs
+func (ks *KeySet) loadKeys() error {
+	if ks.cfg.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(ks.cfg.Dir, 0o700); err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(ks.cfg.Dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	var loaded []*SigningKey
+	for _, path := range paths {
+		key, err := readKeyFile(path)
+		if err != nil {
+			log.Printf("Skipping jwt key %s: %v", path, err)
+			continue
+		}
+		loaded = append(loaded, key)
+	}
+
+	for i, key := range loaded {
+		if i < len(loaded)-1 {
+			key.RetiredAt = loaded[i+1].CreatedAt
+		}
+		ks.keys[key.ID] = key
+	}
+	// an older key of another algorithm can still verify, but we only sign with the configured one
+	if n := len(loaded); n > 0 && loaded[n-1].Method.Alg() == ks.cfg.Algorithm {
+		ks.current = loaded[n-1]
+	}
+	ks.prune()
+	log.Printf("Loaded %d jwt signing keys from %s", len(loaded), ks.cfg.Dir)
+	return nil
+}
+
+// Rotate generates a new signing key, the previous one keeps verifying until the retention passes
+func (ks *KeySet) Rotate() error {
+	key, err := generateKey(ks.cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+	if ks.cfg.Dir != "" {
+		if err := writeKeyFile(ks.cfg.Dir, key); err != nil {
+			return err
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.current != nil && ks.current.ID != legacyKeyID {
+		ks.current.RetiredAt = key.CreatedAt
+	}
+	ks.keys[key.ID] = key
+	ks.current = key
+	ks.prune()
+	log.Printf("Rotated jwt signing key, new kid: %s", key.ID)
+	return nil
+}
+
+// drops keys that were retired long enough ago that no token signed by them can still be valid
+func (ks *KeySet) prune() {
+	for id, key := range ks.keys {
+		if id == legacyKeyID {
+			if ks.legacyExpired(time.Now()) {
+				delete(ks.keys, id)
+			}
+			continue
+		}
+		if key.RetiredAt.IsZero() {
+			continue
+		}
+		if time.Since(key.RetiredAt) > ks.cfg.Retention {
+			delete(ks.keys, id)
+			if ks.cfg.Dir != "" {
+				os.Remove(filepath.Join(ks.cfg.Dir, id+".pem"))
+			}
+		}
+	}
+}
+
+// StartRotation rotates the signing key on a fixed interval until StopRotation is called
+func (ks *KeySet) StartRotation(interval time.Duration) {
+	if interval <= 0 || ks.cfg.Algorithm == AlgHS256 {
+		return
+	}
+	ks.stopRotate = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := ks.Rotate(); err != nil {
+					log.Printf("Failed to rotate jwt signing key: %v", err)
+				}
+			case <-ks.stopRotate:
+				return
+			}
+		}
+	}()
+}
+
+func (ks *KeySet) StopRotation() {
+	if ks.stopRotate != nil {
+		close(ks.stopRotate)
+		ks.stopRotate = nil
+	}
+}
+
+// Sign signs the claims with the current key and sets the kid header, typ goes in the header too so
+// verifiers can tell the kinds of tokens apart
+func (ks *KeySet) Sign(claims jwt.Claims, typ string) (string, error) {
+	ks.mu.RLock()
+	key := ks.current
+	ks.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["typ"] = typ
+	if key.ID != legacyKeyID {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc picks the verification key from the kid header, the alg has to match the key
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	key, found := ks.keys[kid]
+	ks.mu.RUnlock()
+
+	if !found || (kid == legacyKeyID && ks.legacyExpired(time.Now())) {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	if key.Method == jwt.SigningMethodHS256 {
+		return key.Private, nil
+	}
+	return key.Public, nil
+}
+
+func (ks *KeySet) Methods() []string {
+	return []string{AlgHS256, AlgRS256, AlgEdDSA}
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys of every active key, shared secrets are never published
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: AlgRS256,
+				Kid: key.ID,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: AlgEdDSA,
+				Kid: key.ID,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid > set.Keys[j].Kid })
+	return set
+}
+
+func generateKey(alg string) (*SigningKey, error) {
+	now := time.Now().UTC()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	key := &SigningKey{
+		ID:        now.Format(kidTimeLayout) + "-" + hex.EncodeToString(suffix),
+		CreatedAt: now,
+	}
+
+	switch alg {
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, priv, &priv.PublicKey
+	case AlgEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, priv, pub
+	default:
+		return nil, fmt.Errorf("cannot generate keys for %q", alg)
+	}
+	return key, nil
+}
+
+func writeKeyFile(dir string, key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	return os.WriteFile(filepath.Join(dir, key.ID+".pem"), pem.EncodeToMemory(block), 0o600)
+}
+
+func readKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	id := strings.TrimSuffix(filepath.Base(path), ".pem")
+	key := &SigningKey{ID: id, Private: parsed}
+	if created, err := time.Parse(kidTimeLayout, strings.SplitN(id, "-", 2)[0]); err == nil {
+		key.CreatedAt = created
+	} else if info, err := os.Stat(path); err == nil {
+		key.CreatedAt = info.ModTime()
+	}
+
+	switch priv := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, &priv.PublicKey
+	case ed25519.PrivateKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, priv.Public()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// refresh tokens are opaque random strings, only their hash is stored in the db
+func GenerateRefreshToken() (string, string, error) {
+	return GenerateOpaqueToken()
+}
+
+// random url safe token plus its hash, used for refresh, email verification and reset tokens
+func GenerateOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+	return raw, HashToken(raw), nil
+}
+
+// sha256 is enough here since the tokens are long and random (no need for bcrypt)
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// api tokens carry a fixed prefix so they can't be mistaken for jwts (and secret scanners can find them)
+const APITokenPrefix = "gkc_"
+
+func GenerateAPIToken() (string, string, error) {
+	raw, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	raw = APITokenPrefix + raw
+	return raw, HashToken(raw), nil
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
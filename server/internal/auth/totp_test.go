@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the rfc 6238 test key "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// rfc 6238 appendix B (sha1), cut to six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil || got != tt.want {
+			t.Errorf("TOTPCode(%d) = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+	// apps show the secret in upper case, some users paste it in lower case
+	if got, _ := TOTPCode(strings.ToLower(rfcSecret), time.Unix(59, 0)); got != "287082" {
+		t.Errorf("lower case secret: %q", got)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0) // step 41152263
+	step := now.Unix() / totpPeriod
+	code := func(offset time.Duration) string {
+		c, err := TOTPCode(rfcSecret, now.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(0), step, true},
+		{"padded with spaces", " " + code(0) + " ", step, true},
+		{"one step behind", code(-totpPeriod * time.Second), step - 1, true},
+		{"one step ahead", code(totpPeriod * time.Second), step + 1, true},
+		{"two steps behind", code(-2 * totpPeriod * time.Second), 0, false},
+		{"two steps ahead", code(2 * totpPeriod * time.Second), 0, false},
+		{"wrong code", "000000", 0, false},
+		{"too short", code(0)[:5], 0, false},
+		{"too long", code(0) + "1", 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("ValidateTOTP(%q) = %d, %v, want %d, %v", tt.code, got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := ValidateTOTP("not base32!", "123456", now); ok {
+		t.Error("broken secret accepted a code")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("GeekCode", "ada@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/GeekCode:ada@example.com" {
+		t.Errorf("uri = %s", uri)
+	}
+	q := uri.Query()
+	if q.Get("secret") != rfcSecret || q.Get("issuer") != "GeekCode" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("query = %v", q)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 19 || strings.Count(code, "-") != 3 || code != strings.ToLower(code) {
+		t.Fatalf("recovery code %q", code)
+	}
+	other, _ := GenerateRecoveryCode()
+	if other == code {
+		t.Error("two recovery codes are the same")
+	}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{code, code},
+		{strings.ToUpper(code), code},
+		{strings.ReplaceAll(code, "-", ""), code},
+		{strings.ReplaceAll(code, "-", " "), code},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMFATokensAreNotAccessTokens(t *testing.T) {
+	if _, err := Init(KeyConfig{Algorithm: AlgHS256, Secret: "test-secret", Issuer: "geekcode-test"}); err != nil {
+		t.Fatal(err)
+	}
+	mfa, err := GenerateMFAToken(7, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(mfa); err == nil {
+		t.Error("mfa token accepted as an access token")
+	}
+	if _, err := ParseToken(mfa); err == nil {
+		t.Error("mfa token parsed as an access token")
+	}
+	expired, _ := GenerateMFAToken(7, -time.Second)
+	if _, err := ValidateMFAToken(expired); err == nil {
+		t.Error("expired mfa token accepted")
+	}
+}
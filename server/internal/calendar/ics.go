@@ -0,0 +1,122 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	icsTimeLayout = "20060102T150405Z"
+	maxLineOctets = 75
+)
+
+type Attendee struct {
+	Name  string
+	Email string
+}
+
+// Event is a single meeting invite, times are written in utc
+type Event struct {
+	UID         string // stable across updates so calendars replace the old invite
+	Sequence    int    // bump when the event changes
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	URL         string
+	Organizer   Attendee
+	Attendees   []Attendee
+	Cancelled   bool
+}
+
+// ICS renders the event as an iCalendar (RFC 5545) invite
+func ICS(ev Event) []byte {
+	method, status := "REQUEST", "CONFIRMED"
+	if ev.Cancelled {
+		method, status = "CANCEL", "CANCELLED"
+	}
+
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(fold(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//GeekCode//Interviews//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:" + method)
+	line("BEGIN:VEVENT")
+	line("UID:" + escape(ev.UID))
+	line(fmt.Sprintf("SEQUENCE:%d", ev.Sequence))
+	line("DTSTAMP:" + time.Now().UTC().Format(icsTimeLayout))
+	line("DTSTART:" + ev.Start.UTC().Format(icsTimeLayout))
+	line("DTEND:" + ev.End.UTC().Format(icsTimeLayout))
+	line("SUMMARY:" + escape(ev.Summary))
+	if ev.Description != "" {
+		line("DESCRIPTION:" + escape(ev.Description))
+	}
+	if ev.URL != "" {
+		line("URL:" + stripControl(ev.URL))
+		line("LOCATION:" + escape(ev.URL))
+	}
+	if ev.Organizer.Email != "" {
+		line("ORGANIZER" + nameParam(ev.Organizer.Name) + ":mailto:" + stripControl(ev.Organizer.Email))
+	}
+	for _, a := range ev.Attendees {
+		line("ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE" + nameParam(a.Name) + ":mailto:" + stripControl(a.Email))
+	}
+	line("STATUS:" + status)
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+func nameParam(name string) string {
+	name = strings.TrimSpace(stripControl(name))
+	if name == "" {
+		return ""
+	}
+	// parameter values can't contain quotes, quoting protects ; , and :
+	return `;CN="` + strings.ReplaceAll(name, `"`, "'") + `"`
+}
+
+// text values escape backslashes, separators and newlines
+func escape(s string) string {
+	return stripControl(strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s))
+}
+
+// control characters other than tab aren't allowed in values, a stray cr or lf would start a new property
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// lines longer than 75 octets are folded, continuation lines start with a space.
+// the split never happens inside a multi byte utf-8 character
+func fold(s string) string {
+	if len(s) <= maxLineOctets {
+		return s
+	}
+	var b strings.Builder
+	limit := maxLineOctets
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 0
+			limit = maxLineOctets - 1 // the leading space counts
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
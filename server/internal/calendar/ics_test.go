@@ -0,0 +1,66 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICSControlCharacters(t *testing.T) {
+	start := time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC)
+	ics := string(ICS(Event{
+		UID:         "room-1@geekcode",
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Summary:     "Interview\rMETHOD:CANCEL",
+		Description: "line one\nline two",
+		URL:         "https://geekcode.test/room/1",
+		Organizer:   Attendee{Name: "Grace", Email: "grace@example.com"},
+		Attendees: []Attendee{
+			{Name: "Ann\r\nATTENDEE:mailto:eve@example.com", Email: "ann@example.com"},
+			{Name: "Bob\x00 \"the builder\"", Email: "bob@example.com"},
+		},
+	}))
+
+	lines := strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n")
+	for _, line := range lines {
+		if strings.ContainsAny(line, "\r\n\x00") {
+			t.Errorf("control character left in %q", line)
+		}
+	}
+	attendees := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "ATTENDEE") {
+			attendees++
+		}
+		if strings.HasPrefix(line, "METHOD:") && line != "METHOD:REQUEST" {
+			t.Errorf("injected %q", line)
+		}
+	}
+	if attendees != 2 {
+		t.Errorf("%d attendee lines, want 2:\n%s", attendees, ics)
+	}
+	for _, want := range []string{
+		`CN="AnnATTENDEE:mailto:eve@example.com":mailto:ann@example.com`,
+		`CN="Bob 'the builder'":mailto:bob@example.com`,
+		`DESCRIPTION:line one\nline two`,
+		"SUMMARY:InterviewMETHOD:CANCEL",
+	} {
+		if !strings.Contains(strings.ReplaceAll(ics, "\r\n ", ""), want) {
+			t.Errorf("missing %q in:\n%s", want, ics)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("é", 60)
+	folded := fold(long)
+	for _, line := range strings.Split(folded, "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets", len(line))
+		}
+	}
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != long {
+		t.Errorf("unfolding gives %q", unfolded)
+	}
+}
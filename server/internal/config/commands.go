@@ -0,0 +1,24 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// loadLanguageCommands reads <prefix><LANGUAGE> variables, like FORMATTER_PYTHON="black -q -",
+// into commands keyed by the lowercased language. "off" turns a built in command off
+func loadLanguageCommands(prefix string) map[string]string {
+	commands := make(map[string]string)
+	for _, entry := range os.Environ() {
+		key, value, found := strings.Cut(entry, "=")
+		if !found || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		language := strings.ToLower(strings.TrimPrefix(key, prefix))
+		if language == "" {
+			continue
+		}
+		commands[language] = strings.TrimSpace(value)
+	}
+	return commands
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,8 +17,57 @@ type Config struct {
 	DBPassword string
 	DBName  string
 	JWTSecret string
+	JWTSigningAlg string
+	JWTKeysDir string
+	JWTKeyRotation time.Duration
+	JWTIssuer string
+	JWTLegacySecretUntil time.Time
 	FRONTEND_URL string
 	PROD_URL string
+	AccessTokenTTL time.Duration
+	RefreshTokenTTL time.Duration
+	OIDCProviders []OIDCProvider
+	SMTPHost string
+	SMTPPort string
+	SMTPUser string
+	SMTPPassword string
+	MailFrom string
+	MailDir string
+	RequireEmailVerification bool
+	LoginMaxAttempts int
+	LoginLockout time.Duration
+	RBACPolicyFile string
+	RoomDeleteRetention time.Duration
+	ScheduleJoinEarly time.Duration
+	ScheduleEndGrace time.Duration
+	AssistantProvider string
+	GeminiAPIKey string
+	GeminiModel string
+	AssistantMaxTokens int
+	AssistantTimeout time.Duration
+	AssistantQuotaWindow time.Duration
+	AssistantUserRequests int
+	AssistantUserTokens int
+	AssistantOrgRequests int
+	AssistantOrgTokens int
+	AssistantSummaries bool
+	Formatters map[string]string
+	FormatTimeout time.Duration
+	LSPServers map[string]string
+	LSPWorkDir string
+	LSPIdleTimeout time.Duration
+	LSPMaxSessions int
+	LanguagesFile string
+	ExecEnabled bool
+	ExecWorkDir string
+	ExecTimeout time.Duration
+	ExecCompileTimeout time.Duration
+	ExecMemoryMB int
+	ExecOutputBytes int
+	ExecWorkers int
+	ExecQueueSize int
+	ExecRoomConcurrency int
+	ExecUserConcurrency int
 }
 
 func LoadConfig() *Config {
@@ -35,8 +86,61 @@ func LoadConfig() *Config {
 		DBPassword: os.Getenv("DB_PASSWORD"),
 		DBName:  os.Getenv("DB_NAME"),
 		JWTSecret: os.Getenv("JWTSecret"),
+		JWTSigningAlg: GetEnv("JWT_SIGNING_ALG", "HS256"),
+		JWTKeysDir: os.Getenv("JWT_KEYS_DIR"),
+		JWTKeyRotation: GetDuration("JWT_KEY_ROTATION", 0),
+		JWTIssuer: GetEnv("JWT_ISSUER", "geekcode"),
+		JWTLegacySecretUntil: GetTime("JWT_LEGACY_SECRET_UNTIL"),
 		FRONTEND_URL: os.Getenv("FRONTEND_URL"),
 		PROD_URL: os.Getenv("PROD_URL"),
+		AccessTokenTTL: GetDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: GetDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		OIDCProviders: loadOIDCProviders(),
+		SMTPHost: os.Getenv("SMTP_HOST"),
+		SMTPPort: GetEnv("SMTP_PORT", "587"),
+		SMTPUser: os.Getenv("SMTP_USER"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		MailFrom: GetEnv("MAIL_FROM", "GeekCode <no-reply@geekcode.local>"),
+		MailDir: os.Getenv("MAIL_DIR"),
+		RequireEmailVerification: os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
+		LoginMaxAttempts: GetInt("LOGIN_MAX_ATTEMPTS", 10),
+		LoginLockout: GetDuration("LOGIN_LOCKOUT", 15*time.Minute),
+		RBACPolicyFile: os.Getenv("RBAC_POLICY_FILE"),
+		RoomDeleteRetention: GetDuration("ROOM_DELETE_RETENTION", 30*24*time.Hour),
+		ScheduleJoinEarly: GetDuration("SCHEDULE_JOIN_EARLY", 10*time.Minute),
+		ScheduleEndGrace: GetDuration("SCHEDULE_END_GRACE", 15*time.Minute),
+		AssistantProvider: os.Getenv("ASSISTANT_PROVIDER"),
+		GeminiAPIKey: os.Getenv("GEMINI_API_KEY"),
+		GeminiModel: GetEnv("GEMINI_MODEL", "gemini-2.0-flash"),
+		AssistantMaxTokens: GetInt("ASSISTANT_MAX_TOKENS", 1024),
+		AssistantTimeout: GetDuration("ASSISTANT_TIMEOUT", 60*time.Second),
+		AssistantQuotaWindow: GetDuration("ASSISTANT_QUOTA_WINDOW", 24*time.Hour),
+		AssistantUserRequests: GetInt("ASSISTANT_USER_REQUESTS", 100),
+		AssistantUserTokens: GetInt("ASSISTANT_USER_TOKENS", 200000),
+		AssistantOrgRequests: GetInt("ASSISTANT_ORG_REQUESTS", 0),
+		AssistantOrgTokens: GetInt("ASSISTANT_ORG_TOKENS", 0),
+		AssistantSummaries: os.Getenv("ASSISTANT_SUMMARIES") == "true",
+		// the command gets the code on stdin and prints the formatted code
+		Formatters: loadLanguageCommands("FORMATTER_"),
+		FormatTimeout: GetDuration("FORMAT_TIMEOUT", 10*time.Second),
+		// language servers speak json-rpc over stdio
+		LSPServers: loadLanguageCommands("LSP_SERVER_"),
+		LSPWorkDir: os.Getenv("LSP_WORKDIR"),
+		LSPIdleTimeout: GetDuration("LSP_IDLE_TIMEOUT", 2*time.Minute),
+		LSPMaxSessions: GetInt("LSP_MAX_SESSIONS", 20),
+		LanguagesFile: os.Getenv("LANGUAGES_FILE"),
+		// runs code on this host, only turn it on where the server is sandboxed
+		ExecEnabled: os.Getenv("EXEC_ENABLED") == "true",
+		ExecWorkDir: os.Getenv("EXEC_WORKDIR"),
+		ExecTimeout: GetDuration("EXEC_TIMEOUT", 10*time.Second),
+		ExecCompileTimeout: GetDuration("EXEC_COMPILE_TIMEOUT", 30*time.Second),
+		ExecMemoryMB: GetInt("EXEC_MEMORY_MB", 256),
+		ExecOutputBytes: GetInt("EXEC_OUTPUT_BYTES", 64*1024),
+		// runs wait in one queue for a worker, rooms take turns
+		ExecWorkers: GetInt("EXEC_WORKERS", 0),
+		ExecQueueSize: GetInt("EXEC_QUEUE_SIZE", 50),
+		ExecRoomConcurrency: GetInt("EXEC_ROOM_CONCURRENCY", 1),
+		ExecUserConcurrency: GetInt("EXEC_USER_CONCURRENCY", 1),
 	}
 
 	// Log configuration (without sensitive data)
@@ -54,4 +158,45 @@ func GetEnv(key string, fallback string) string {
 	}
 	return val
 
-}
\ No newline at end of file
+}
+
+//parses durations like "15m" or "720h", falls back on missing or invalid values
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("Warning: invalid duration for %s (%q), using %s", key, val, fallback)
+		return fallback
+	}
+	return d
+}
+
+//parses RFC 3339 times like "2026-01-31T00:00:00Z", zero on missing or invalid values
+func GetTime(key string) time.Time {
+	val := os.Getenv(key)
+	if val == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		log.Printf("Warning: invalid time for %s (%q), ignoring it", key, val)
+		return time.Time{}
+	}
+	return t
+}
+
+func GetInt(key string, fallback int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("Warning: invalid number for %s (%q), using %d", key, val, fallback)
+		return fallback
+	}
+	return n
+}
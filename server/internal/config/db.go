@@ -57,11 +57,38 @@ func ConnectDB() (*gorm.DB, error) {
 		&models.User{},
 		&models.Room{},
 		&models.Client{},
+		&models.RoomTag{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.UserIdentity{},
+		&models.OAuthState{},
+		&models.UserToken{},
+		&models.LoginAudit{},
+		&models.RecoveryCode{},
+		&models.Organization{},
+		&models.OrgMember{},
+		&models.Team{},
+		&models.TeamMember{},
+		&models.APIToken{},
+		&models.Problem{},
+		&models.RoomTemplate{},
+		&models.Rubric{},
+		&models.Scorecard{},
+		&models.AssistantUsage{},
+		&models.Submission{},
+		&models.RoomSummary{},
+		&models.IntegrityEvent{},
 	); err != nil {
 		log.Printf("Failed to migrate database: %v", err)
 		return nil, err
 	}
 
+	// full text search on room names, automigrate can't express index expressions
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_rooms_name_search ON rooms USING GIN (to_tsvector('simple', name))").Error; err != nil {
+		log.Printf("Failed to create room search index: %v", err)
+		return nil, err
+	}
+
 	log.Printf("Database migration completed successfully!")
 	
 	return db, nil
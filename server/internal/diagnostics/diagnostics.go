@@ -0,0 +1,348 @@
+// Package diagnostics turns compiler and interpreter output into errors with a file, line and column,
+// so editors can underline them. each runtime names its parser in the language registry
+package diagnostics
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Diagnostic is one problem, lines and columns start at 1 and a column of 0 means unknown
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Source   string   `json:"source"` // the parser that found it
+}
+
+// output past this is not looked at, the interesting part is at the start anyway
+const maxInput = 64 * 1024
+
+// a diagnostic per run is plenty to underline, a flood of them only slows the editor down
+const maxDiagnostics = 100
+
+type parser func(output string, files map[string]bool) []Diagnostic
+
+var parsers = map[string]parser{
+	"gcc":    parseGCC, // gcc, g++, clang and kotlinc share the format
+	"go":     parseGo,
+	"javac":  parseJava,
+	"python": parsePython,
+	"node":   parseNode,
+	"rustc":  parseRust,
+	"tsc":    parseTSC,
+}
+
+// Supported tells whether a parser with that name exists
+func Supported(name string) bool {
+	_, found := parsers[name]
+	return found
+}
+
+// Parse reads the output with the named parser. only locations in the given files are reported,
+// frames inside the standard library or the runtime itself are skipped
+func Parse(name, output string, fileNames []string) []Diagnostic {
+	parse, found := parsers[name]
+	if !found || output == "" {
+		return nil
+	}
+	if len(output) > maxInput {
+		output = output[:maxInput]
+	}
+	files := make(map[string]bool, len(fileNames))
+	for _, fileName := range fileNames {
+		files[fileName] = true
+	}
+	diagnostics := parse(strings.ReplaceAll(output, "\r\n", "\n"), files)
+	if len(diagnostics) > maxDiagnostics {
+		diagnostics = diagnostics[:maxDiagnostics]
+	}
+	return diagnostics
+}
+
+// known returns the file as the room calls it, or false when it isn't one of the room's files
+func known(path string, files map[string]bool) (string, bool) {
+	path = strings.TrimPrefix(path, "./")
+	if files[path] {
+		return path, true
+	}
+	// files may be run from a flat directory, so a bare name still finds "src/main.py"
+	base := filepath.Base(path)
+	for file := range files {
+		if filepath.Base(file) == base {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func severity(word string) Severity {
+	switch strings.ToLower(word) {
+	case "warning":
+		return SeverityWarning
+	case "note", "info", "help":
+		return SeverityInfo
+	default:
+		return SeverityError
+	}
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// caretColumn finds the ^ under the source line, the way gcc, javac and python point at errors
+func caretColumn(line string) int {
+	if strings.TrimSpace(line) == "" || strings.Trim(line, " ^~") != "" {
+		return 0
+	}
+	return strings.Index(line, "^") + 1
+}
+
+// main.c:3:5: error: 'x' undeclared, ./main.go:3:2: undefined: x
+var gccLine = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)?\s*(?:(fatal error|error|warning|note):\s*)?(.+)$`)
+
+func parseGCC(output string, files map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		m := gccLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		file, ok := known(m[1], files)
+		if !ok {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     file,
+			Line:     atoi(m[2]),
+			Column:   atoi(m[3]),
+			Severity: severity(m[4]),
+			Message:  m[5],
+			Source:   "gcc",
+		})
+	}
+	return diagnostics
+}
+
+var (
+	// panic: runtime error: index out of range [5] with length 3
+	goPanic = regexp.MustCompile(`^panic: (.+)$`)
+	// \tmain.go:5 +0x1d under the goroutine's frames
+	goFrame = regexp.MustCompile(`^\s+(.+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// parseGo reads build errors, which look like gcc's without the severity, and panics
+func parseGo(output string, files map[string]bool) []Diagnostic {
+	diagnostics := parseGCC(output, files)
+	for i := range diagnostics {
+		diagnostics[i].Source = "go"
+	}
+	var panicked string
+	for _, line := range strings.Split(output, "\n") {
+		if m := goPanic.FindStringSubmatch(line); m != nil {
+			panicked = m[1]
+			continue
+		}
+		if m := goFrame.FindStringSubmatch(line); m != nil && panicked != "" {
+			if file, ok := known(m[1], files); ok {
+				diagnostics = append(diagnostics, Diagnostic{File: file, Line: atoi(m[2]), Severity: SeverityError, Message: "panic: " + panicked, Source: "go"})
+				panicked = ""
+			}
+		}
+	}
+	return diagnostics
+}
+
+var (
+	// Main.java:3: error: cannot find symbol
+	javacLine = regexp.MustCompile(`^(.+\.java):(\d+): (error|warning): (.+)$`)
+	// Exception in thread "main" java.lang.IllegalStateException: boom
+	javaException = regexp.MustCompile(`^Exception in thread "[^"]*" (.+)$`)
+	// \tat Main.main(Main.java:3)
+	javaFrame = regexp.MustCompile(`^\s+at .+\((.+\.java):(\d+)\)$`)
+)
+
+// parseJava reads javac errors, the caret two lines down gives the column, and uncaught exceptions
+func parseJava(output string, files map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	lines := strings.Split(output, "\n")
+	var exception string
+	for i, line := range lines {
+		if m := javacLine.FindStringSubmatch(line); m != nil {
+			file, ok := known(m[1], files)
+			if !ok {
+				continue
+			}
+			d := Diagnostic{File: file, Line: atoi(m[2]), Severity: severity(m[3]), Message: m[4], Source: "javac"}
+			if i+2 < len(lines) {
+				d.Column = caretColumn(lines[i+2])
+			}
+			diagnostics = append(diagnostics, d)
+			continue
+		}
+		if m := javaException.FindStringSubmatch(line); m != nil {
+			exception = m[1]
+			continue
+		}
+		// the first frame in the room's code is where it went wrong from the candidate's point of view
+		if m := javaFrame.FindStringSubmatch(line); m != nil && exception != "" {
+			if file, ok := known(m[1], files); ok {
+				diagnostics = append(diagnostics, Diagnostic{File: file, Line: atoi(m[2]), Severity: SeverityError, Message: exception, Source: "java"})
+				exception = ""
+			}
+		}
+	}
+	return diagnostics
+}
+
+var (
+	//   File "main.py", line 3, in <module>
+	pythonFrame = regexp.MustCompile(`^\s*File "(.+)", line (\d+)`)
+	// ValueError: boom, or a bare KeyboardInterrupt
+	pythonError = regexp.MustCompile(`^([A-Za-z_][\w.]*(?:Error|Exception|Exit|Interrupt|Warning)|[A-Za-z_][\w.]*)(?::\s*(.*))?$`)
+)
+
+// parsePython reads tracebacks: the last frame in the room's files and the final error line
+func parsePython(output string, files map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	lines := strings.Split(output, "\n")
+	var frame *Diagnostic
+	for _, line := range lines {
+		if m := pythonFrame.FindStringSubmatch(line); m != nil {
+			if file, ok := known(m[1], files); ok {
+				// no column: the line under it is printed without its indentation, so the caret can't be placed
+				frame = &Diagnostic{File: file, Line: atoi(m[2]), Severity: SeverityError, Source: "python"}
+			}
+			continue
+		}
+		if frame == nil || strings.HasPrefix(line, " ") || line == "" || strings.HasPrefix(line, "Traceback") {
+			continue
+		}
+		if m := pythonError.FindStringSubmatch(line); m != nil {
+			frame.Message = strings.TrimSpace(line)
+			diagnostics = append(diagnostics, *frame)
+			frame = nil
+		}
+	}
+	return diagnostics
+}
+
+var (
+	// /tmp/x/main.js:3 on the first line of an uncaught error
+	nodeLocation = regexp.MustCompile(`^(.+\.[cm]?[jt]s):(\d+)$`)
+	//     at Object.<anonymous> (main.js:3:9) or     at main.js:3:9
+	nodeFrame = regexp.MustCompile(`^\s+at (?:.*\()?(.+?):(\d+):(\d+)\)?$`)
+	// TypeError: x is not a function
+	nodeError = regexp.MustCompile(`^(?:Uncaught )?([A-Z]\w*(?:Error|Exception)|Error)(?:\s*\[\w+\])?: (.+)$`)
+)
+
+// parseNode reads uncaught errors: the message line and the first stack frame in the room's files.
+// syntax errors have no stack, their location is the "file:line" header with a caret under the code
+func parseNode(output string, files map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	lines := strings.Split(output, "\n")
+	var header *Diagnostic
+	var current *Diagnostic
+	for i, line := range lines {
+		if m := nodeLocation.FindStringSubmatch(line); m != nil {
+			if file, ok := known(m[1], files); ok {
+				header = &Diagnostic{File: file, Line: atoi(m[2]), Severity: SeverityError, Source: "node"}
+				if i+2 < len(lines) {
+					header.Column = caretColumn(lines[i+2])
+				}
+			}
+			continue
+		}
+		if m := nodeError.FindStringSubmatch(line); m != nil {
+			if current != nil && current.Line > 0 {
+				diagnostics = append(diagnostics, *current)
+			}
+			current = &Diagnostic{Severity: SeverityError, Message: strings.TrimPrefix(line, "Uncaught "), Source: "node"}
+			if header != nil {
+				current.File, current.Line, current.Column = header.File, header.Line, header.Column
+				header = nil
+			}
+			continue
+		}
+		if m := nodeFrame.FindStringSubmatch(line); m != nil && current != nil && current.Line == 0 {
+			if file, ok := known(m[1], files); ok {
+				current.File, current.Line, current.Column = file, atoi(m[2]), atoi(m[3])
+			}
+		}
+	}
+	if current != nil && current.Line > 0 {
+		diagnostics = append(diagnostics, *current)
+	}
+	return diagnostics
+}
+
+var (
+	// error[E0425]: cannot find value `x` in this scope
+	rustMessage = regexp.MustCompile(`^(error|warning)(?:\[\w+\])?: (.+)$`)
+	//   --> main.rs:2:5
+	rustLocation = regexp.MustCompile(`^\s*--> (.+):(\d+):(\d+)$`)
+	// thread 'main' panicked at main.rs:2:5:
+	rustPanic = regexp.MustCompile(`^thread '.*' panicked at (.+):(\d+):(\d+):?$`)
+)
+
+func parseRust(output string, files map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	lines := strings.Split(output, "\n")
+	var pending *Diagnostic
+	for i, line := range lines {
+		if m := rustMessage.FindStringSubmatch(line); m != nil {
+			pending = &Diagnostic{Severity: severity(m[1]), Message: m[2], Source: "rustc"}
+			continue
+		}
+		if m := rustLocation.FindStringSubmatch(line); m != nil && pending != nil {
+			if file, ok := known(m[1], files); ok {
+				pending.File, pending.Line, pending.Column = file, atoi(m[2]), atoi(m[3])
+				diagnostics = append(diagnostics, *pending)
+			}
+			pending = nil
+			continue
+		}
+		if m := rustPanic.FindStringSubmatch(line); m != nil {
+			if file, ok := known(m[1], files); ok {
+				message := "panicked"
+				if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					message = strings.TrimSpace(lines[i+1])
+				}
+				diagnostics = append(diagnostics, Diagnostic{File: file, Line: atoi(m[2]), Column: atoi(m[3]), Severity: SeverityError, Message: message, Source: "rustc"})
+			}
+		}
+	}
+	return diagnostics
+}
+
+// main.ts(2,5): error TS2304: Cannot find name 'x'.
+var tscLine = regexp.MustCompile(`^(.+)\((\d+),(\d+)\): (error|warning) (TS\d+: .+)$`)
+
+func parseTSC(output string, files map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		m := tscLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if file, ok := known(m[1], files); ok {
+			diagnostics = append(diagnostics, Diagnostic{File: file, Line: atoi(m[2]), Column: atoi(m[3]), Severity: severity(m[4]), Message: m[5], Source: "tsc"})
+		}
+	}
+	// tsc compiles, node runs: runtime errors still look like node's
+	return append(diagnostics, parseNode(output, files)...)
+}
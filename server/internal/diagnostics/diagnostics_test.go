@@ -0,0 +1,95 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current output")
+
+// every testdata/<name>.txt is real compiler or interpreter output, <name>.golden the diagnostics it gives
+func TestParseGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		parser string
+		files  []string
+	}{
+		{"gcc", "gcc", []string{"main.cpp", "util.h"}},
+		{"go_build", "go", []string{"main.go"}},
+		{"go_panic", "go", []string{"main.go"}},
+		{"javac", "javac", []string{"Main.java"}},
+		{"java_exception", "javac", []string{"Main.java"}},
+		{"python", "python", []string{"main.py", "helper.py"}},
+		{"python_stdlib", "python", []string{"main.py"}},
+		{"python_syntax", "python", []string{"main.py"}},
+		{"node", "node", []string{"main.js"}},
+		{"node_thrown", "node", []string{"main.js", "lib/solve.js"}},
+		{"node_syntax", "node", []string{"main.js"}},
+		{"rustc", "rustc", []string{"main.rs"}},
+		{"rustc_panic", "rustc", []string{"main.rs"}},
+		{"tsc", "tsc", []string{"main.ts", "src/util.ts"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join("testdata", tt.name+".txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(Parse(tt.parser, string(input), tt.files), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("diagnostics differ from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	if Parse("unknown", "main.c:1:1: error: x", []string{"main.c"}) != nil {
+		t.Error("unknown parser returned diagnostics")
+	}
+	if got := Parse("gcc", "main.c:1:1: error: x\r\n", []string{"main.c"}); len(got) != 1 || got[0].Message != "x" {
+		t.Errorf("windows line endings: %+v", got)
+	}
+	flood := strings.Repeat("main.c:1:1: error: x\n", maxDiagnostics*2)
+	if got := Parse("gcc", flood, []string{"main.c"}); len(got) != maxDiagnostics {
+		t.Errorf("got %d diagnostics, want them capped at %d", len(got), maxDiagnostics)
+	}
+}
+
+func TestCaretColumn(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"        ^", 9},
+		{"    ^~~~~", 5},
+		{"^", 1},
+		{"", 0},
+		{"  int ^x", 0}, // code, not a caret line
+	}
+	for _, tt := range tests {
+		if got := caretColumn(tt.line); got != tt.want {
+			t.Errorf("caretColumn(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
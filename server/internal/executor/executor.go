@@ -0,0 +1,258 @@
+// Package executor compiles and runs a room's files on this host with the commands and limits of
+// their runtime. it is off unless EXEC_ENABLED is set, the host should be a sandbox of its own
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"geekCode/internal/config"
+	"geekCode/internal/diagnostics"
+	"geekCode/internal/languages"
+	"geekCode/internal/models"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrNoSource = errors.New("there is no file to run")
+
+const (
+	StageCompile = "compile"
+	StageRun     = "run"
+)
+
+// Request is one run
+type Request struct {
+	Runtime *languages.Runtime
+	Files   []models.CodeFile
+	Main    string // the file to run, the first file of the runtime's language when empty
+	Stdin   string
+}
+
+// Result is what a run printed and how it ended, a failed compile stops at StageCompile
+type Result struct {
+	Language   string `json:"language"`
+	FileName   string `json:"fileName"`
+	Stage      string `json:"stage"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"` // the compiler's output when the compile failed
+	ExitCode   int    `json:"exitCode"`
+	TimedOut   bool   `json:"timedOut,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+
+	Diagnostics []diagnostics.Diagnostic `json:"diagnostics,omitempty"` // errors found in stderr, by file and line
+}
+
+func (r *Result) Failed() bool {
+	return r.ExitCode != 0 || r.TimedOut
+}
+
+type Executor struct {
+	workDir        string
+	defaults       languages.Limits
+	compileTimeout time.Duration
+}
+
+func New(cfg *config.Config) *Executor {
+	workDir := cfg.ExecWorkDir
+	if workDir == "" {
+		workDir = filepath.Join(os.TempDir(), "geekcode-exec")
+	}
+	return &Executor{
+		workDir: workDir,
+		defaults: languages.Limits{
+			TimeoutMs:   int(cfg.ExecTimeout / time.Millisecond),
+			MemoryMB:    cfg.ExecMemoryMB,
+			OutputBytes: cfg.ExecOutputBytes,
+		},
+		compileTimeout: cfg.ExecCompileTimeout,
+	}
+}
+
+// Run writes the files to a fresh directory, compiles when the runtime needs it and runs the main file
+func (e *Executor) Run(ctx context.Context, req Request) (*Result, error) {
+	main, found := mainFile(req)
+	if !found {
+		return nil, ErrNoSource
+	}
+	if err := os.MkdirAll(e.workDir, 0o700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(e.workDir, "run-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range req.Files {
+		if err := os.WriteFile(filepath.Join(dir, safeName(file.Name)), []byte(file.Content), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	if _, written := findFile(req.Files, main.Name); !written {
+		if err := os.WriteFile(filepath.Join(dir, safeName(main.Name)), []byte(main.Content), 0o600); err != nil {
+			return nil, err
+		}
+	}
+
+	limits := e.limits(req.Runtime.Limits)
+	result := &Result{Language: req.Runtime.Name, FileName: main.Name}
+	started := time.Now()
+	defer func() {
+		result.DurationMs = time.Since(started).Milliseconds()
+		result.Diagnostics = diagnostics.Parse(req.Runtime.Diagnostics, result.Stderr, fileNames(req.Files, main.Name))
+	}()
+
+	name := safeName(main.Name)
+	if len(req.Runtime.Compile) > 0 {
+		result.Stage = StageCompile
+		// compilers get the time but not the memory cap, they need more than the programs they build
+		if err := e.command(ctx, dir, expand(req.Runtime.Compile, dir, name), "", e.compileTimeout, -1, limits.OutputBytes, result); err != nil {
+			return nil, err
+		}
+		if result.Failed() {
+			return result, nil
+		}
+	}
+
+	*result = Result{Language: result.Language, FileName: result.FileName, Stage: StageRun}
+	if err := e.command(ctx, dir, expand(req.Runtime.Run, dir, name), req.Stdin, limits.Timeout(), limits.MemoryMB, limits.OutputBytes, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// command runs one step and fills in the result, errors mean the command couldn't be started at all
+func (e *Executor) command(ctx context.Context, dir string, args []string, stdin string, timeout time.Duration, memoryMB, outputBytes int, result *Result) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if memoryMB > 0 {
+		args = limitMemory(args, memoryMB)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir, "TMPDIR=" + dir, "LANG=C.UTF-8"}
+	cmd.Stdin = strings.NewReader(stdin)
+	stdout := &cappedBuffer{max: outputBytes}
+	stderr := &cappedBuffer{max: outputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// whatever the program started is killed with it, and left over pipes don't keep us waiting
+	isolate(cmd)
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	// paths in messages are relative to the room's files, not to wherever they were run
+	result.Stdout = strings.ReplaceAll(stdout.String(), dir+string(filepath.Separator), "")
+	result.Stderr = strings.ReplaceAll(stderr.String(), dir+string(filepath.Separator), "")
+	result.Truncated = result.Truncated || stdout.truncated || stderr.truncated
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case ctx.Err() == context.DeadlineExceeded:
+		result.TimedOut = true
+		result.ExitCode = -1
+		result.Stderr += fmt.Sprintf("\ntime limit of %s exceeded", timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		return fmt.Errorf("starting %s: %w", args[0], err)
+	}
+	return nil
+}
+
+func (e *Executor) limits(l languages.Limits) languages.Limits {
+	if l.TimeoutMs <= 0 {
+		l.TimeoutMs = e.defaults.TimeoutMs
+	}
+	if l.MemoryMB == 0 {
+		l.MemoryMB = e.defaults.MemoryMB
+	}
+	if l.OutputBytes <= 0 {
+		l.OutputBytes = e.defaults.OutputBytes
+	}
+	return l
+}
+
+// mainFile picks the file to run: the requested one, else the first in the runtime's language
+func mainFile(req Request) (models.CodeFile, bool) {
+	if req.Main != "" {
+		return findFile(req.Files, req.Main)
+	}
+	for _, file := range req.Files {
+		if strings.EqualFold(file.Language, req.Runtime.Name) || (req.Runtime.Extension != "" && filepath.Ext(file.Name) == req.Runtime.Extension) {
+			return file, true
+		}
+	}
+	return models.CodeFile{}, false
+}
+
+func findFile(files []models.CodeFile, name string) (models.CodeFile, bool) {
+	for _, file := range files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return models.CodeFile{}, false
+}
+
+func expand(command []string, dir, file string) []string {
+	replacer := strings.NewReplacer("{dir}", dir, "{file}", file, "{name}", strings.TrimSuffix(file, filepath.Ext(file)))
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// safeName keeps file names inside the run directory
+func safeName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." || name == "" {
+		return "main"
+	}
+	return name
+}
+
+// cappedBuffer keeps the first max bytes and throws the rest away, the program isn't blocked by it
+// (not embedding the buffer on purpose, io.Copy would use its ReadFrom and skip the cap)
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return strings.ToValidUTF8(b.buf.String(), "")
+}
+
+func fileNames(files []models.CodeFile, main string) []string {
+	names := []string{main}
+	for _, file := range files {
+		if file.Name != main {
+			names = append(names, file.Name)
+		}
+	}
+	return names
+}
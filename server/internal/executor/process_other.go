@@ -0,0 +1,12 @@
+//go:build !unix
+
+package executor
+
+import "os/exec"
+
+func isolate(cmd *exec.Cmd) {}
+
+// there is no portable way to cap memory, runs are only time limited here
+func limitMemory(args []string, memoryMB int) []string {
+	return args
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package executor
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// isolate puts the command in its own process group so a timeout kills its children too
+func isolate(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// limitMemory caps the address space through the shell, go can't set rlimits for a child on its own
+func limitMemory(args []string, memoryMB int) []string {
+	return append([]string{"/bin/sh", "-c", `ulimit -v "$0" && exec "$@"`, strconv.Itoa(memoryMB * 1024)}, args...)
+}
@@ -0,0 +1,201 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"geekCode/internal/config"
+	"runtime"
+	"sync"
+)
+
+var (
+	ErrQueueFull = errors.New("the server is busy running code, try again in a moment")
+	ErrUserBusy  = errors.New("your previous run is still going")
+)
+
+// Job is one run waiting for a worker. the callbacks are called in order, one at a time, and must not block
+type Job struct {
+	Room    string
+	User    string
+	Context context.Context // a job whose context is done by the time it gets a worker is dropped
+	Request Request
+	Queued  func(position int) // while waiting, whenever its place in line changes, 1 is next
+	Started func()
+	Done    func(*Result, error)
+}
+
+// runner is what the queue hands jobs to, the Executor outside of tests
+type runner interface {
+	Run(ctx context.Context, req Request) (*Result, error)
+}
+
+// Queue runs jobs on a fixed number of workers. rooms take turns, so a busy room can't starve the
+// others, a room only has so many runs going at once and a user only so many waiting or running
+type Queue struct {
+	executor runner
+	maxQueue int
+	perRoom  int
+	perUser  int
+
+	mu      sync.Mutex
+	ready   *sync.Cond
+	waiting map[string][]*Job // per room, oldest first
+	turns   []string          // rooms with waiting jobs, in the order they get a worker
+	next    int               // index in turns of the room whose turn it is
+	queued  int
+	running map[string]int // per room
+	users   map[string]int // waiting or running, per user
+
+	// held while callbacks are called, so updates arrive in the order they happened
+	notifyMu  sync.Mutex
+	positions map[*Job]int
+}
+
+func NewQueue(executor *Executor, cfg *config.Config) *Queue {
+	return newQueue(executor, cfg)
+}
+
+func newQueue(executor runner, cfg *config.Config) *Queue {
+	q := &Queue{
+		executor:  executor,
+		maxQueue:  max(cfg.ExecQueueSize, 1),
+		perRoom:   max(cfg.ExecRoomConcurrency, 1),
+		perUser:   max(cfg.ExecUserConcurrency, 1),
+		waiting:   make(map[string][]*Job),
+		running:   make(map[string]int),
+		users:     make(map[string]int),
+		positions: make(map[*Job]int),
+	}
+	q.ready = sync.NewCond(&q.mu)
+	workers := cfg.ExecWorkers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	for range workers {
+		go q.work()
+	}
+	return q
+}
+
+// Submit puts the job in line, it is turned away when the queue is full or its user already has
+// as many runs as they may have
+func (q *Queue) Submit(job *Job) error {
+	q.mu.Lock()
+	if q.users[job.User] >= q.perUser {
+		q.mu.Unlock()
+		return ErrUserBusy
+	}
+	if q.queued >= q.maxQueue {
+		q.mu.Unlock()
+		return ErrQueueFull
+	}
+	if len(q.waiting[job.Room]) == 0 {
+		// a room that joins the line waits for the ones already in it
+		q.turns = append(q.turns, "")
+		copy(q.turns[q.next+1:], q.turns[q.next:])
+		q.turns[q.next] = job.Room
+		q.next = (q.next + 1) % len(q.turns)
+	}
+	q.waiting[job.Room] = append(q.waiting[job.Room], job)
+	q.queued++
+	q.users[job.User]++
+	q.ready.Signal()
+	q.notify(nil)
+	return nil
+}
+
+func (q *Queue) work() {
+	for {
+		q.mu.Lock()
+		job := q.take()
+		for job == nil {
+			q.ready.Wait()
+			job = q.take()
+		}
+		q.running[job.Room]++
+		q.notify(job)
+
+		var result *Result
+		err := job.Context.Err()
+		if err == nil {
+			result, err = q.executor.Run(job.Context, job.Request)
+		}
+
+		q.mu.Lock()
+		q.running[job.Room]--
+		if q.running[job.Room] == 0 {
+			delete(q.running, job.Room)
+		}
+		q.users[job.User]--
+		if q.users[job.User] == 0 {
+			delete(q.users, job.User)
+		}
+		// the room may have been waiting for this run to end
+		q.ready.Broadcast()
+		q.mu.Unlock()
+		job.Done(result, err)
+	}
+}
+
+// take removes the oldest job of the first room in turn that is below its cap, called with mu held
+func (q *Queue) take() *Job {
+	for i := range q.turns {
+		at := (q.next + i) % len(q.turns)
+		room := q.turns[at]
+		if q.running[room] >= q.perRoom {
+			continue
+		}
+		jobs := q.waiting[room]
+		job := jobs[0]
+		q.queued--
+		if len(jobs) == 1 {
+			delete(q.waiting, room)
+			q.turns = append(q.turns[:at], q.turns[at+1:]...)
+			if len(q.turns) == 0 {
+				q.next = 0
+			} else {
+				q.next = at % len(q.turns)
+			}
+		} else {
+			q.waiting[room] = jobs[1:]
+			q.next = (at + 1) % len(q.turns)
+		}
+		return job
+	}
+	return nil
+}
+
+// notify tells waiting jobs whose place changed and the started one that it started. called with mu
+// held, it unlocks it before calling back
+func (q *Queue) notify(started *Job) {
+	// places follow the turns: the first job of every room in turn, then the second of every room...
+	places := make(map[*Job]int, q.queued)
+	for round, place := 0, 0; place < q.queued; round++ {
+		for i := range q.turns {
+			jobs := q.waiting[q.turns[(q.next+i)%len(q.turns)]]
+			if round < len(jobs) {
+				place++
+				places[jobs[round]] = place
+			}
+		}
+	}
+	q.notifyMu.Lock()
+	q.mu.Unlock()
+	defer q.notifyMu.Unlock()
+
+	if started != nil {
+		delete(q.positions, started)
+		if started.Started != nil {
+			started.Started()
+		}
+	}
+	for job, place := range places {
+		if q.positions[job] == place {
+			continue
+		}
+		q.positions[job] = place
+		if job.Queued != nil {
+			job.Queued(place)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"geekCode/internal/config"
+)
+
+// blockingRunner holds every run until the test releases it, runs are told apart by Request.Main
+type blockingRunner struct {
+	started chan string
+	mu      sync.Mutex
+	release map[string]chan struct{}
+}
+
+func newBlockingRunner() *blockingRunner {
+	return &blockingRunner{started: make(chan string, 100), release: make(map[string]chan struct{})}
+}
+
+func (r *blockingRunner) gate(id string) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.release[id] == nil {
+		r.release[id] = make(chan struct{})
+	}
+	return r.release[id]
+}
+
+func (r *blockingRunner) Run(ctx context.Context, req Request) (*Result, error) {
+	r.started <- req.Main
+	<-r.gate(req.Main)
+	return &Result{FileName: req.Main}, nil
+}
+
+func (r *blockingRunner) finish(id string) {
+	close(r.gate(id))
+}
+
+// next waits for the next run to start
+func (r *blockingRunner) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case id := <-r.started:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("no run started")
+		return ""
+	}
+}
+
+// idle checks that nothing starts for a little while
+func (r *blockingRunner) idle(t *testing.T) {
+	t.Helper()
+	select {
+	case id := <-r.started:
+		t.Fatalf("%s started, want it to wait", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func testJob(room, user, id string) *Job {
+	return &Job{
+		Room:    room,
+		User:    user,
+		Context: context.Background(),
+		Request: Request{Main: id},
+		Done:    func(*Result, error) {},
+	}
+}
+
+func TestQueueRoomsTakeTurns(t *testing.T) {
+	runner := newBlockingRunner()
+	q := newQueue(runner, &config.Config{ExecWorkers: 1, ExecQueueSize: 10, ExecRoomConcurrency: 1, ExecUserConcurrency: 10})
+
+	if err := q.Submit(testJob("a", "ann", "a1")); err != nil {
+		t.Fatal(err)
+	}
+	if id := runner.next(t); id != "a1" {
+		t.Fatalf("%s started first", id)
+	}
+
+	// a busy room queues up more runs before the others get to ask
+	var mu sync.Mutex
+	positions := map[string]int{}
+	for _, job := range []*Job{testJob("a", "ann", "a2"), testJob("a", "ann", "a3"), testJob("b", "bob", "b1"), testJob("c", "cat", "c1")} {
+		id := job.Request.Main
+		job.Queued = func(position int) {
+			mu.Lock()
+			positions[id] = position
+			mu.Unlock()
+		}
+		if err := q.Submit(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	want := map[string]int{"a2": 1, "b1": 2, "c1": 3, "a3": 4}
+	for id, position := range want {
+		if positions[id] != position {
+			t.Errorf("%s is number %d in line, want %d", id, positions[id], position)
+		}
+	}
+	mu.Unlock()
+
+	var order []string
+	previous := "a1"
+	for range 4 {
+		runner.finish(previous)
+		previous = runner.next(t)
+		order = append(order, previous)
+	}
+	runner.finish(previous)
+	if want := []string{"a2", "b1", "c1", "a3"}; !slices.Equal(order, want) {
+		t.Fatalf("runs started in order %v, want %v", order, want)
+	}
+}
+
+func TestQueueRoomConcurrency(t *testing.T) {
+	runner := newBlockingRunner()
+	q := newQueue(runner, &config.Config{ExecWorkers: 2, ExecQueueSize: 10, ExecRoomConcurrency: 1, ExecUserConcurrency: 10})
+
+	for _, job := range []*Job{testJob("a", "ann", "a1"), testJob("a", "ann", "a2"), testJob("b", "bob", "b1")} {
+		if err := q.Submit(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	started := []string{runner.next(t), runner.next(t)}
+	slices.Sort(started)
+	if !slices.Equal(started, []string{"a1", "b1"}) {
+		t.Fatalf("started %v, want a1 and b1", started)
+	}
+	// a worker is free, but the room already has its run going
+	runner.finish("b1")
+	runner.idle(t)
+
+	runner.finish("a1")
+	if id := runner.next(t); id != "a2" {
+		t.Fatalf("%s started, want a2", id)
+	}
+	runner.finish("a2")
+}
+
+func TestQueueUserConcurrency(t *testing.T) {
+	runner := newBlockingRunner()
+	q := newQueue(runner, &config.Config{ExecWorkers: 2, ExecQueueSize: 10, ExecRoomConcurrency: 2, ExecUserConcurrency: 1})
+
+	done := make(chan struct{})
+	first := testJob("a", "ann", "a1")
+	first.Done = func(*Result, error) { close(done) }
+	if err := q.Submit(first); err != nil {
+		t.Fatal(err)
+	}
+	// running or waiting, the user is at their limit either way
+	if err := q.Submit(testJob("b", "ann", "b1")); !errors.Is(err, ErrUserBusy) {
+		t.Fatalf("second run of the same user got %v, want ErrUserBusy", err)
+	}
+	if err := q.Submit(testJob("a", "bob", "a2")); err != nil {
+		t.Fatalf("another user in the same room got %v", err)
+	}
+
+	runner.next(t)
+	runner.next(t)
+	runner.finish("a1")
+	runner.finish("a2")
+	<-done
+	if err := q.Submit(testJob("b", "ann", "b1")); err != nil {
+		t.Fatalf("run after the first one finished got %v", err)
+	}
+	runner.next(t)
+	runner.finish("b1")
+}
+
+func TestQueueFull(t *testing.T) {
+	runner := newBlockingRunner()
+	q := newQueue(runner, &config.Config{ExecWorkers: 1, ExecQueueSize: 2, ExecRoomConcurrency: 1, ExecUserConcurrency: 1})
+
+	if err := q.Submit(testJob("a", "ann", "a1")); err != nil {
+		t.Fatal(err)
+	}
+	runner.next(t)
+	// the running job doesn't take a place in line
+	for _, job := range []*Job{testJob("b", "bob", "b1"), testJob("c", "cat", "c1")} {
+		if err := q.Submit(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Submit(testJob("d", "dan", "d1")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("got %v, want ErrQueueFull", err)
+	}
+
+	runner.finish("a1")
+	runner.finish(runner.next(t))
+	if err := q.Submit(testJob("d", "dan", "d1")); err != nil {
+		t.Fatalf("got %v once a place freed up", err)
+	}
+	runner.finish("c1")
+	runner.finish("d1")
+}
+
+func TestQueueDropsCancelledJobs(t *testing.T) {
+	runner := newBlockingRunner()
+	q := newQueue(runner, &config.Config{ExecWorkers: 1, ExecQueueSize: 10, ExecRoomConcurrency: 1, ExecUserConcurrency: 10})
+
+	if err := q.Submit(testJob("a", "ann", "a1")); err != nil {
+		t.Fatal(err)
+	}
+	runner.next(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	job := testJob("b", "bob", "b1")
+	job.Context = ctx
+	job.Done = func(_ *Result, err error) { result <- err }
+	if err := q.Submit(job); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	runner.finish("a1")
+
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	runner.idle(t)
+}
@@ -0,0 +1,151 @@
+// Package formatter formats code for the shared editor: Go in process with go/format, other languages with
+// external formatters when they are installed on the server
+package formatter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"geekCode/internal/config"
+	"go/format"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// formatters aren't worth running on anything bigger
+const maxSource = 256 * 1024
+
+var (
+	ErrUnsupported = errors.New("no formatter is available for this language")
+	ErrTooLarge    = errors.New("the file is too large to format")
+)
+
+// SyntaxError means the formatter rejected the code, usually because it doesn't parse
+type SyntaxError struct {
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return "the code could not be formatted: " + e.Message
+}
+
+// the external formatters used when they are on the PATH, FORMATTER_<LANGUAGE> replaces them
+var defaultCommands = map[string]string{
+	"python":     "black -q -",
+	"c":          "clang-format --assume-filename=main.c",
+	"cpp":        "clang-format --assume-filename=main.cpp",
+	"java":       "clang-format --assume-filename=Main.java",
+	"javascript": "prettier --stdin-filepath main.js",
+	"typescript": "prettier --stdin-filepath main.ts",
+	"rust":       "rustfmt --emit stdout --edition 2021",
+}
+
+// names the editor and older rooms use for the same language
+var aliases = map[string]string{
+	"golang": "go",
+	"py":     "python",
+	"c++":    "cpp",
+	"js":     "javascript",
+	"ts":     "typescript",
+	"rs":     "rust",
+}
+
+// Registry knows which formatter to run for a language
+type Registry struct {
+	commands map[string][]string
+	timeout  time.Duration
+}
+
+func New(cfg *config.Config) *Registry {
+	r := &Registry{commands: make(map[string][]string), timeout: cfg.FormatTimeout}
+	commands := make(map[string]string, len(defaultCommands))
+	for language, command := range defaultCommands {
+		commands[language] = command
+	}
+	for language, command := range cfg.Formatters {
+		commands[Normalize(language)] = command
+	}
+	for language, command := range commands {
+		args := strings.Fields(command)
+		if len(args) == 0 || command == "off" || language == "go" {
+			continue
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			// only worth a warning when somebody configured it on purpose
+			if _, configured := cfg.Formatters[language]; configured {
+				log.Printf("Warning: formatter %q for %s is not installed, skipping", args[0], language)
+			}
+			continue
+		}
+		r.commands[language] = args
+	}
+	return r
+}
+
+// Normalize maps a language name to the one formatters are registered under
+func Normalize(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if alias, found := aliases[language]; found {
+		return alias
+	}
+	return language
+}
+
+// Languages lists what can be formatted on this server
+func (r *Registry) Languages() []string {
+	languages := []string{"go"}
+	for language := range r.commands {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Format returns the formatted code, ErrUnsupported when there is no formatter for the language
+// and a *SyntaxError when the formatter rejected the code
+func (r *Registry) Format(ctx context.Context, language, code string) (string, error) {
+	if len(code) > maxSource {
+		return "", ErrTooLarge
+	}
+	language = Normalize(language)
+	if language == "go" {
+		formatted, err := format.Source([]byte(code))
+		if err != nil {
+			return "", &SyntaxError{Message: err.Error()}
+		}
+		return string(formatted), nil
+	}
+	args, found := r.commands[language]
+	if !found {
+		return "", ErrUnsupported
+	}
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(code)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s timed out", args[0])
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", &SyntaxError{Message: strings.TrimSpace(stderr.String())}
+		}
+		return "", fmt.Errorf("running %s: %w", args[0], err)
+	}
+	if stdout.Len() > 2*maxSource {
+		return "", fmt.Errorf("%s produced too much output", args[0])
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,81 @@
+package formatter
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/config"
+)
+
+func TestFormatGo(t *testing.T) {
+	r := New(&config.Config{})
+
+	formatted, err := r.Format(context.Background(), " Golang ", "package main\nfunc main(){\nx:=1\n_=x}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package main\n\nfunc main() {\n\tx := 1\n\t_ = x\n}\n"; formatted != want {
+		t.Errorf("formatted = %q, want %q", formatted, want)
+	}
+
+	_, err = r.Format(context.Background(), "go", "package main\nfunc main() {")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Message == "" {
+		t.Errorf("broken code: %v", err)
+	}
+}
+
+func TestFormatTooLarge(t *testing.T) {
+	r := New(&config.Config{})
+	huge := "package main\n" + strings.Repeat("// padding\n", maxSource/11+1)
+	if _, err := r.Format(context.Background(), "go", huge); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+	// the limit is checked before anything runs, even for languages without a formatter
+	if _, err := r.Format(context.Background(), "cobol", huge); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+// standard unix tools stand in for the real formatters
+func TestFormatExternal(t *testing.T) {
+	for _, tool := range []string{"cat", "sh", "sleep"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool + " is not installed")
+		}
+	}
+	r := New(&config.Config{
+		FormatTimeout: 100 * time.Millisecond,
+		Formatters: map[string]string{
+			"python": "cat",
+			"kotlin": "sleep 5",
+			"java":   "off",
+			"swift":  "no-such-formatter-installed",
+		},
+	})
+
+	if got := strings.Join(r.Languages(), ","); !strings.Contains(got, "go,") || strings.Contains(got, "java") || strings.Contains(got, "swift") {
+		t.Errorf("languages = %s", got)
+	}
+
+	formatted, err := r.Format(context.Background(), "py", "print('hi')\n")
+	if err != nil || formatted != "print('hi')\n" {
+		t.Errorf("python = %q, %v", formatted, err)
+	}
+	for _, language := range []string{"java", "swift", "cobol"} {
+		if _, err := r.Format(context.Background(), language, "x"); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: got %v, want ErrUnsupported", language, err)
+		}
+	}
+	var syntaxErr *SyntaxError
+	if _, err := New(&config.Config{Formatters: map[string]string{"rust": "sh -c false"}}).Format(context.Background(), "rs", "fn main() {"); !errors.As(err, &syntaxErr) {
+		t.Errorf("failing formatter: got %v, want a SyntaxError", err)
+	}
+	if _, err := r.Format(context.Background(), "kotlin", "fun main() {}"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow formatter: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geekCode/internal/auth"
+	"geekCode/internal/mailer"
+	"geekCode/internal/models"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+	// the request has been answered by then, so nothing else cuts a hanging mail server short
+	passwordResetSendTimeout = time.Minute
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// confirms the email address with the token from the verification mail
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, req.Token, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", token.UserID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified successfully"})
+}
+
+// sends a fresh verification mail to the logged in user
+func (h *Handler) ResendVerificationEmail(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+
+	var user models.User
+	if err := h.DB.First(&user, userId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already verified"})
+		return
+	}
+
+	if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+}
+
+// always answers the same way so the endpoint can't be used to find out which emails have accounts
+func (h *Handler) RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if wait := h.resetGuard.Attempt(c.ClientIP(), req.Email); wait > 0 {
+		abortTooManyAttempts(c, wait, "too many password reset requests, try again later")
+		return
+	}
+
+	// looked up and sent in the background, waiting for the mail server would show which emails have accounts
+	go h.sendPasswordResetFor(req.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if an account exists for this email, a reset link has been sent"})
+}
+
+// sets the new password and logs the user out everywhere, api tokens included
+func (h *Handler) ConfirmPasswordReset(c *gin.Context) {
+	var req PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	var userID uint
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, req.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+		now := time.Now()
+		// the reset link was delivered to the inbox, so it proves the address too
+		if err := tx.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+			"password":           string(hashed),
+			"email_verified_at":  gorm.Expr("COALESCE(email_verified_at, ?)", now),
+			"tokens_valid_after": now,
+		}).Error; err != nil {
+			return err
+		}
+		// whoever had the old password may have made api tokens or websocket tickets with it
+		if err := tx.Model(&models.APIToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", token.UserID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, models.TokenPurposeWebSocket).
+			Update("used_at", now).Error
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	h.revokeAllRefreshTokens(userID)
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+}
+
+func (h *Handler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	raw, err := createUserToken(h.DB, user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := h.frontendLink("/verify-email", raw)
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your GeekCode email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %d hours.\n",
+			user.FirstName, link, int(emailVerificationTTL.Hours())),
+	})
+}
+
+func (h *Handler) sendPasswordResetEmail(ctx context.Context, user *models.User) error {
+	raw, err := createUserToken(h.DB, user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	link := h.frontendLink("/reset-password", raw)
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your GeekCode password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your GeekCode account. If it was you, open the link below:\n\n%s\n\nThe link expires in %d minutes. If you didn't ask for this you can ignore this email.\n",
+			user.FirstName, link, int(passwordResetTTL.Minutes())),
+	})
+}
+
+func (h *Handler) sendPasswordResetFor(email string) {
+	var user models.User
+	if err := h.DB.First(&user, "email = ?", email).Error; err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+	defer cancel()
+	if err := h.sendPasswordResetEmail(ctx, &user); err != nil {
+		log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+	}
+}
+
+func (h *Handler) frontendLink(path, token string) string {
+	return h.frontendBase() + path + "?token=" + url.QueryEscape(token)
+}
+
+func (h *Handler) frontendBase() string {
+	base := h.cfg.FRONTEND_URL
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+// creates a single use token, older unused tokens for the same purpose stop working
+func createUserToken(db *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	raw, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	return raw, err
+}
+
+func consumeUserToken(tx *gorm.DB, raw, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := tx.First(&token, "token_hash = ? AND purpose = ?", auth.HashToken(raw), purpose).Error; err != nil {
+		return nil, errInvalidUserToken
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, errInvalidUserToken
+	}
+	// conditional update so two concurrent requests can't both use the token
+	res := tx.Model(&models.UserToken{}).Where("id = ? AND used_at IS NULL", token.ID).Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errInvalidUserToken
+	}
+	return &token, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/auth"
+	"geekCode/internal/config"
+	"geekCode/internal/mailer"
+	"geekCode/internal/models"
+	"geekCode/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestConfirmPasswordResetEndsEverySession(t *testing.T) {
+	h := &Handler{
+		DB:  newTestDB(t, &models.User{}, &models.UserToken{}, &models.APIToken{}, &models.RefreshToken{}),
+		cfg: &config.Config{},
+	}
+	r := gin.New()
+	r.POST("/api/auth/password-reset/confirm", h.ConfirmPasswordReset)
+
+	user := models.User{FirstName: "Ada", LastName: "L", Username: "ada", Email: "ada@example.com", Password: "old"}
+	h.DB.Create(&user)
+	other := models.User{FirstName: "Bob", LastName: "B", Username: "bob", Email: "bob@example.com", Password: "old"}
+	h.DB.Create(&other)
+
+	_, apiHash, _ := auth.GenerateAPIToken()
+	h.DB.Create(&models.APIToken{UserID: user.ID, Name: "ci", Prefix: "gkc_", TokenHash: apiHash, Scopes: []string{}, ExpiresAt: time.Now().Add(time.Hour)})
+	_, otherHash, _ := auth.GenerateAPIToken()
+	h.DB.Create(&models.APIToken{UserID: other.ID, Name: "ci", Prefix: "gkc_", TokenHash: otherHash, Scopes: []string{}, ExpiresAt: time.Now().Add(time.Hour)})
+	_, ticketHash, _ := auth.GenerateOpaqueToken()
+	h.DB.Create(&models.UserToken{UserID: user.ID, Purpose: models.TokenPurposeWebSocket, TokenHash: ticketHash, ExpiresAt: time.Now().Add(time.Minute)})
+	_, refreshHash, _ := auth.GenerateOpaqueToken()
+	h.DB.Create(&models.RefreshToken{UserID: user.ID, TokenHash: refreshHash, ExpiresAt: time.Now().Add(time.Hour)})
+
+	raw, err := createUserToken(h.DB, user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/password-reset/confirm", strings.NewReader(`{"token":"`+raw+`","password":"new-password"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset: %d %s", w.Code, w.Body.String())
+	}
+
+	var reloaded models.User
+	h.DB.First(&reloaded, user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(reloaded.Password), []byte("new-password")) != nil {
+		t.Error("password not changed")
+	}
+	if reloaded.TokensValidAfter == nil {
+		t.Error("access tokens issued before the reset still valid")
+	}
+	var count int64
+	if h.DB.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&count); count != 0 {
+		t.Errorf("%d api tokens survived the reset", count)
+	}
+	if h.DB.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", other.ID).Count(&count); count != 1 {
+		t.Error("another user's api token was revoked")
+	}
+	if h.DB.Model(&models.UserToken{}).Where("purpose = ? AND used_at IS NULL", models.TokenPurposeWebSocket).Count(&count); count != 0 {
+		t.Error("websocket ticket survived the reset")
+	}
+	if activeRefreshTokens(h, user.ID) != 0 {
+		t.Error("refresh token survived the reset")
+	}
+
+	// the link only works once
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/password-reset/confirm", strings.NewReader(`{"token":"`+raw+`","password":"another-one"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("second use of the reset link: %d", w.Code)
+	}
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.UserToken{})
+	// the mail goes out from another goroutine, it has to see the same in-memory database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	mails := &mailer.LogMailer{}
+	h := &Handler{DB: db, cfg: &config.Config{}, mailer: mails, resetGuard: services.NewPasswordResetGuard()}
+	r := gin.New()
+	r.POST("/api/auth/password-reset", h.RequestPasswordReset)
+	db.Create(&models.User{FirstName: "Ada", LastName: "L", Username: "ada", Email: "ada@example.com", Password: "x"})
+
+	request := func(email, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/password-reset", strings.NewReader(`{"email":"`+email+`"}`))
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	known := request("ada@example.com", "10.0.0.1")
+	unknown := request("nobody@example.com", "10.0.0.1")
+	if known.Code != http.StatusAccepted || unknown.Code != known.Code || unknown.Body.String() != known.Body.String() {
+		t.Fatalf("answers differ: %d %s / %d %s", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	msg, sent := mails.Last()
+	for !sent && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		msg, sent = mails.Last()
+	}
+	if !sent || msg.To != "ada@example.com" {
+		t.Fatalf("reset mail: %+v, sent %v", msg, sent)
+	}
+
+	// a few more requests for the same address pass, then it has to wait, from any ip
+	for i := 0; i < 3; i++ {
+		request("ada@example.com", "10.0.0.2")
+	}
+	w := request("ada@example.com", "10.0.0.3")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("request over the email limit: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// and the ip that sprayed addresses has to wait too
+	for i := 0; i < 11; i++ {
+		request(fmt.Sprintf("user%d@example.com", i), "10.0.0.4")
+	}
+	if w := request("last@example.com", "10.0.0.4"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request over the ip limit: %d", w.Code)
+	}
+	if w := request("fresh@example.com", "10.0.0.5"); w.Code != http.StatusAccepted {
+		t.Errorf("another ip and email: %d", w.Code)
+	}
+}
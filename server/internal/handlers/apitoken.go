@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"geekCode/internal/auth"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAPITokenDays = 90
+	maxAPITokenDays     = 365
+	maxAPITokensPerUser = 50
+)
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays"` // defaults to 90, at most 365
+}
+
+// lists the user's tokens, the secrets themselves are never shown again
+func (h *Handler) ListAPITokens(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+
+	var tokens []models.APIToken
+	if err := h.DB.Where("user_id = ?", userId).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+func (h *Handler) CreateAPIToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !rbac.Permission(scope).Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope})
+			return
+		}
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAPITokenDays
+	}
+	if days < 0 || days > maxAPITokenDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresInDays must be between 1 and 365"})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+	var active int64
+	h.DB.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userId, time.Now()).Count(&active)
+	if active >= maxAPITokensPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many active tokens, revoke one first"})
+		return
+	}
+
+	raw, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	token := models.APIToken{
+		UserID:    userId,
+		Name:      req.Name,
+		Prefix:    raw[:len(auth.APITokenPrefix)+6],
+		TokenHash: hash,
+		Scopes:    req.Scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}
+	if err := h.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	// the only time the raw token is returned
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "apiToken": token})
+}
+
+func (h *Handler) RevokeAPIToken(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	tokenID, ok := uintParam(c, "tokenId")
+	if !ok {
+		return
+	}
+
+	res := h.DB.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userId).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"geekCode/internal/assistant"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AssistantRequest struct {
+	Question string              `json:"question" binding:"required,max=4000"`
+	History  []assistant.Message `json:"history" binding:"max=20"` // earlier turns, oldest first
+	FileName string              `json:"fileName"`                 // the file the user is looking at
+}
+
+// AskAssistant answers a question about the room's code as server sent events:
+// "chunk" events with {"text"} while the answer streams, then "done" or "error"
+func (h *Handler) AskAssistant(c *gin.Context) {
+	var req AssistantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	room := c.MustGet("room").(*models.Room)
+	roles := c.MustGet("roles").([]rbac.Role)
+
+	roomContext, err := h.assistantContext(room, req.FileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load the room"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // nginx would otherwise hold the events back
+	err = h.assistant.Ask(c.Request.Context(), assistant.Request{
+		UserID: c.MustGet("userId").(uint),
+		Room:   room,
+		Roles:  roles,
+		Prompt: assistant.BuildPrompt(roomContext, req.History, req.Question),
+	}, func(text string) error {
+		c.SSEvent("chunk", gin.H{"text": text})
+		c.Writer.Flush()
+		return c.Request.Context().Err()
+	})
+	if err == nil {
+		c.SSEvent("done", gin.H{})
+		return
+	}
+	// the status is already sent once streaming started, later errors become an event
+	if c.Writer.Written() {
+		c.SSEvent("error", gin.H{"error": "the assistant failed to answer"})
+		return
+	}
+
+	var quotaErr *assistant.QuotaError
+	switch {
+	case errors.Is(err, assistant.ErrDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, assistant.ErrRoomPolicy), errors.Is(err, assistant.ErrRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.As(err, &quotaErr):
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(quotaErr.ResetAt).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "resetAt": quotaErr.ResetAt})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "the assistant failed to answer"})
+	}
+}
+
+// the caller's usage in the current window next to their limits
+func (h *Handler) AssistantUsage(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	meter := h.assistant.Meter()
+	totals, err := meter.UserTotals(userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch usage"})
+		return
+	}
+	limits := meter.Limits()
+	c.JSON(http.StatusOK, gin.H{
+		"usage":  totals,
+		"limits": gin.H{"requests": limits.UserRequests, "tokens": limits.UserTokens},
+		"window": limits.Window.String(),
+	})
+}
+
+// the org's usage in the current window, per member, for org admins
+func (h *Handler) OrgAssistantUsage(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+	meter := h.assistant.Meter()
+	totals, err := meter.OrgTotals(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch usage"})
+		return
+	}
+	users, err := meter.OrgUsers(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch usage"})
+		return
+	}
+	limits := meter.Limits()
+	c.JSON(http.StatusOK, gin.H{
+		"usage":  totals,
+		"users":  users,
+		"limits": gin.H{"requests": limits.OrgRequests, "tokens": limits.OrgTokens},
+		"window": limits.Window.String(),
+	})
+}
+
+// the live document when the room is open, the stored starter files otherwise
+func (h *Handler) assistantContext(room *models.Room, activeFile string) (assistant.RoomContext, error) {
+	var problems []models.Problem
+	if err := h.DB.Model(room).Association("Problems").Find(&problems); err != nil {
+		return assistant.RoomContext{}, err
+	}
+	files := h.hub.Files(room.RoomID)
+	if len(files) == 0 {
+		files = room.Files
+	}
+	language := room.Language
+	if live := h.hub.Snapshots(room.RoomID)[room.RoomID]; live.Language != "" {
+		language = live.Language
+	}
+	return assistant.RoomContext{
+		Language:   language,
+		Files:      files,
+		ActiveFile: activeFile,
+		Problems:   problems,
+	}, nil
+}
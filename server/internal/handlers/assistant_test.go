@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/assistant"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testHub is a hub with a live document and nobody connected
+type testHub struct {
+	files  []models.CodeFile
+	closed []string // rooms the handlers closed, in order
+}
+
+func (hub *testHub) CloseRoom(roomId, reason string) {
+	hub.closed = append(hub.closed, roomId)
+}
+
+func (hub *testHub) Snapshots(roomIds ...string) map[string]models.LiveRoom {
+	return map[string]models.LiveRoom{}
+}
+
+func (hub *testHub) Files(roomId string) []models.CodeFile {
+	return hub.files
+}
+
+func (hub *testHub) Submission(roomId string) *models.Submission {
+	return nil
+}
+
+func (hub *testHub) FormatFile(ctx context.Context, roomId, user, fileName string) (models.CodeFile, error) {
+	return models.CodeFile{}, errors.New("not supported")
+}
+
+func assistantTestRouter(t *testing.T, fake *assistant.FakeProvider, limits assistant.Limits, roles ...rbac.Role) (*gin.Engine, *Handler) {
+	t.Helper()
+	db := newTestDB(t, &models.Room{}, &models.Problem{}, &models.AssistantUsage{})
+	room := &models.Room{RoomID: "room-1", Name: "interview", Language: "go", CreatedBy: 1}
+	if err := db.Create(room).Error; err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{
+		DB:        db,
+		hub:       &testHub{files: []models.CodeFile{{Name: "main.go", Language: "go", Content: "func twoSum() {}"}}},
+		assistant: assistant.NewService(fake, assistant.NewMeter(db, limits)),
+	}
+	r := gin.New()
+	r.POST("/rooms/:roomId/assistant", func(c *gin.Context) {
+		c.Set("userId", uint(1))
+		c.Set("room", room)
+		c.Set("roles", roles)
+	}, h.AskAssistant)
+	return r, h
+}
+
+func ask(r *gin.Engine, req AssistantRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rooms/room-1/assistant", bytes.NewReader(body)))
+	return w
+}
+
+func TestAskAssistantStreams(t *testing.T) {
+	fake := &assistant.FakeProvider{Reply: "use a hash map"}
+	r, h := assistantTestRouter(t, fake, assistant.Limits{Window: time.Hour}, rbac.RoleOwner)
+
+	w := ask(r, AssistantRequest{
+		Question: "how do I make it faster?",
+		History:  []assistant.Message{{Role: assistant.RoleUser, Content: "what does it do?"}, {Role: assistant.RoleAssistant, Content: "it sums"}},
+		FileName: "main.go",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if n := strings.Count(body, "event:chunk"); n != 4 {
+		t.Errorf("got %d chunks, want one per word: %s", n, body)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(body), "event:done\ndata:{}") {
+		t.Errorf("stream doesn't end with done: %s", body)
+	}
+
+	prompts := fake.Prompts()
+	if len(prompts) != 1 {
+		t.Fatalf("provider was asked %d times", len(prompts))
+	}
+	if !strings.Contains(prompts[0].System, "func twoSum() {}") {
+		t.Error("the live document isn't in the prompt")
+	}
+	messages := prompts[0].Messages
+	if len(messages) != 3 || messages[2].Content != "how do I make it faster?" {
+		t.Errorf("unexpected conversation %v", messages)
+	}
+
+	var usage models.AssistantUsage
+	if err := h.DB.First(&usage).Error; err != nil {
+		t.Fatal(err)
+	}
+	if usage.Failed || usage.CompletionTokens == 0 || usage.Provider != "fake" {
+		t.Errorf("usage recorded as %+v", usage)
+	}
+}
+
+func TestAskAssistantRefusals(t *testing.T) {
+	t.Run("role", func(t *testing.T) {
+		r, _ := assistantTestRouter(t, &assistant.FakeProvider{}, assistant.Limits{Window: time.Hour}, rbac.RoleCandidate)
+		if w := ask(r, AssistantRequest{Question: "answer?"}); w.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", w.Code)
+		}
+	})
+	t.Run("quota", func(t *testing.T) {
+		fake := &assistant.FakeProvider{}
+		r, _ := assistantTestRouter(t, fake, assistant.Limits{Window: time.Hour, UserRequests: 1}, rbac.RoleOwner)
+		if w := ask(r, AssistantRequest{Question: "first"}); w.Code != http.StatusOK {
+			t.Fatalf("first question got %d", w.Code)
+		}
+		w := ask(r, AssistantRequest{Question: "second"})
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("got %d with Retry-After %q, want 429", w.Code, w.Header().Get("Retry-After"))
+		}
+		if n := len(fake.Prompts()); n != 1 {
+			t.Errorf("provider was asked %d times, want 1", n)
+		}
+	})
+	t.Run("too much history", func(t *testing.T) {
+		r, _ := assistantTestRouter(t, &assistant.FakeProvider{}, assistant.Limits{Window: time.Hour}, rbac.RoleOwner)
+		history := make([]assistant.Message, 21)
+		if w := ask(r, AssistantRequest{Question: "answer?", History: history}); w.Code != http.StatusBadRequest {
+			t.Fatalf("got %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestAskAssistantProviderFailsMidStream(t *testing.T) {
+	fake := &assistant.FakeProvider{Reply: "half an", Err: errors.New("connection reset")}
+	r, h := assistantTestRouter(t, fake, assistant.Limits{Window: time.Hour}, rbac.RoleOwner)
+
+	w := ask(r, AssistantRequest{Question: "answer?"})
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "event:chunk") || !strings.Contains(body, "event:error") {
+		t.Fatalf("got %d: %s", w.Code, body)
+	}
+	if strings.Contains(body, "connection reset") {
+		t.Error("provider error leaked to the client")
+	}
+	var usage models.AssistantUsage
+	if err := h.DB.First(&usage).Error; err != nil || !usage.Failed {
+		t.Errorf("usage recorded as %+v (%v), want failed", usage, err)
+	}
+}
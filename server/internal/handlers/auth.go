@@ -1,19 +1,31 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"geekCode/internal/auth"
 	"geekCode/internal/models"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	// "geekCode/internal/config"
 )
 
 //authHandler
 //login
 
+var errRefreshTokenUsed = errors.New("refresh token already used")
+
+//how long a rotated refresh token still counts as a parallel refresh rather than a stolen one
+const refreshReuseGrace = 10 * time.Second
+
 type LoginRequest struct {
 	Email string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
@@ -27,6 +39,44 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"` //the tags must never have space after binding
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+	All bool `json:"all"` // revoke every refresh token of the user (logout everywhere)
+}
+
+//issues a new access token + refresh token pair, the refresh token is stored hashed
+func (h *Handler) issueTokens(tx *gorm.DB, userID uint) (string, *models.RefreshToken, string, error) {
+	accessToken, _, err := auth.GenerateToken(userID, h.cfg.AccessTokenTTL)
+	if err != nil {
+		return "", nil, "", err
+	}
+	rawRefresh, refreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return "", nil, "", err
+	}
+	refresh := &models.RefreshToken{
+		UserID: userID,
+		TokenHash: refreshHash,
+		ExpiresAt: time.Now().Add(h.cfg.RefreshTokenTTL),
+	}
+	if err := tx.Create(refresh).Error; err != nil {
+		return "", nil, "", err
+	}
+	return accessToken, refresh, rawRefresh, nil
+}
+
+func (h *Handler) tokenResponse(accessToken, refreshToken string) gin.H {
+	return gin.H{
+		"token": accessToken,
+		"refreshToken": refreshToken,
+		"expiresIn": int(h.cfg.AccessTokenTTL.Seconds()),
+	}
+}
+
 
 func (h *Handler) Login (c *gin.Context) {
 	// cfg := config.LoadConfig() 
@@ -37,8 +87,19 @@ func (h *Handler) Login (c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error" : err.Error()})
 		return 
 	}
+
+	//throttled before touching bcrypt, that's the expensive part attackers want to hammer
+	ip := c.ClientIP()
+	if wait := h.loginGuard.RetryAfter(ip, req.Email); wait > 0 {
+		h.auditLoginFailure(c, req.Email, nil, "throttled")
+		abortTooManyAttempts(c, wait, "too many login attempts, try again later")
+		return
+	}
+
 	var user models.User
 	if err := h.DB.First(&user, "email = ?", req.Email).Error; err != nil {
+		h.loginGuard.Failure(ip, req.Email)
+		h.auditLoginFailure(c, req.Email, nil, "unknown_email")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "invalid email or password"})
 		return
 	}
@@ -46,20 +107,39 @@ func (h *Handler) Login (c *gin.Context) {
 	//checking password
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) ; err != nil {
+		h.loginGuard.Failure(ip, req.Email)
+		h.auditLoginFailure(c, req.Email, &user.ID, "invalid_password")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID, h.cfg.JWTSecret)
+	if h.cfg.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email address not verified"})
+		return
+	}
+
+	//with 2fa on, the jwt is only issued by the second step (LoginTwoFactor)
+	if challenge, required, err := h.mfaChallenge(&user); required {
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to start two factor login"})
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	//the failure count is only reset once the login is fully done, otherwise a known password
+	//would reset the counter between otp guesses
+	h.loginGuard.Success(req.Email)
+
+	token, _, refreshToken, err := h.issueTokens(h.DB, user.ID)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error"  : "failed to create tokebn"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token" : token,
-		"user": user,
-	})
+	resp := h.tokenResponse(token, refreshToken)
+	resp["user"] = user
+	c.JSON(http.StatusOK, resp)
 }
 
 //register
@@ -98,14 +178,165 @@ func (h *Handler) Register(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
 		return
 	}
-	token, err := auth.GenerateToken(user.ID, h.cfg.JWTSecret);
+
+	//the account exists even if the mail fails, the user can ask for another one
+	if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+		fmt.Printf("Failed to send verification email to user ID %d: %v\n", user.ID, err)
+	}
+	if h.cfg.RequireEmailVerification {
+		c.JSON(http.StatusCreated, gin.H{"message": "user created successfully, check your email to verify your account", "user": user})
+		return
+	}
+	token, _, refreshToken, err := h.issueTokens(h.DB, user.ID);
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
 		return
 	}
 
 
-	c.JSON(http.StatusCreated, gin.H{"message": "user created successfully", "user": user,"token" : token})
+	resp := h.tokenResponse(token, refreshToken)
+	resp["message"] = "user created successfully"
+	resp["user"] = user
+	c.JSON(http.StatusCreated, resp)
+}
+
+//refresh (rotates the refresh token, the old one can't be used again)
+func (h *Handler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := h.DB.First(&stored, "token_hash = ?", auth.HashToken(req.RefreshToken)).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "refresh token expired"})
+		return
+	}
+	if stored.RevokedAt != nil {
+		h.refreshRace(c, &stored)
+		return
+	}
+
+	var token, refreshToken string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var replacement *models.RefreshToken
+		var err error
+		token, replacement, refreshToken, err = h.issueTokens(tx, stored.UserID)
+		if err != nil {
+			return err
+		}
+		//only one concurrent refresh can win the rotation
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", stored.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": replacement.ID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshTokenUsed
+		}
+		return nil
+	})
+	if err == errRefreshTokenUsed {
+		//the parallel refresh that won has revoked it by now
+		if err := h.DB.First(&stored, stored.ID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+			return
+		}
+		h.refreshRace(c, &stored)
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.tokenResponse(token, refreshToken))
+}
+
+//a revoked token being used again means it leaked, so we kill every session of that user.
+//right after a rotation it is more likely a second tab or request that refreshed at the same time,
+//that one gets tokens of its own (the winner's replacement can't be handed out, only its hash is kept).
+//it only works once per token and only while the replacement is still good, a token revoked by
+//logout or a password reset stays revoked
+func (h *Handler) refreshRace(c *gin.Context, stored *models.RefreshToken) {
+	if !h.refreshGraceAllowed(stored) {
+		log.Printf("Refresh token reuse detected for user ID: %d", stored.UserID)
+		h.revokeAllRefreshTokens(stored.UserID)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "refresh token has been revoked"})
+		return
+	}
+	token, _, refreshToken, err := h.issueTokens(h.DB, stored.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+	c.JSON(http.StatusOK, h.tokenResponse(token, refreshToken))
+}
+
+func (h *Handler) refreshGraceAllowed(stored *models.RefreshToken) bool {
+	if stored.ReplacedByID == nil || stored.RevokedAt == nil || time.Since(*stored.RevokedAt) > refreshReuseGrace {
+		return false
+	}
+	var replacement models.RefreshToken
+	if err := h.DB.First(&replacement, *stored.ReplacedByID).Error; err != nil {
+		return false
+	}
+	if replacement.RevokedAt != nil || time.Now().After(replacement.ExpiresAt) {
+		return false
+	}
+	//only one parallel refresh gets through, the next one is reuse
+	res := h.DB.Model(&models.RefreshToken{}).Where("id = ? AND grace_used = ?", stored.ID, false).Update("grace_used", true)
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+//logout revokes the current access token and the given refresh token
+func (h *Handler) Logout(c *gin.Context) {
+	var req LogoutRequest
+	//the body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userId := c.MustGet("userId").(uint)
+	tokenId := c.GetString("tokenId")
+	expiresAt := c.GetTime("tokenExpiresAt")
+
+	//parallel logouts with the same token both get here, the jti only needs to be on the list once
+	if err := h.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{JTI: tokenId, UserID: userId, ExpiresAt: expiresAt}).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		return
+	}
+
+	if req.All {
+		h.revokeAllRefreshTokens(userId)
+	} else if req.RefreshToken != "" {
+		h.DB.Model(&models.RefreshToken{}).
+			Where("token_hash = ? AND user_id = ? AND revoked_at IS NULL", auth.HashToken(req.RefreshToken), userId).
+			Update("revoked_at", time.Now())
+	}
+
+	//revoked access tokens are useless once they expire anyway
+	h.DB.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+func (h *Handler) revokeAllRefreshTokens(userID uint) {
+	if err := h.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		log.Printf("Failed to revoke refresh tokens for user ID %d: %v", userID, err)
+	}
 }
 
 //profile (getMe in js)
@@ -136,4 +367,24 @@ func(h *Handler) GetProfile(c *gin.Context) {
 			"updatedAt": currentUser.UpdatedAt,
 		},
 	})
-}
\ No newline at end of file
+}
+
+//failed logins are kept for audits, a failing insert must not break the login itself
+func (h *Handler) auditLoginFailure(c *gin.Context, email string, userID *uint, reason string) {
+	entry := models.LoginAudit{
+		UserID: userID,
+		Email: email,
+		IP: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason: reason,
+	}
+	if err := h.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record login audit for %s: %v", email, err)
+	}
+}
+
+func abortTooManyAttempts(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message, "retryAfter": seconds})
+}
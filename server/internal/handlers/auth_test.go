@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"geekCode/internal/config"
+	"geekCode/internal/models"
+	"geekCode/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func refreshTestRouter(t *testing.T) (*gin.Engine, *Handler) {
+	t.Helper()
+	initTestKeys(t)
+	h := &Handler{
+		DB:  newTestDB(t, &models.RefreshToken{}),
+		cfg: &config.Config{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+	}
+	r := gin.New()
+	r.POST("/api/auth/refresh", h.Refresh)
+	return r, h
+}
+
+func refresh(r *gin.Engine, refreshToken string) (int, string) {
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: refreshToken})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/refresh", bytes.NewReader(body)))
+	var resp struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.RefreshToken
+}
+
+func activeRefreshTokens(h *Handler, userID uint) int64 {
+	var count int64
+	h.DB.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count)
+	return count
+}
+
+func TestRefreshRotation(t *testing.T) {
+	r, h := refreshTestRouter(t)
+	_, _, first, err := h.issueTokens(h.DB, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, second := refresh(r, first)
+	if code != http.StatusOK || second == "" || second == first {
+		t.Fatalf("refresh returned %d, %q", code, second)
+	}
+	if n := activeRefreshTokens(h, 1); n != 1 {
+		t.Errorf("%d active refresh tokens after a rotation, want 1", n)
+	}
+
+	// a parallel request with the same token, right after the rotation, still gets tokens
+	code, parallel := refresh(r, first)
+	if code != http.StatusOK || parallel == "" {
+		t.Fatalf("parallel refresh returned %d", code)
+	}
+	if code, _ := refresh(r, second); code != http.StatusOK {
+		t.Errorf("the rotated token stopped working after a parallel refresh: %d", code)
+	}
+}
+
+func TestRefreshGraceOnlyOnce(t *testing.T) {
+	r, h := refreshTestRouter(t)
+	_, _, first, _ := h.issueTokens(h.DB, 1)
+	if code, _ := refresh(r, first); code != http.StatusOK {
+		t.Fatalf("refresh returned %d", code)
+	}
+	if code, _ := refresh(r, first); code != http.StatusOK {
+		t.Fatalf("parallel refresh returned %d", code)
+	}
+	// a third use is no longer a parallel tab, whoever has the token can't keep minting sessions
+	if code, _ := refresh(r, first); code != http.StatusUnauthorized {
+		t.Fatalf("third use returned %d, want 401", code)
+	}
+	if n := activeRefreshTokens(h, 1); n != 0 {
+		t.Errorf("%d refresh tokens still active after reuse, want 0", n)
+	}
+}
+
+func TestRefreshGraceNeedsAGoodReplacement(t *testing.T) {
+	tests := []struct {
+		name  string
+		spoil func(db *gorm.DB)
+	}{
+		{"logged out everywhere", func(db *gorm.DB) {
+			db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Update("revoked_at", time.Now())
+		}},
+		{"replacement expired", func(db *gorm.DB) {
+			db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Update("expires_at", time.Now().Add(-time.Second))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, h := refreshTestRouter(t)
+			_, _, first, _ := h.issueTokens(h.DB, 1)
+			if code, _ := refresh(r, first); code != http.StatusOK {
+				t.Fatalf("refresh returned %d", code)
+			}
+			tt.spoil(h.DB)
+			if code, _ := refresh(r, first); code != http.StatusUnauthorized {
+				t.Fatalf("old token returned %d, want 401", code)
+			}
+		})
+	}
+}
+
+func TestRefreshReuseRevokesEverything(t *testing.T) {
+	r, h := refreshTestRouter(t)
+	_, _, first, _ := h.issueTokens(h.DB, 1)
+	_, _, otherDevice, _ := h.issueTokens(h.DB, 1)
+	_, second := refresh(r, first)
+
+	// long after the rotation, the old token coming back means it leaked
+	h.DB.Model(&models.RefreshToken{}).Where("revoked_at IS NOT NULL").Update("revoked_at", time.Now().Add(-time.Minute))
+	if code, _ := refresh(r, first); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token returned %d, want 401", code)
+	}
+	if n := activeRefreshTokens(h, 1); n != 0 {
+		t.Errorf("%d refresh tokens still active after reuse, want 0", n)
+	}
+	for _, token := range []string{second, otherDevice} {
+		if code, _ := refresh(r, token); code != http.StatusUnauthorized {
+			t.Errorf("refresh after reuse returned %d, want 401", code)
+		}
+	}
+}
+
+func TestRefreshInvalid(t *testing.T) {
+	r, h := refreshTestRouter(t)
+	if code, _ := refresh(r, "unknown"); code != http.StatusUnauthorized {
+		t.Errorf("unknown token returned %d, want 401", code)
+	}
+	_, stored, expired, _ := h.issueTokens(h.DB, 1)
+	h.DB.Model(stored).Update("expires_at", time.Now().Add(-time.Second))
+	if code, _ := refresh(r, expired); code != http.StatusUnauthorized {
+		t.Errorf("expired token returned %d, want 401", code)
+	}
+}
+
+func TestLogoutTwice(t *testing.T) {
+	h := &Handler{DB: newTestDB(t, &models.RevokedToken{}, &models.RefreshToken{})}
+	r := gin.New()
+	r.POST("/api/auth/logout", func(c *gin.Context) {
+		c.Set("userId", uint(1))
+		c.Set("tokenId", "jti-1")
+		c.Set("tokenExpiresAt", time.Now().Add(time.Minute))
+	}, h.Logout)
+
+	// two tabs logging out at the same time send the same access token
+	for i := range 2 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("logout %d got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	var revoked int64
+	h.DB.Model(&models.RevokedToken{}).Where("jti = ?", "jti-1").Count(&revoked)
+	if revoked != 1 {
+		t.Errorf("%d revoked entries for the token, want 1", revoked)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	initTestKeys(t)
+	h := &Handler{
+		DB:         newTestDB(t, &models.User{}, &models.RefreshToken{}, &models.LoginAudit{}),
+		cfg:        &config.Config{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+		loginGuard: services.NewLoginGuard(4, time.Minute),
+	}
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("right-password"), bcrypt.MinCost)
+	h.DB.Create(&models.User{FirstName: "Ada", LastName: "L", Username: "ada", Email: "ada@example.com", Password: string(hashed)})
+	r := gin.New()
+	r.POST("/api/auth/login", h.Login)
+	// every attempt from another ip, the ip limits would kick in first otherwise
+	attempts := 0
+	login := func(password string) *httptest.ResponseRecorder {
+		attempts++
+		body, _ := json.Marshal(LoginRequest{Email: "ada@example.com", Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewReader(body))
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", attempts)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := login("wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: %d", i+1, w.Code)
+		}
+	}
+	// a successful login forgets the failures, so three more don't lock the account
+	if w := login("right-password"); w.Code != http.StatusOK {
+		t.Fatalf("right password: %d %s", w.Code, w.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		if w := login("wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password after the reset %d: %d", i+1, w.Code)
+		}
+	}
+
+	// the fourth in a row locks it, the right password has to wait too
+	login("wrong")
+	w := login("right-password")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("locked account: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"geekCode/internal/formatter"
+	"geekCode/internal/models"
+	"geekCode/internal/ws"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FormatRequest struct {
+	FileName string `json:"fileName"` // may be left out when the room has a single file
+}
+
+// formats a file of the live document, everybody in the room gets the result as one edit
+func (h *Handler) FormatRoomFile(c *gin.Context) {
+	var req FormatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	room := c.MustGet("room").(*models.Room)
+	if room.Status != models.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "only active rooms can be formatted"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.Select("id", "username").First(&user, c.MustGet("userId").(uint)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+
+	file, err := h.hub.FormatFile(c.Request.Context(), room.RoomID, user.Username, req.FileName)
+	var syntaxErr *formatter.SyntaxError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"file": file})
+	case errors.Is(err, ws.ErrNoFile):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ws.ErrFileChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, formatter.ErrUnsupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "languages": h.formatter.Languages()})
+	case errors.Is(err, formatter.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.As(err, &syntaxErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Formatting %s in room %s failed: %v", req.FileName, room.RoomID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "formatting failed"})
+	}
+}
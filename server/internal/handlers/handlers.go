@@ -1,7 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"geekCode/internal/assistant"
 	"geekCode/internal/config"
+	"geekCode/internal/formatter"
+	"geekCode/internal/languages"
+	"geekCode/internal/mailer"
+	"geekCode/internal/models"
+	"geekCode/internal/oidc"
+	"geekCode/internal/rbac"
+	"geekCode/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -10,13 +19,56 @@ import (
 type Handler struct {
 	DB *gorm.DB
 	cfg *config.Config
+	oidcProviders map[string]*oidc.Provider
+	mailer mailer.Mailer
+	loginGuard *services.LoginGuard
+	resetGuard *services.PasswordResetGuard
+	rbac *rbac.Engine
+	hub RoomHub
+	window services.JoinWindow
+	assistant *assistant.Service
+	formatter *formatter.Registry
+	languages *languages.Registry
+}
+
+// the parts of the websocket hub the handlers need
+type RoomHub interface {
+	CloseRoom(roomId, reason string)
+	Snapshots(roomIds ...string) map[string]models.LiveRoom
+	Files(roomId string) []models.CodeFile
+	Submission(roomId string) *models.Submission
+	FormatFile(ctx context.Context, roomId, user, fileName string) (models.CodeFile, error)
 }
 
 func Ping(c *gin.Context) {
 	c.JSON(200, gin.H{"message" : "pong"})
 }
 
-func NewHandler(db *gorm.DB, cfg *config.Config) *Handler{
-	return &Handler{DB: db, cfg: cfg}
+func NewHandler(db *gorm.DB, cfg *config.Config, engine *rbac.Engine, hub RoomHub, assistantService *assistant.Service, formatters *formatter.Registry, runtimes *languages.Registry) *Handler{
+	providers := make(map[string]*oidc.Provider)
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Name: p.Name,
+			Issuer: p.Issuer,
+			ClientID: p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL: p.RedirectURL,
+			Scopes: p.Scopes,
+		}, nil)
+	}
+	return &Handler{
+		DB: db,
+		cfg: cfg,
+		oidcProviders: providers,
+		mailer: mailer.New(cfg),
+		loginGuard: services.NewLoginGuard(cfg.LoginMaxAttempts, cfg.LoginLockout),
+		resetGuard: services.NewPasswordResetGuard(),
+		rbac: engine,
+		hub: hub,
+		window: services.NewJoinWindow(cfg),
+		assistant: assistantService,
+		formatter: formatters,
+		languages: runtimes,
+	}
 }
 
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"geekCode/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB is an in-memory database with the tables of the given models
+func newTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func initTestKeys(t *testing.T) {
+	t.Helper()
+	if _, err := auth.Init(auth.KeyConfig{Algorithm: "HS256", Secret: "test-secret", Issuer: "geekcode-test"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"geekCode/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the proctoring timeline of a room, oldest first, with counts per participant and kind.
+// ?userId= narrows it to one participant
+func (h *Handler) ListIntegrityEvents(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+
+	query := h.DB.Where("room_id = ?", room.RoomID)
+	if raw := c.Query("userId"); raw != "" {
+		userId, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		query = query.Where("user_id = ?", userId)
+	}
+
+	events := []models.IntegrityEvent{}
+	if err := query.Order("created_at, id").Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch integrity events"})
+		return
+	}
+
+	type participant struct {
+		UserID uint                         `json:"userId"`
+		User   string                       `json:"user"`
+		Counts map[models.IntegrityKind]int `json:"counts"`
+	}
+	participants := []*participant{}
+	byUser := map[uint]*participant{}
+	for _, event := range events {
+		p := byUser[event.UserID]
+		if p == nil {
+			p = &participant{UserID: event.UserID, User: event.User, Counts: map[models.IntegrityKind]int{}}
+			byUser[event.UserID] = p
+			participants = append(participants, p)
+		}
+		p.Counts[event.Kind]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events, "participants": participants})
+}
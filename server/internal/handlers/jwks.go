@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"geekCode/internal/auth"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jwks endpoint, other services fetch this to verify our tokens without the secret
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.JWKS())
+}
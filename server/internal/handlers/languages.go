@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the runtimes from the registry, and whether runs happen on the server or in the browser
+func (h *Handler) ListLanguages(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"languages":       h.languages.List(),
+		"serverExecution": h.cfg.ExecEnabled,
+	})
+}
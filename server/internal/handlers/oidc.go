@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"geekCode/internal/models"
+	"geekCode/internal/oidc"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const oauthStateTTL = 10 * time.Minute
+
+// the state also goes into a cookie, so a callback only completes in the browser that started the login
+const (
+	oauthStateCookie     = "oidc_state"
+	oauthStateCookiePath = "/api/auth/oidc"
+)
+
+var errUnverifiedAccount = errors.New("an account with this email exists but was never verified, log in with its password and verify the email first")
+
+var usernameCleaner = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// lists the configured identity providers so the login page can render buttons
+func (h *Handler) ListOIDCProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.oidcProviders))
+	for name := range h.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// starts the authorization code + pkce flow and redirects to the provider
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	provider, found := h.oidcProviders[c.Param("provider")]
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return
+	}
+
+	state, err1 := oidc.RandomString(24)
+	nonce, err2 := oidc.RandomString(24)
+	verifier, challenge, err3 := oidc.NewPKCE()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	pending := models.OAuthState{
+		State:        state,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	}
+	if err := h.DB.Create(&pending).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("OIDC login for %s failed: %v", provider.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+
+	// lax still sends it on the provider's top level redirect back to us.
+	// spa clients using mode=json have to make this request with credentials
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, state, int(oauthStateTTL.Seconds()), oauthStateCookiePath, "", h.secureCookies(c), true)
+
+	// spa clients can ask for the url instead of following a redirect
+	if c.Query("mode") == "json" {
+		c.JSON(http.StatusOK, gin.H{"url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// the provider redirects back here with the code, we verify everything and log the user in
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	provider, found := h.oidcProviders[c.Param("provider")]
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return
+	}
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login was not completed: " + errCode})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing code or state"})
+		return
+	}
+	// without this anybody could send a victim a callback link for the attacker's own login
+	cookie, err := c.Cookie(oauthStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login was started in another browser"})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, "", -1, oauthStateCookiePath, "", h.secureCookies(c), true)
+
+	// the state is single use, deleting it (returning the row) up front stops replays
+	var pending models.OAuthState
+	res := h.DB.Clauses(clause.Returning{}).Where("state = ? AND provider = ?", state, provider.Name()).Delete(&pending)
+	h.DB.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{})
+	if res.Error != nil || res.RowsAffected == 0 || time.Now().After(pending.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login state"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tokens, err := provider.Exchange(ctx, code, pending.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange with %s failed: %v", provider.Name(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "failed to exchange authorization code"})
+		return
+	}
+	claims, err := provider.VerifyIDToken(ctx, tokens.IDToken, pending.Nonce)
+	if err != nil {
+		log.Printf("OIDC id token from %s rejected: %v", provider.Name(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id token"})
+		return
+	}
+
+	user, err := h.findOrCreateOIDCUser(provider.Name(), claims)
+	if err != nil {
+		log.Printf("OIDC user linking failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2fa applies to external logins as well
+	if challenge, required, err := h.mfaChallenge(user); required {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start two factor login"})
+			return
+		}
+		h.finishOIDCLogin(c, challenge)
+		return
+	}
+
+	token, _, refreshToken, err := h.issueTokens(h.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	resp := h.tokenResponse(token, refreshToken)
+	resp["user"] = user
+	h.finishOIDCLogin(c, resp)
+}
+
+// cookies are only marked secure when the api is reached over https, so local http setups keep working
+func (h *Handler) secureCookies(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// browsers land back on the frontend with the result in the fragment (never sent to servers)
+func (h *Handler) finishOIDCLogin(c *gin.Context, resp gin.H) {
+	if h.cfg.FRONTEND_URL == "" {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	fragment := url.Values{}
+	for key, value := range resp {
+		if key == "user" {
+			continue
+		}
+		fragment.Set(key, fmt.Sprint(value))
+	}
+	c.Redirect(http.StatusFound, strings.TrimSuffix(h.cfg.FRONTEND_URL, "/")+"/auth/oidc/callback#"+fragment.Encode())
+}
+
+// finds the user linked to this identity, links an existing account by verified email or creates one
+func (h *Handler) findOrCreateOIDCUser(provider string, claims *oidc.IDTokenClaims) (*models.User, error) {
+	var identity models.UserIdentity
+	err := h.DB.Preload("User").Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	if err == nil {
+		return &identity.User, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("identity provider did not share an email address")
+	}
+	// an unverified email could be used to take over someone else's account
+	if !claims.EmailVerified {
+		return nil, errors.New("email address is not verified by the identity provider")
+	}
+
+	var user models.User
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&user, "email = ?", claims.Email).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user, err = newOIDCUser(tx, claims)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else if user.EmailVerifiedAt == nil {
+			// anybody can register someone else's address with a password of their own, linking that
+			// account would hand the real owner's login to them
+			return errUnverifiedAccount
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func newOIDCUser(tx *gorm.DB, claims *oidc.IDTokenClaims) (models.User, error) {
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" {
+		parts := strings.Fields(claims.Name)
+		if len(parts) > 0 {
+			firstName = parts[0]
+			lastName = strings.Join(parts[1:], " ")
+		} else {
+			firstName = strings.Split(claims.Email, "@")[0]
+		}
+	}
+
+	username, err := uniqueUsername(tx, claims)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// the account has no usable password, the random hash just keeps password login closed
+	randomPassword, err := oidc.RandomString(32)
+	if err != nil {
+		return models.User{}, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// the provider vouched for the address
+	now := time.Now()
+	return models.User{
+		FirstName:       firstName,
+		LastName:        lastName,
+		Username:        username,
+		Email:           claims.Email,
+		Password:        string(hashed),
+		EmailVerifiedAt: &now,
+	}, nil
+}
+
+func uniqueUsername(tx *gorm.DB, claims *oidc.IDTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base = strings.Split(claims.Email, "@")[0]
+	}
+	base = usernameCleaner.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, 1000+rand.Intn(9000))
+	}
+	return "", errors.New("could not pick a free username")
+}
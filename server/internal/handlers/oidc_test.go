@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"geekCode/internal/auth"
+	"geekCode/internal/config"
+	"geekCode/internal/models"
+	"geekCode/internal/oidc"
+	"geekCode/internal/oidc/oidctest"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testRedirectURL = "http://geekcode.test/api/auth/oidc/mock/callback"
+
+func oidcTestRouter(t *testing.T) (*gin.Engine, *Handler, *oidctest.Server) {
+	t.Helper()
+	initTestKeys(t)
+	db := newTestDB(t, &models.User{}, &models.UserIdentity{}, &models.OAuthState{}, &models.RefreshToken{})
+
+	server := oidctest.NewServer("geekcode")
+	t.Cleanup(server.Close)
+	h := &Handler{
+		DB:  db,
+		cfg: &config.Config{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+		oidcProviders: map[string]*oidc.Provider{
+			"mock":  oidc.NewProvider(oidc.Config{Name: "mock", Issuer: server.Issuer(), ClientID: "geekcode", RedirectURL: testRedirectURL}, server.Client()),
+			"other": oidc.NewProvider(oidc.Config{Name: "other", Issuer: server.Issuer(), ClientID: "geekcode", RedirectURL: testRedirectURL}, server.Client()),
+		},
+	}
+	r := gin.New()
+	r.GET("/api/auth/oidc/:provider/login", h.OIDCLogin)
+	r.GET("/api/auth/oidc/:provider/callback", h.OIDCCallback)
+	return r, h, server
+}
+
+// startLogin asks for the login url and lets the mock provider log the user in, returning the
+// query the provider sends the browser back with and the state cookie the browser got
+func startLogin(t *testing.T, r *gin.Engine, server *oidctest.Server, provider string) (url.Values, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/"+provider+"/login?mode=json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login returned %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		URL string `json:"url"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oauthStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("login set state cookie %+v", cookie)
+	}
+
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(body.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query(), cookie
+}
+
+func callback(r *gin.Engine, provider string, query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/"+provider+"/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCCallback(t *testing.T) {
+	r, h, server := oidcTestRouter(t)
+
+	query, cookie := startLogin(t, r, server, "mock")
+	w := callback(r, "mock", query, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	userID, err := auth.ValidateToken(body.Token)
+	if err != nil || body.RefreshToken == "" {
+		t.Fatalf("callback didn't log in: %s", w.Body)
+	}
+	var identity models.UserIdentity
+	if err := h.DB.Preload("User").First(&identity, "provider = ? AND subject = ?", "mock", oidctest.Subject).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != userID || identity.User.Email != "ada@example.com" || identity.User.EmailVerifiedAt == nil {
+		t.Errorf("identity not linked to the logged in user: %+v", identity)
+	}
+
+	// the state is gone once used, the same redirect can't log in twice
+	if w := callback(r, "mock", query, cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("replayed callback returned %d, want 400", w.Code)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	r, h, server := oidcTestRouter(t)
+	tests := []struct {
+		name     string
+		provider string
+		tamper   func(url.Values, *http.Cookie) *http.Cookie
+	}{
+		{"unknown state", "mock", func(q url.Values, c *http.Cookie) *http.Cookie {
+			q.Set("state", "not-the-state")
+			c.Value = "not-the-state"
+			return c
+		}},
+		{"missing state", "mock", func(q url.Values, c *http.Cookie) *http.Cookie { q.Del("state"); return c }},
+		{"state of another provider", "other", func(_ url.Values, c *http.Cookie) *http.Cookie { return c }},
+		{"expired state", "mock", func(q url.Values, c *http.Cookie) *http.Cookie {
+			h.DB.Model(&models.OAuthState{}).Where("state = ?", q.Get("state")).Update("expires_at", time.Now().Add(-time.Second))
+			return c
+		}},
+		// login csrf: the attacker's own callback link opened in the victim's browser
+		{"no state cookie", "mock", func(url.Values, *http.Cookie) *http.Cookie { return nil }},
+		{"cookie of another login", "mock", func(_ url.Values, c *http.Cookie) *http.Cookie {
+			_, other := startLogin(t, r, server, "mock")
+			return other
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, cookie := startLogin(t, r, server, "mock")
+			cookie = tt.tamper(query, cookie)
+			if w := callback(r, tt.provider, query, cookie); w.Code != http.StatusBadRequest {
+				t.Errorf("callback returned %d, want 400: %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	t.Run("provider error", func(t *testing.T) {
+		if w := callback(r, "mock", url.Values{"error": {"access_denied"}}, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("callback returned %d, want 401", w.Code)
+		}
+	})
+}
+
+func TestOIDCLinksOnlyVerifiedAccounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		verified bool
+		want     int
+	}{
+		// somebody registered the address before its owner signed in with the provider
+		{"unverified local account", false, http.StatusBadRequest},
+		{"verified local account", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, h, server := oidcTestRouter(t)
+			local := models.User{FirstName: "Ada", Username: "ada", Email: "ada@example.com", Password: "hash"}
+			if tt.verified {
+				now := time.Now()
+				local.EmailVerifiedAt = &now
+			}
+			h.DB.Create(&local)
+
+			query, cookie := startLogin(t, r, server, "mock")
+			w := callback(r, "mock", query, cookie)
+			if w.Code != tt.want {
+				t.Fatalf("callback returned %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var linked int64
+			h.DB.Model(&models.UserIdentity{}).Where("user_id = ?", local.ID).Count(&linked)
+			if (linked == 1) != tt.verified {
+				t.Errorf("%d identities linked to the local account", linked)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"errors"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var slugCleaner = regexp.MustCompile(`[^a-z0-9]+`)
+
+type CreateOrgRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"`
+}
+
+type AddOrgMemberRequest struct {
+	Email string         `json:"email" binding:"required,email"`
+	Role  models.OrgRole `json:"role"`
+}
+
+type UpdateOrgMemberRequest struct {
+	Role models.OrgRole `json:"role" binding:"required"`
+}
+
+type CreateTeamRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type AddTeamMemberRequest struct {
+	UserID uint `json:"userId" binding:"required"`
+}
+
+// MemberInfo is what members of an org or team see of each other, no emails and nothing from the account
+type MemberInfo struct {
+	UserID    uint           `json:"userId"`
+	Username  string         `json:"username"`
+	FirstName string         `json:"firstName"`
+	LastName  string         `json:"lastName"`
+	Role      models.OrgRole `json:"role,omitempty"` // org members only
+	JoinedAt  time.Time      `json:"joinedAt"`
+}
+
+func memberInfo(user models.User, role models.OrgRole, joinedAt time.Time) MemberInfo {
+	return MemberInfo{
+		UserID:    user.ID,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      role,
+		JoinedAt:  joinedAt,
+	}
+}
+
+func orgMembers(members []models.OrgMember) []MemberInfo {
+	infos := make([]MemberInfo, 0, len(members))
+	for _, member := range members {
+		infos = append(infos, memberInfo(member.User, member.Role, member.CreatedAt))
+	}
+	return infos
+}
+
+// creates an org, the creator becomes its first admin
+func (h *Handler) CreateOrg(c *gin.Context) {
+	var req CreateOrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+
+	slug := req.Slug
+	if slug == "" {
+		slug = req.Name
+	}
+	slug = strings.Trim(slugCleaner.ReplaceAllString(strings.ToLower(slug), "-"), "-")
+	if slug == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization slug"})
+		return
+	}
+
+	var existing int64
+	h.DB.Model(&models.Organization{}).Where("slug = ?", slug).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "organization slug already taken"})
+		return
+	}
+
+	org := models.Organization{Name: req.Name, Slug: slug, CreatedBy: userId}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrgMember{OrgID: org.ID, UserID: userId, Role: models.OrgRoleAdmin}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"organization": org})
+}
+
+// orgs the user belongs to, with their role in each
+func (h *Handler) ListOrgs(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+
+	type orgWithRole struct {
+		models.Organization
+		Role models.OrgRole `json:"role"`
+	}
+	var orgs []orgWithRole
+	if err := h.DB.Table("organizations").
+		Select("organizations.*, org_members.role").
+		Joins("JOIN org_members ON org_members.org_id = organizations.id").
+		Where("org_members.user_id = ?", userId).
+		Order("organizations.name").
+		Scan(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+func (h *Handler) GetOrg(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+
+	var org models.Organization
+	if err := h.DB.Preload("Members.User").First(&org, orgID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+		return
+	}
+	members := orgMembers(org.Members)
+	org.Members = nil // the full rows would carry the users' emails along
+	c.JSON(http.StatusOK, gin.H{"organization": struct {
+		models.Organization
+		Members []MemberInfo `json:"members"`
+	}{org, members}})
+}
+
+// adds an existing user to the org by email
+func (h *Handler) AddOrgMember(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+	var req AddOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleInterviewer
+	}
+	if !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "email = ?", req.Email).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	member := models.OrgMember{OrgID: orgID, UserID: user.ID, Role: req.Role}
+	var existing int64
+	h.DB.Model(&models.OrgMember{}).Where("org_id = ? AND user_id = ?", orgID, user.ID).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "user is already a member"})
+		return
+	}
+	if err := h.DB.Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add member"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"member": memberInfo(user, member.Role, member.CreatedAt)})
+}
+
+func (h *Handler) UpdateOrgMember(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+	memberID, ok := uintParam(c, "userId")
+	if !ok {
+		return
+	}
+	var req UpdateOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var member models.OrgMember
+		if err := tx.First(&member, "org_id = ? AND user_id = ?", orgID, memberID).Error; err != nil {
+			return err
+		}
+		if member.Role == models.OrgRoleAdmin && req.Role != models.OrgRoleAdmin {
+			if err := ensureAnotherAdmin(tx, orgID, memberID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&member).Update("role", req.Role).Error
+	})
+	h.respondMembershipChange(c, err, "member updated")
+}
+
+// admins can remove anyone, members can leave on their own
+func (h *Handler) RemoveOrgMember(c *gin.Context) {
+	memberID, ok := uintParam(c, "userId")
+	if !ok {
+		return
+	}
+	orgID := c.MustGet("orgId").(uint)
+	roles := c.MustGet("roles").([]rbac.Role)
+	if memberID != c.MustGet("userId").(uint) && !h.rbac.Allows(roles, rbac.OrgAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + string(rbac.OrgAdmin)})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var member models.OrgMember
+		if err := tx.First(&member, "org_id = ? AND user_id = ?", orgID, memberID).Error; err != nil {
+			return err
+		}
+		if member.Role == models.OrgRoleAdmin {
+			if err := ensureAnotherAdmin(tx, orgID, memberID); err != nil {
+				return err
+			}
+		}
+		teamIDs := tx.Model(&models.Team{}).Select("id").Where("org_id = ?", orgID)
+		if err := tx.Where("user_id = ? AND team_id IN (?)", memberID, teamIDs).Delete(&models.TeamMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&member).Error
+	})
+	h.respondMembershipChange(c, err, "member removed")
+}
+
+func (h *Handler) CreateTeam(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+	var req CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	team := models.Team{OrgID: orgID, Name: req.Name}
+	if err := h.DB.Create(&team).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create team"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"team": team})
+}
+
+func (h *Handler) ListTeams(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+	var teams []models.Team
+	if err := h.DB.Preload("Members.User").Where("org_id = ?", orgID).Order("name").Find(&teams).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch teams"})
+		return
+	}
+	type teamResponse struct {
+		models.Team
+		Members []MemberInfo `json:"members"`
+	}
+	response := make([]teamResponse, 0, len(teams))
+	for _, team := range teams {
+		members := make([]MemberInfo, 0, len(team.Members))
+		for _, member := range team.Members {
+			members = append(members, memberInfo(member.User, "", member.CreatedAt))
+		}
+		team.Members = nil
+		response = append(response, teamResponse{team, members})
+	}
+	c.JSON(http.StatusOK, gin.H{"teams": response})
+}
+
+func (h *Handler) AddTeamMember(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+	team, ok := h.findTeam(c, orgID)
+	if !ok {
+		return
+	}
+	var req AddTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// only people in the org can join its teams
+	if _, err := h.orgRole(orgID, req.UserID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user is not a member of this organization"})
+		return
+	}
+	var existing int64
+	h.DB.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", team.ID, req.UserID).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "user is already in this team"})
+		return
+	}
+
+	member := models.TeamMember{TeamID: team.ID, UserID: req.UserID}
+	if err := h.DB.Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add team member"})
+		return
+	}
+	var user models.User
+	h.DB.First(&user, req.UserID)
+	c.JSON(http.StatusCreated, gin.H{"member": memberInfo(user, "", member.CreatedAt)})
+}
+
+func (h *Handler) RemoveTeamMember(c *gin.Context) {
+	orgID := c.MustGet("orgId").(uint)
+	team, ok := h.findTeam(c, orgID)
+	if !ok {
+		return
+	}
+	memberID, ok := uintParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	res := h.DB.Where("team_id = ? AND user_id = ?", team.ID, memberID).Delete(&models.TeamMember{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove team member"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "team member removed"})
+}
+
+var errLastAdmin = errors.New("an organization needs at least one admin")
+
+func ensureAnotherAdmin(tx *gorm.DB, orgID, userID uint) error {
+	var admins int64
+	if err := tx.Model(&models.OrgMember{}).
+		Where("org_id = ? AND role = ? AND user_id <> ?", orgID, models.OrgRoleAdmin, userID).
+		Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+func (h *Handler) respondMembershipChange(c *gin.Context, err error, message string) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update membership"})
+	}
+}
+
+// role of the user in the org, gorm.ErrRecordNotFound when not a member
+func (h *Handler) orgRole(orgID, userID uint) (models.OrgRole, error) {
+	var member models.OrgMember
+	if err := h.DB.Select("role").First(&member, "org_id = ? AND user_id = ?", orgID, userID).Error; err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+func (h *Handler) findTeam(c *gin.Context, orgID uint) (*models.Team, bool) {
+	teamID, ok := uintParam(c, "teamId")
+	if !ok {
+		return nil, false
+	}
+	var team models.Team
+	if err := h.DB.First(&team, "id = ? AND org_id = ?", teamID, orgID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "team not found"})
+		return nil, false
+	}
+	return &team, true
+}
+
+func uintParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"geekCode/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOrgMembersInResponses(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.Organization{}, &models.OrgMember{}, &models.Team{}, &models.TeamMember{})
+	h := &Handler{DB: db}
+
+	ada := models.User{FirstName: "Ada", LastName: "L", Username: "ada", Email: "ada@example.com", Password: "x"}
+	db.Create(&ada)
+	org := models.Organization{Name: "Acme", Slug: "acme", CreatedBy: ada.ID}
+	db.Create(&org)
+	db.Create(&models.OrgMember{OrgID: org.ID, UserID: ada.ID, Role: models.OrgRoleAdmin})
+	team := models.Team{OrgID: org.ID, Name: "backend"}
+	db.Create(&team)
+	db.Create(&models.TeamMember{TeamID: team.ID, UserID: ada.ID})
+
+	r := gin.New()
+	withOrg := func(c *gin.Context) { c.Set("orgId", org.ID) }
+	r.GET("/orgs/:orgId", withOrg, h.GetOrg)
+	r.GET("/orgs/:orgId/teams", withOrg, h.ListTeams)
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "ada@example.com") || strings.Contains(w.Body.String(), `"Members"`) {
+			t.Errorf("%s leaks the member rows: %s", path, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	var orgResp struct {
+		Organization struct {
+			Members []MemberInfo `json:"members"`
+		} `json:"organization"`
+	}
+	json.Unmarshal([]byte(get("/orgs/1")), &orgResp)
+	if members := orgResp.Organization.Members; len(members) != 1 || members[0].Username != "ada" || members[0].Role != models.OrgRoleAdmin {
+		t.Errorf("org members = %+v", members)
+	}
+
+	var teamsResp struct {
+		Teams []struct {
+			Name    string
+			Members []MemberInfo `json:"members"`
+		} `json:"teams"`
+	}
+	json.Unmarshal([]byte(get("/orgs/1/teams")), &teamsResp)
+	if len(teamsResp.Teams) != 1 || len(teamsResp.Teams[0].Members) != 1 || teamsResp.Teams[0].Members[0].Username != "ada" {
+		t.Errorf("teams = %+v", teamsResp.Teams)
+	}
+}
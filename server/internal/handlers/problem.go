@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProblemRequest struct {
+	Title       string `json:"title" binding:"required,max=200"`
+	Description string `json:"description"`
+	Difficulty  string `json:"difficulty" binding:"omitempty,oneof=easy medium hard"`
+	OrgID       *uint  `json:"orgId"` // optional, shares the problem with the org
+}
+
+type UpdateProblemRequest struct {
+	Title       *string `json:"title" binding:"omitempty,min=1,max=200"`
+	Description *string `json:"description"`
+	Difficulty  *string `json:"difficulty" binding:"omitempty,oneof=easy medium hard"`
+}
+
+func (h *Handler) CreateProblem(c *gin.Context) {
+	var req ProblemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	if !h.canUseOwned(c, userId, userId, req.OrgID, rbac.ProblemEdit) {
+		return
+	}
+
+	problem := models.Problem{
+		Title:       req.Title,
+		Description: req.Description,
+		Difficulty:  req.Difficulty,
+		OrgID:       req.OrgID,
+		CreatedBy:   userId,
+	}
+	if err := h.DB.Create(&problem).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create problem"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"problem": problem})
+}
+
+// the user's own problems, or the org's with ?orgId=
+func (h *Handler) ListProblems(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	scope, ok := h.ownedScope(c, userId)
+	if !ok {
+		return
+	}
+
+	var problems []models.Problem
+	if err := h.DB.Scopes(scope).Order("created_at DESC").Find(&problems).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch problems"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"problems": problems})
+}
+
+func (h *Handler) GetProblem(c *gin.Context) {
+	problem, ok := h.findProblem(c, rbac.OrgView)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"problem": problem})
+}
+
+func (h *Handler) UpdateProblem(c *gin.Context) {
+	var req UpdateProblemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	problem, ok := h.findProblem(c, rbac.ProblemEdit)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Difficulty != nil {
+		updates["difficulty"] = *req.Difficulty
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+	if err := h.DB.Model(problem).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update problem"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"problem": problem})
+}
+
+func (h *Handler) DeleteProblem(c *gin.Context) {
+	problem, ok := h.findProblem(c, rbac.ProblemEdit)
+	if !ok {
+		return
+	}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// templates and rooms just lose the problem
+		if err := tx.Exec("DELETE FROM template_problems WHERE problem_id = ?", problem.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM room_problems WHERE problem_id = ?", problem.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(problem).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete problem"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "problem deleted"})
+}
+
+func (h *Handler) findProblem(c *gin.Context, perm rbac.Permission) (*models.Problem, bool) {
+	problemID, ok := uintParam(c, "problemId")
+	if !ok {
+		return nil, false
+	}
+	var problem models.Problem
+	if err := h.DB.First(&problem, problemID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+		return nil, false
+	}
+	userId := c.MustGet("userId").(uint)
+	if !h.canUseOwned(c, userId, problem.CreatedBy, problem.OrgID, perm) {
+		return nil, false
+	}
+	return &problem, true
+}
+
+// loads the problems by id, every one of them has to be visible to the user
+func (h *Handler) visibleProblems(c *gin.Context, userId uint, ids []uint) ([]models.Problem, bool) {
+	if len(ids) == 0 {
+		return nil, true
+	}
+	var problems []models.Problem
+	if err := h.DB.Where("id IN ?", ids).Find(&problems).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch problems"})
+		return nil, false
+	}
+	if len(problems) != len(ids) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown problem"})
+		return nil, false
+	}
+	for _, problem := range problems {
+		if !h.canUseOwned(c, userId, problem.CreatedBy, problem.OrgID, rbac.OrgView) {
+			return nil, false
+		}
+	}
+	return problems, true
+}
+
+// personal problems and templates belong to their creator, org ones follow the roles in the org.
+// answers 404 when the user can't see the thing at all and 403 when they just can't change it
+func (h *Handler) canUseOwned(c *gin.Context, userId, createdBy uint, orgID *uint, perm rbac.Permission) bool {
+	if orgID == nil {
+		if createdBy != userId {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return false
+		}
+		return true
+	}
+
+	roles, err := h.rbac.OrgRoles(userId, *orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+		return false
+	}
+	if len(roles) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return false
+	}
+	if !h.rbac.Allows(roles, perm) || !rbac.ScopeAllows(c.GetStringSlice("scopes"), perm) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + string(perm)})
+		return false
+	}
+	return true
+}
+
+// ?orgId= lists the org's shared items, otherwise the user's personal ones
+func (h *Handler) ownedScope(c *gin.Context, userId uint) (func(*gorm.DB) *gorm.DB, bool) {
+	orgParam := c.Query("orgId")
+	if orgParam == "" {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("created_by = ? AND org_id IS NULL", userId)
+		}, true
+	}
+	orgID, err := strconv.ParseUint(orgParam, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid orgId"})
+		return nil, false
+	}
+	id := uint(orgID)
+	if !h.canUseOwned(c, userId, 0, &id, rbac.OrgView) {
+		return nil, false
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("org_id = ?", id)
+	}, true
+}
@@ -2,13 +2,15 @@ package handlers
 
 import (
 	"geekCode/internal/models"
+	"geekCode/internal/rbac"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
-	// "gorm.io/gorm"
+	"gorm.io/gorm"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +18,17 @@ import (
 
 type CreateRoomRequest struct {
 	Name   string `json:"name" binding:"required"`
+	OrgID  *uint  `json:"orgId"`  // optional, the room is then shared with the org
+	TeamID *uint  `json:"teamId"` // optional, must belong to the org
+	Language string `json:"language"`
+	Tags []string `json:"tags" binding:"max=10"`
+	TemplateID *uint `json:"templateId"` // optional, copies the template's files, problems and settings
+	ScheduledStart *time.Time `json:"scheduledStart"` // optional, the room opens shortly before this
+	DurationMinutes *int `json:"durationMinutes" binding:"omitempty,min=1,max=1440"`
+	Attendees []models.Attendee `json:"attendees" binding:"max=50"`
+	CandidateID *uint `json:"candidateId"` // optional, links the scorecards to the candidate
+	RubricID *uint `json:"rubricId"` // optional, the default rubric otherwise
+	Assistant *models.AssistantSettings `json:"assistant"` // optional, overrides the template's assistant settings
 }
 
 func (h *Handler) CreateRoom(c *gin.Context) {
@@ -40,15 +53,76 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 		return
 	}
 
+	if req.TeamID != nil && req.OrgID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error" : "teamId requires an orgId"})
+		return
+	}
+	if req.OrgID != nil {
+		allowed, err := h.rbac.CanOrg(user.ID, *req.OrgID, rbac.RoomCreate)
+		if err != nil || !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error" : "not allowed to create rooms in this organization"})
+			return
+		}
+	}
+	if req.TeamID != nil {
+		var team models.Team
+		if err := h.DB.First(&team, "id = ? AND org_id = ?", *req.TeamID, *req.OrgID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error" : "team not found in this organization"})
+			return
+		}
+	}
+
 	room  := models.Room{
 		Name: req.Name,
 		CreatedBy: user.ID,
 		CreatedAt: time.Now(),
 		Creator: user,
 		RoomID: uuid.New().String(),
+		OrgID: req.OrgID,
+		TeamID: req.TeamID,
+		Language: req.Language,
 	}
 
-	if err := h.DB.Create(&room).Error; err != nil {
+	if req.TemplateID != nil {
+		template, ok := h.findTemplate(c, *req.TemplateID, rbac.OrgView)
+		if !ok {
+			return
+		}
+		// the room gets its own copy, editing the template later doesn't touch it
+		room.TemplateID = &template.ID
+		room.Files = template.Files
+		room.DurationMinutes = template.DurationMinutes
+		room.Settings = template.Settings
+		room.Problems = template.Problems
+		if room.Language == "" {
+			room.Language = template.Language
+		}
+	}
+	if req.DurationMinutes != nil {
+		room.DurationMinutes = *req.DurationMinutes
+	}
+	if !h.validateScoring(c, req.CandidateID, req.RubricID) {
+		return
+	}
+	room.CandidateID = req.CandidateID
+	room.RubricID = req.RubricID
+	if req.Assistant != nil {
+		if !validAssistantSettings(c, *req.Assistant) {
+			return
+		}
+		room.Settings = room.Settings.WithAssistant(*req.Assistant)
+	}
+	if !h.applySchedule(c, &room, req.ScheduledStart, req.Attendees) {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Problems.*").Create(&room).Error; err != nil {
+			return err
+		}
+		return setRoomTags(tx, room.RoomID, req.Tags)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error" : "failed to create room"})
 		return
 	}
@@ -64,108 +138,235 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 	// 	return
 	// }
 
-	c.JSON(http.StatusOK, gin.H{"roomID" : room.ID, "link" : "/code/" +fmt.Sprint(room.RoomID)})
+	c.JSON(http.StatusOK, gin.H{"roomID" : room.ID, "link" : "/code/" +fmt.Sprint(room.RoomID), "status": room.Status.String()})
 }
 
-func (h *Handler) ListRooms(c *gin.Context) {
-	const limit = 10
-	var rooms []models.Room
-	userId, exists := c.Get("userId")
-	if !exists {
-		log.Println("User doesnt exist!")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
+// End a room (change status to Ended)
+func (h *Handler) EndRoom(c *gin.Context) {
+	// loaded and checked for room.end by the rbac middleware
+	room := c.MustGet("room").(*models.Room)
 	
-	// Get all rooms created by user, ordered by creation date
-	if err := h.DB.Where("created_by = ?", userId).Order("created_at DESC").Limit(limit).Find(&rooms).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms!"})
+	// ending a scheduled room cancels it
+	wasActive := room.Status == models.Active
+	if !h.setRoomStatus(c, room, models.Ended, models.Active, models.Scheduled) {
 		return
 	}
+	if wasActive {
+		h.RoomEnded(room, "room ended")
+	} else {
+		h.hub.CloseRoom(room.RoomID, "room ended")
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"rooms": rooms,
+		"message": "Room ended successfully",
+		"room": room,
 	})
 }
 
-// Get active rooms (rooms with status Active)
-func (h *Handler) GetActiveRooms(c *gin.Context) {
-	var rooms []models.Room
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+// Reopen an ended room so people can join again
+func (h *Handler) ReopenRoom(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+
+	if !h.setRoomStatus(c, room, models.Active, models.Ended) {
 		return
 	}
-	
-	if err := h.DB.Where("created_by = ? AND status = ?", userId, models.Active).Order("created_at DESC").Find(&rooms).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch active rooms!"})
+	c.JSON(http.StatusOK, gin.H{"message": "Room reopened successfully", "room": room})
+}
+
+// only ended rooms can be archived, archived rooms go back to ended
+func (h *Handler) ArchiveRoom(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+
+	if !h.setRoomStatus(c, room, models.Archived, models.Ended) {
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Room archived successfully", "room": room})
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"activeRooms": rooms,
-	})
+func (h *Handler) UnarchiveRoom(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+
+	if !h.setRoomStatus(c, room, models.Ended, models.Archived) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Room unarchived successfully", "room": room})
 }
 
-// Get ended rooms (rooms with status Ended)
-func (h *Handler) GetEndedRooms(c *gin.Context) {
-	var rooms []models.Room
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+type UpdateRoomRequest struct {
+	Name     *string   `json:"name" binding:"omitempty,min=1,max=100"`
+	Language *string   `json:"language"`
+	Tags     *[]string `json:"tags" binding:"omitempty,max=10"` // replaces all tags
+
+	// rescheduling, only while the room is scheduled or active
+	ScheduledStart  *time.Time         `json:"scheduledStart"`
+	DurationMinutes *int               `json:"durationMinutes" binding:"omitempty,min=1,max=1440"`
+	Attendees       *[]models.Attendee `json:"attendees" binding:"omitempty,max=50"`
+
+	CandidateID *uint                     `json:"candidateId"`
+	RubricID    *uint                     `json:"rubricId"`
+	Assistant   *models.AssistantSettings `json:"assistant"` // who may use the ai assistant
+}
+
+func (h *Handler) UpdateRoom(c *gin.Context) {
+	var req UpdateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
-	if err := h.DB.Where("created_by = ? AND status = ?", userId, models.Ended).Order("created_at DESC").Find(&rooms).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ended rooms!"})
+	room := c.MustGet("room").(*models.Room)
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Language != nil {
+		runtime, found := h.languages.Get(*req.Language)
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown language " + *req.Language})
+			return
+		}
+		// aliases like "c++" are stored under the runtime's own name
+		updates["language"] = runtime.Name
+	}
+	if req.CandidateID != nil || req.RubricID != nil {
+		if !h.validateScoring(c, req.CandidateID, req.RubricID) {
+			return
+		}
+		if req.CandidateID != nil {
+			updates["candidate_id"] = *req.CandidateID
+		}
+		if req.RubricID != nil {
+			updates["rubric_id"] = *req.RubricID
+		}
+	}
+	if req.Assistant != nil && !validAssistantSettings(c, *req.Assistant) {
+		return
+	}
+	reschedule := req.ScheduledStart != nil || req.DurationMinutes != nil || req.Attendees != nil
+	if len(updates) == 0 && req.Tags == nil && req.Assistant == nil && !reschedule {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"endedRooms": rooms,
-	})
-}
+	wasOpen := room.Status == models.Active
+	if reschedule {
+		if room.Status != models.Scheduled && room.Status != models.Active {
+			c.JSON(http.StatusConflict, gin.H{"error": "only scheduled or active rooms can be rescheduled"})
+			return
+		}
+		start := room.ScheduledStart
+		if req.ScheduledStart != nil {
+			start = req.ScheduledStart
+		}
+		if req.DurationMinutes != nil {
+			room.DurationMinutes = *req.DurationMinutes
+		}
+		attendees := room.Attendees
+		if req.Attendees != nil {
+			attendees = *req.Attendees
+		}
+		if !h.applySchedule(c, room, start, attendees) {
+			return
+		}
+		room.InviteSequence++
+	}
 
-// End a room (change status to Ended)
-func (h *Handler) EndRoom(c *gin.Context) {
-	roomId := c.Param("roomId")
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(room).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if reschedule {
+			if err := tx.Model(room).Select("status", "scheduled_start", "auto_end_at", "duration_minutes", "attendees", "invite_sequence").Updates(room).Error; err != nil {
+				return err
+			}
+		}
+		if req.Assistant != nil {
+			room.Settings = room.Settings.WithAssistant(*req.Assistant)
+			if err := tx.Model(room).Select("settings").Updates(room).Error; err != nil {
+				return err
+			}
+		}
+		if req.Tags == nil {
+			return nil
+		}
+		if err := tx.Where("room_id = ?", room.RoomID).Delete(&models.RoomTag{}).Error; err != nil {
+			return err
+		}
+		return setRoomTags(tx, room.RoomID, *req.Tags)
+	})
+	if err == nil {
+		err = h.DB.Preload("Tags").First(room, room.ID).Error
 	}
-	
-	var room models.Room
-	if err := h.DB.Where("room_id = ? AND created_by = ?", roomId, userId).First(&room).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found!"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room!"})
 		return
 	}
-	
-	room.Status = models.Ended
-	if err := h.DB.Save(&room).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end room!"})
+	// moved into the future, whoever is in the room has to come back later
+	if wasOpen && room.Status == models.Scheduled {
+		h.hub.CloseRoom(room.RoomID, "room was rescheduled")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Room updated successfully", "room": room})
+}
+
+// soft deletes the room, it disappears right away and is purged for good after the retention period
+func (h *Handler) DeleteRoom(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+
+	if err := h.DB.Delete(room).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete room!"})
 		return
 	}
+	h.hub.CloseRoom(room.RoomID, "room deleted")
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Room ended successfully",
-		"room": room,
+		"message":  "Room deleted successfully",
+		"purgeAt": time.Now().Add(h.cfg.RoomDeleteRetention),
 	})
 }
 
+// moves the room to the new status if it's currently in one of the from statuses,
+// the conditional update keeps two concurrent requests from both going through
+func (h *Handler) setRoomStatus(c *gin.Context, room *models.Room, to models.Status, from ...models.Status) bool {
+	updates := map[string]interface{}{"status": to}
+	switch {
+	case to == models.Ended && room.Status != models.Archived:
+		updates["ended_at"] = time.Now()
+	case to == models.Active:
+		// a reopened room stays open until somebody ends it
+		updates["ended_at"] = nil
+		updates["auto_end_at"] = nil
+	}
+
+	res := h.DB.Model(&models.Room{}).Where("id = ? AND status IN ?", room.ID, from).Updates(updates)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room!"})
+		return false
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("can't move a room that is %s to %s", room.Status, to)})
+		return false
+	}
+	if err := h.DB.First(room, room.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room!"})
+		return false
+	}
+	return true
+}
+
 func (h *Handler) GetRoom(c *gin.Context){
-	roomId := c.Param("roomId")
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"Error": "User not authenticated!"})
+	// loaded and checked for room.view by the rbac middleware
+	room := c.MustGet("room").(*models.Room)
+	if err := h.DB.Where("room_id = ?", room.RoomID).Find(&room.Tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room!"})
 		return
 	}
-	var room models.Room
-
-	if err := h.DB.Where("room_id = ? AND created_by = ?", roomId, userId).First(&room).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"Error": "Room not found!"})
+	if err := h.DB.Model(room).Association("Problems").Find(&room.Problems); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room!"})
 		return
 	}
+	h.attachLiveState([]*models.Room{room})
 	
 	//Now returning the specific rooms members
 	// var roomMembers []models.Client
@@ -178,4 +379,54 @@ func (h *Handler) GetRoom(c *gin.Context){
 
 	c.JSON(http.StatusOK , gin.H{"room" : room})
 
-}
\ No newline at end of file
+}
+
+func setRoomTags(tx *gorm.DB, roomId string, tags []string) error {
+	tags = normalizeTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]models.RoomTag, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, models.RoomTag{RoomID: roomId, Tag: tag})
+	}
+	return tx.Create(&rows).Error
+}
+
+// tags are matched case insensitively, so they are stored lower case and without duplicates
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > 32 || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// adds who is connected, the language and any running execution from the hub
+func (h *Handler) attachLiveState(rooms []*models.Room) {
+	ids := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		ids = append(ids, room.RoomID)
+	}
+	snapshots := h.hub.Snapshots(ids...)
+	for _, room := range rooms {
+		live := snapshots[room.RoomID]
+		room.Live = &live
+	}
+}
+
+func validAssistantSettings(c *gin.Context, settings models.AssistantSettings) bool {
+	for _, role := range settings.Roles {
+		if !rbac.Role(role).Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role " + role})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRoomPageSize = 20
+	maxRoomPageSize     = 100
+)
+
+type roomSort struct {
+	column string
+	desc   bool
+}
+
+// ?sort= values, a leading minus sorts descending
+var roomSorts = map[string]roomSort{
+	"created_at":  {"created_at", false},
+	"-created_at": {"created_at", true},
+	"updated_at":  {"updated_at", false},
+	"-updated_at": {"updated_at", true},
+	"name":        {"name", false},
+	"-name":       {"name", true},
+}
+
+var roomStatuses = map[string]models.Status{
+	models.Active.String():    models.Active,
+	models.Ended.String():     models.Ended,
+	models.Archived.String():  models.Archived,
+	models.Scheduled.String(): models.Scheduled,
+}
+
+// the cursor is the sort value and id of the last room on the page
+type roomCursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// ListRooms pages through the rooms in scope (own rooms, or ?orgId= / &teamId=)
+//
+//	?q=          full text search on the name
+//	?status=     active, ended, archived, scheduled (comma separated)
+//	?from= &to=  creation date range, RFC3339 or YYYY-MM-DD
+//	?participant= user id that joined the room
+//	?tag=        any of the tags (comma separated)
+//	?language=
+//	?sort=       created_at, updated_at, name, prefixed with - for descending (default -created_at)
+//	?limit= &cursor=
+func (h *Handler) ListRooms(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+
+	scope, ok := h.roomScope(c, userId)
+	if !ok {
+		return
+	}
+	filters, ok := roomFilters(c)
+	if !ok {
+		return
+	}
+	statusFilter, ok := roomStatusFilter(c)
+	if !ok {
+		return
+	}
+
+	sortParam := c.DefaultQuery("sort", "-created_at")
+	order, found := roomSorts[sortParam]
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort, use created_at, updated_at or name (prefix with - for descending)"})
+		return
+	}
+
+	limit := defaultRoomPageSize
+	if limitParam := c.Query("limit"); limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n < 1 || n > maxRoomPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = n
+	}
+
+	query := h.DB.Scopes(scope, filters, statusFilter)
+	if cursorParam := c.Query("cursor"); cursorParam != "" {
+		after, ok := roomsAfter(cursorParam, order)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		query = query.Scopes(after)
+	}
+
+	direction := "ASC"
+	if order.desc {
+		direction = "DESC"
+	}
+	var rooms []models.Room
+	// one extra row tells us whether there is another page
+	if err := query.Preload("Tags").Order(order.column + " " + direction).Order("id " + direction).Limit(limit + 1).Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms!"})
+		return
+	}
+
+	nextCursor := ""
+	if len(rooms) > limit {
+		rooms = rooms[:limit]
+		nextCursor = encodeRoomCursor(rooms[len(rooms)-1], order)
+	}
+	page := make([]*models.Room, len(rooms))
+	for i := range rooms {
+		page[i] = &rooms[i]
+	}
+	h.attachLiveState(page)
+
+	// totals ignore the paging, the per status numbers also ignore the status filter (dashboard statistics)
+	var total int64
+	if err := h.DB.Model(&models.Room{}).Scopes(scope, filters, statusFilter).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms!"})
+		return
+	}
+	var counts []struct {
+		Status models.Status
+		Count  int64
+	}
+	if err := h.DB.Model(&models.Room{}).Scopes(scope, filters).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms!"})
+		return
+	}
+	byStatus := gin.H{}
+	for name := range roomStatuses {
+		byStatus[name] = int64(0)
+	}
+	for _, row := range counts {
+		byStatus[row.Status.String()] = row.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rooms":      rooms,
+		"nextCursor": nextCursor,
+		"total":      total,
+		"byStatus":   byStatus,
+	})
+}
+
+// rooms in the requested scope, ?orgId= (and optionally &teamId=) lists the org's rooms, otherwise the user's own
+func (h *Handler) roomScope(c *gin.Context, userId uint) (func(*gorm.DB) *gorm.DB, bool) {
+	orgParam := c.Query("orgId")
+	if orgParam == "" {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("created_by = ?", userId)
+		}, true
+	}
+
+	orgID, err := strconv.ParseUint(orgParam, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid orgId"})
+		return nil, false
+	}
+	allowed, err := h.rbac.CanOrg(userId, uint(orgID), rbac.OrgView)
+	if err != nil || !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+		return nil, false
+	}
+
+	var teamID uint64
+	if teamParam := c.Query("teamId"); teamParam != "" {
+		teamID, err = strconv.ParseUint(teamParam, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid teamId"})
+			return nil, false
+		}
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("org_id = ?", orgID)
+		if teamID != 0 {
+			db = db.Where("team_id = ?", teamID)
+		}
+		return db
+	}, true
+}
+
+// every filter except the status one
+func roomFilters(c *gin.Context) (func(*gorm.DB) *gorm.DB, bool) {
+	var conds []func(*gorm.DB) *gorm.DB
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		conds = append(conds, func(db *gorm.DB) *gorm.DB {
+			return db.Where("to_tsvector('simple', name) @@ websearch_to_tsquery('simple', ?)", q)
+		})
+	}
+	for _, param := range []string{"from", "to"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, dateOnly, err := parseDateParam(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ", use RFC3339 or YYYY-MM-DD"})
+			return nil, false
+		}
+		if param == "from" {
+			conds = append(conds, func(db *gorm.DB) *gorm.DB { return db.Where("created_at >= ?", t) })
+			continue
+		}
+		// a plain date includes the whole day
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		conds = append(conds, func(db *gorm.DB) *gorm.DB { return db.Where("created_at < ?", t) })
+	}
+	if participant := c.Query("participant"); participant != "" {
+		participantID, err := strconv.ParseUint(participant, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid participant"})
+			return nil, false
+		}
+		conds = append(conds, func(db *gorm.DB) *gorm.DB {
+			return db.Where("room_id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&models.Client{}).Select("room_id").Where("user_id = ?", participantID))
+		})
+	}
+	if tags := normalizeTags(strings.Split(c.Query("tag"), ",")); len(tags) > 0 {
+		conds = append(conds, func(db *gorm.DB) *gorm.DB {
+			return db.Where("room_id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&models.RoomTag{}).Select("room_id").Where("tag IN ?", tags))
+		})
+	}
+	if language := c.Query("language"); language != "" {
+		conds = append(conds, func(db *gorm.DB) *gorm.DB { return db.Where("language = ?", language) })
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		for _, cond := range conds {
+			db = cond(db)
+		}
+		return db
+	}, true
+}
+
+func roomStatusFilter(c *gin.Context) (func(*gorm.DB) *gorm.DB, bool) {
+	param := c.Query("status")
+	if param == "" {
+		return func(db *gorm.DB) *gorm.DB { return db }, true
+	}
+	var statuses []models.Status
+	for _, name := range strings.Split(param, ",") {
+		status, found := roomStatuses[strings.TrimSpace(name)]
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status " + name})
+			return nil, false
+		}
+		statuses = append(statuses, status)
+	}
+	return func(db *gorm.DB) *gorm.DB { return db.Where("status IN ?", statuses) }, true
+}
+
+func parseDateParam(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+func encodeRoomCursor(room models.Room, order roomSort) string {
+	cursor := roomCursor{ID: room.ID}
+	switch order.column {
+	case "name":
+		cursor.Value = room.Name
+	case "updated_at":
+		cursor.Value = room.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		cursor.Value = room.CreatedAt.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// keyset condition for the rows after the cursor, (column, id) keeps the order stable on ties
+func roomsAfter(raw string, order roomSort) (func(*gorm.DB) *gorm.DB, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, false
+	}
+	var cursor roomCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, false
+	}
+
+	var value interface{} = cursor.Value
+	if order.column != "name" {
+		t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, false
+		}
+		value = t
+	}
+
+	op := ">"
+	if order.desc {
+		op = "<"
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("("+order.column+", id) "+op+" (?, ?)", value, cursor.ID)
+	}, true
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type roomPage struct {
+	Rooms      []models.Room    `json:"rooms"`
+	NextCursor string           `json:"nextCursor"`
+	Total      int64            `json:"total"`
+	ByStatus   map[string]int64 `json:"byStatus"`
+}
+
+// seedRooms creates rooms of user 1 a day apart, oldest first, and one room of somebody else
+func seedRooms(t *testing.T, db *gorm.DB) time.Time {
+	t.Helper()
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rooms := []struct {
+		name     string
+		language string
+		status   models.Status
+		tags     []string
+	}{
+		{"Backend pairing", "go", models.Ended, []string{"backend"}},
+		{"Frontend screening", "javascript", models.Active, []string{"frontend"}},
+		{"Backend final", "go", models.Archived, []string{"backend", "senior"}},
+		{"Algorithms warmup", "python", models.Active, nil},
+		{"Scheduled chat", "go", models.Scheduled, nil},
+	}
+	for i, seed := range rooms {
+		room := models.Room{
+			RoomID:    "room-" + string(rune('a'+i)),
+			Name:      seed.name,
+			Language:  seed.language,
+			CreatedBy: 1,
+			CreatedAt: day.AddDate(0, 0, i),
+			UpdatedAt: day.AddDate(0, 0, len(rooms)-i),
+		}
+		if err := db.Create(&room).Error; err != nil {
+			t.Fatal(err)
+		}
+		// UpdateColumn keeps the seeded updated_at
+		db.Model(&room).UpdateColumn("status", seed.status)
+		for _, tag := range seed.tags {
+			db.Create(&models.RoomTag{RoomID: room.RoomID, Tag: tag})
+		}
+	}
+	db.Create(&models.Client{RoomID: "room-b", UserID: 7, JoinedAt: day})
+	db.Create(&models.Room{RoomID: "other", Name: "Backend of somebody else", Language: "go", CreatedBy: 2, CreatedAt: day})
+	return day
+}
+
+func listRoomsRouter(h *Handler) *gin.Engine {
+	r := gin.New()
+	r.GET("/rooms", func(c *gin.Context) { c.Set("userId", uint(1)) }, h.ListRooms)
+	return r
+}
+
+func listRooms(t *testing.T, r *gin.Engine, query string) (int, roomPage) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rooms?"+query, nil))
+	var page roomPage
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, page
+}
+
+func roomNames(rooms []models.Room) string {
+	names := make([]string, len(rooms))
+	for i, room := range rooms {
+		names[i] = room.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestListRoomsFilters(t *testing.T) {
+	h := &Handler{
+		DB:  newTestDB(t, &models.Room{}, &models.RoomTag{}, &models.Client{}),
+		hub: &testHub{},
+	}
+	seedRooms(t, h.DB)
+	r := listRoomsRouter(h)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "Scheduled chat, Algorithms warmup, Backend final, Frontend screening, Backend pairing"},
+		{"status=active", "Algorithms warmup, Frontend screening"},
+		{"status=ended,archived", "Backend final, Backend pairing"},
+		{"language=go", "Scheduled chat, Backend final, Backend pairing"},
+		{"tag=senior,frontend", "Backend final, Frontend screening"},
+		{"tag=Backend", "Backend final, Backend pairing"},
+		{"participant=7", "Frontend screening"},
+		{"from=2026-03-02&to=2026-03-03", "Backend final, Frontend screening"},
+		{"from=2026-03-02T12:00:01Z", "Scheduled chat, Algorithms warmup, Backend final"},
+		{"sort=name", "Algorithms warmup, Backend final, Backend pairing, Frontend screening, Scheduled chat"},
+		{"sort=-updated_at", "Backend pairing, Frontend screening, Backend final, Algorithms warmup, Scheduled chat"},
+		{"language=go&status=scheduled", "Scheduled chat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			code, page := listRooms(t, r, tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("got %d", code)
+			}
+			if got := roomNames(page.Rooms); got != tt.want {
+				t.Errorf("rooms = %s, want %s", got, tt.want)
+			}
+			if page.Total != int64(len(page.Rooms)) {
+				t.Errorf("total = %d for %d rooms", page.Total, len(page.Rooms))
+			}
+		})
+	}
+
+	// the per status numbers ignore the status filter but not the others
+	_, page := listRooms(t, r, "status=ended&language=go")
+	want := map[string]int64{"active": 0, "ended": 1, "archived": 1, "scheduled": 1}
+	for status, count := range want {
+		if page.ByStatus[status] != count {
+			t.Errorf("byStatus = %v, want %v", page.ByStatus, want)
+			break
+		}
+	}
+
+	for _, query := range []string{"status=open", "sort=language", "limit=0", "limit=101", "from=yesterday", "participant=me", "cursor=garbage"} {
+		if code, _ := listRooms(t, r, query); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, code)
+		}
+	}
+}
+
+func TestListRoomsPagination(t *testing.T) {
+	h := &Handler{
+		DB:  newTestDB(t, &models.Room{}, &models.RoomTag{}, &models.Client{}),
+		hub: &testHub{},
+	}
+	seedRooms(t, h.DB)
+	r := listRoomsRouter(h)
+
+	for _, sort := range []string{"-created_at", "created_at", "name", "-name", "updated_at"} {
+		t.Run(sort, func(t *testing.T) {
+			_, all := listRooms(t, r, "sort="+sort)
+			var paged []models.Room
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatal("paging doesn't end")
+				}
+				code, page := listRooms(t, r, "sort="+sort+"&limit=2&cursor="+url.QueryEscape(cursor))
+				if code != http.StatusOK {
+					t.Fatalf("got %d", code)
+				}
+				if page.Total != 5 {
+					t.Errorf("total = %d on every page", page.Total)
+				}
+				paged = append(paged, page.Rooms...)
+				if cursor = page.NextCursor; cursor == "" {
+					break
+				}
+			}
+			if roomNames(paged) != roomNames(all.Rooms) {
+				t.Errorf("pages = %s, want %s", roomNames(paged), roomNames(all.Rooms))
+			}
+		})
+	}
+}
+
+// the full text search only exists on Postgres, sqlite can only check what we ask for
+func TestListRoomsSearchQuery(t *testing.T) {
+	db := newTestDB(t, &models.Room{})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/rooms?q="+url.QueryEscape(" backend -final "), nil)
+	filters, ok := roomFilters(c)
+	if !ok {
+		t.Fatal("q rejected")
+	}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Scopes(filters).Find(&[]models.Room{}).Statement
+	if !strings.Contains(stmt.SQL.String(), "to_tsvector('simple', name) @@ websearch_to_tsquery('simple', ?)") {
+		t.Errorf("sql = %s", stmt.SQL.String())
+	}
+	if len(stmt.Vars) != 1 || stmt.Vars[0] != "backend -final" {
+		t.Errorf("vars = %v", stmt.Vars)
+	}
+}
+
+// TEST_POSTGRES_DSN points at a scratch database, the test creates and drops its own tables
+func TestListRoomsSearchPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []interface{}{&models.Room{}, &models.RoomTag{}, &models.Client{}}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Migrator().DropTable(tables...) })
+	seedRooms(t, db)
+	r := listRoomsRouter(&Handler{DB: db, hub: &testHub{}})
+
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"backend", "Backend final, Backend pairing"},
+		{"BACKEND final", "Backend final"},
+		{"backend -final", "Backend pairing"},
+		{"screening or warmup", "Algorithms warmup, Frontend screening"},
+		{`"chat scheduled"`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			code, page := listRooms(t, r, "q="+url.QueryEscape(tt.q))
+			if code != http.StatusOK {
+				t.Fatalf("got %d", code)
+			}
+			if got := roomNames(page.Rooms); got != tt.want {
+				t.Errorf("rooms = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
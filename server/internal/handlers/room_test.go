@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/config"
+	"geekCode/internal/languages"
+	"geekCode/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func roomTestRouter(t *testing.T) (*gin.Engine, *Handler, *testHub) {
+	t.Helper()
+	hub := &testHub{}
+	h := &Handler{
+		DB:        newTestDB(t, &models.Room{}, &models.RoomTag{}, &models.Problem{}, &models.Submission{}),
+		cfg:       &config.Config{RoomDeleteRetention: 24 * time.Hour},
+		hub:       hub,
+		languages: languages.Default(),
+	}
+	// what the rbac middleware leaves behind
+	loadRoom := func(c *gin.Context) {
+		var room models.Room
+		if err := h.DB.First(&room, "room_id = ?", c.Param("roomId")).Error; err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Set("room", &room)
+	}
+	r := gin.New()
+	r.PUT("/rooms/:roomId/end", loadRoom, h.EndRoom)
+	r.PUT("/rooms/:roomId/reopen", loadRoom, h.ReopenRoom)
+	r.PUT("/rooms/:roomId/archive", loadRoom, h.ArchiveRoom)
+	r.PUT("/rooms/:roomId/unarchive", loadRoom, h.UnarchiveRoom)
+	r.PATCH("/rooms/:roomId", loadRoom, h.UpdateRoom)
+	r.DELETE("/rooms/:roomId", loadRoom, h.DeleteRoom)
+	return r, h, hub
+}
+
+func roomRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestRoomLifecycle(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   models.Status
+		action string
+		want   int
+		to     models.Status
+		closes bool
+	}{
+		{"end an active room", models.Active, "end", http.StatusOK, models.Ended, true},
+		{"end a scheduled room", models.Scheduled, "end", http.StatusOK, models.Ended, true},
+		{"end an ended room", models.Ended, "end", http.StatusConflict, models.Ended, false},
+		{"end an archived room", models.Archived, "end", http.StatusConflict, models.Archived, false},
+		{"reopen an ended room", models.Ended, "reopen", http.StatusOK, models.Active, false},
+		{"reopen an active room", models.Active, "reopen", http.StatusConflict, models.Active, false},
+		{"reopen an archived room", models.Archived, "reopen", http.StatusConflict, models.Archived, false},
+		{"archive an ended room", models.Ended, "archive", http.StatusOK, models.Archived, false},
+		{"archive an active room", models.Active, "archive", http.StatusConflict, models.Active, false},
+		{"unarchive an archived room", models.Archived, "unarchive", http.StatusOK, models.Ended, false},
+		{"unarchive an ended room", models.Ended, "unarchive", http.StatusConflict, models.Ended, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, h, hub := roomTestRouter(t)
+			autoEnd := time.Now().Add(time.Hour)
+			room := models.Room{RoomID: "room-1", Name: "interview", CreatedBy: 1, Status: tt.from, AutoEndAt: &autoEnd}
+			if err := h.DB.Create(&room).Error; err != nil {
+				t.Fatal(err)
+			}
+			// gorm skips the zero status on create and writes the default
+			h.DB.Model(&room).Update("status", tt.from)
+
+			w := roomRequest(r, http.MethodPut, "/rooms/room-1/"+tt.action, "")
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			var stored models.Room
+			h.DB.First(&stored, room.ID)
+			if stored.Status != tt.to {
+				t.Errorf("status %s, want %s", stored.Status, tt.to)
+			}
+			if closed := len(hub.closed) > 0; closed != tt.closes {
+				t.Errorf("hub closed the room: %v, want %v", closed, tt.closes)
+			}
+
+			switch {
+			case tt.want != http.StatusOK:
+			case tt.to == models.Ended && tt.from != models.Archived:
+				if stored.EndedAt == nil {
+					t.Error("ended room without ended_at")
+				}
+			case tt.to == models.Active:
+				if stored.EndedAt != nil || stored.AutoEndAt != nil {
+					t.Errorf("reopened room still ends: %v %v", stored.EndedAt, stored.AutoEndAt)
+				}
+			}
+			// only a room that was running has anything to capture
+			var captured int64
+			h.DB.Model(&models.Submission{}).Count(&captured)
+			if wantCaptured := tt.from == models.Active && tt.to == models.Ended; (captured == 1) != wantCaptured {
+				t.Errorf("%d submissions captured", captured)
+			}
+		})
+	}
+}
+
+func TestUpdateRoom(t *testing.T) {
+	r, h, _ := roomTestRouter(t)
+	h.DB.Create(&models.Room{RoomID: "room-1", Name: "interview", CreatedBy: 1, Language: "go"})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"nothing", `{}`, http.StatusBadRequest},
+		{"unknown language", `{"language":"cobol"}`, http.StatusBadRequest},
+		{"empty name", `{"name":""}`, http.StatusBadRequest},
+		{"too many tags", `{"tags":["a","b","c","d","e","f","g","h","i","j","k"]}`, http.StatusBadRequest},
+		{"rename, alias and tags", `{"name":"final round","language":"C++","tags":["Senior"," backend ","senior"]}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := roomRequest(r, http.MethodPatch, "/rooms/room-1", tt.body); w.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var room models.Room
+	h.DB.Preload("Tags").First(&room, "room_id = ?", "room-1")
+	if room.Name != "final round" || room.Language != "cpp" {
+		t.Errorf("room = %q in %q", room.Name, room.Language)
+	}
+	var tags []string
+	for _, tag := range room.Tags {
+		tags = append(tags, tag.Tag)
+	}
+	if strings.Join(tags, ",") != "senior,backend" && strings.Join(tags, ",") != "backend,senior" {
+		t.Errorf("tags = %v", tags)
+	}
+
+	// rescheduling only works before the room ended
+	h.DB.Model(&room).Update("status", models.Ended)
+	if w := roomRequest(r, http.MethodPatch, "/rooms/room-1", `{"durationMinutes":30}`); w.Code != http.StatusConflict {
+		t.Errorf("rescheduling an ended room: %d", w.Code)
+	}
+}
+
+func TestDeleteRoom(t *testing.T) {
+	r, h, hub := roomTestRouter(t)
+	h.DB.Create(&models.Room{RoomID: "room-1", Name: "interview", CreatedBy: 1})
+
+	w := roomRequest(r, http.MethodDelete, "/rooms/room-1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		PurgeAt time.Time `json:"purgeAt"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if until := time.Until(resp.PurgeAt); until < 23*time.Hour || until > 25*time.Hour {
+		t.Errorf("purged in %s, want the retention", until)
+	}
+	if len(hub.closed) != 1 || hub.closed[0] != "room-1" {
+		t.Errorf("closed rooms = %v", hub.closed)
+	}
+
+	// gone for everybody, but kept until the purge
+	var visible, kept int64
+	h.DB.Model(&models.Room{}).Count(&visible)
+	h.DB.Unscoped().Model(&models.Room{}).Count(&kept)
+	if visible != 0 || kept != 1 {
+		t.Errorf("%d visible and %d kept rooms", visible, kept)
+	}
+	if w := roomRequest(r, http.MethodDelete, "/rooms/room-1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("deleting twice: %d", w.Code)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"fmt"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRubricScale = 4
+	maxRubricCriteria  = 20
+)
+
+// used for rooms without a rubric of their own
+var defaultRubric = models.Rubric{
+	Name: "Default",
+	Criteria: []models.RubricCriterion{
+		{Key: "problem_solving", Label: "Problem solving", Weight: 1},
+		{Key: "code_quality", Label: "Code quality", Weight: 1},
+		{Key: "communication", Label: "Communication", Weight: 1},
+		{Key: "testing", Label: "Testing and edge cases", Weight: 1},
+	},
+	Scale: defaultRubricScale,
+}
+
+type RubricRequest struct {
+	Name     string                   `json:"name" binding:"required,max=100"`
+	Criteria []models.RubricCriterion `json:"criteria" binding:"required,min=1,max=20"`
+	Scale    int                      `json:"scale" binding:"omitempty,min=2,max=10"` // defaults to 4
+	OrgID    *uint                    `json:"orgId"`                                  // optional, shares the rubric with the org
+}
+
+type UpdateRubricRequest struct {
+	Name     *string                   `json:"name" binding:"omitempty,min=1,max=100"`
+	Criteria *[]models.RubricCriterion `json:"criteria" binding:"omitempty,min=1,max=20"`
+	Scale    *int                      `json:"scale" binding:"omitempty,min=2,max=10"`
+}
+
+func (h *Handler) CreateRubric(c *gin.Context) {
+	var req RubricRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	if !h.canUseOwned(c, userId, userId, req.OrgID, rbac.RubricEdit) {
+		return
+	}
+	criteria, err := normalizeCriteria(req.Criteria)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Scale == 0 {
+		req.Scale = defaultRubricScale
+	}
+
+	rubric := models.Rubric{
+		Name:      req.Name,
+		Criteria:  criteria,
+		Scale:     req.Scale,
+		OrgID:     req.OrgID,
+		CreatedBy: userId,
+	}
+	if err := h.DB.Create(&rubric).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create rubric"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"rubric": rubric})
+}
+
+// the user's own rubrics, or the org's with ?orgId=
+func (h *Handler) ListRubrics(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	scope, ok := h.ownedScope(c, userId)
+	if !ok {
+		return
+	}
+
+	var rubrics []models.Rubric
+	if err := h.DB.Scopes(scope).Order("name").Find(&rubrics).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rubrics"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rubrics": rubrics, "default": defaultRubric})
+}
+
+func (h *Handler) GetRubric(c *gin.Context) {
+	rubricID, ok := uintParam(c, "rubricId")
+	if !ok {
+		return
+	}
+	rubric, ok := h.findRubric(c, rubricID, rbac.OrgView)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rubric": rubric})
+}
+
+// scorecards keep their own copy of the criteria, so changing a rubric only affects new feedback
+func (h *Handler) UpdateRubric(c *gin.Context) {
+	var req UpdateRubricRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rubricID, ok := uintParam(c, "rubricId")
+	if !ok {
+		return
+	}
+	rubric, ok := h.findRubric(c, rubricID, rbac.RubricEdit)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		rubric.Name = *req.Name
+	}
+	if req.Criteria != nil {
+		criteria, err := normalizeCriteria(*req.Criteria)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rubric.Criteria = criteria
+	}
+	if req.Scale != nil {
+		rubric.Scale = *req.Scale
+	}
+	if err := h.DB.Save(rubric).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update rubric"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rubric": rubric})
+}
+
+func (h *Handler) DeleteRubric(c *gin.Context) {
+	rubricID, ok := uintParam(c, "rubricId")
+	if !ok {
+		return
+	}
+	rubric, ok := h.findRubric(c, rubricID, rbac.RubricEdit)
+	if !ok {
+		return
+	}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// rooms fall back to the default rubric, written scorecards keep their copy
+		if err := tx.Model(&models.Room{}).Where("rubric_id = ?", rubric.ID).Update("rubric_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(rubric).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete rubric"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "rubric deleted"})
+}
+
+func (h *Handler) findRubric(c *gin.Context, rubricID uint, perm rbac.Permission) (*models.Rubric, bool) {
+	var rubric models.Rubric
+	if err := h.DB.First(&rubric, rubricID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rubric not found"})
+		return nil, false
+	}
+	userId := c.MustGet("userId").(uint)
+	if !h.canUseOwned(c, userId, rubric.CreatedBy, rubric.OrgID, perm) {
+		return nil, false
+	}
+	return &rubric, true
+}
+
+// the rubric the room is scored on
+func (h *Handler) roomRubric(room *models.Room) (models.Rubric, error) {
+	if room.RubricID == nil {
+		return defaultRubric, nil
+	}
+	var rubric models.Rubric
+	err := h.DB.First(&rubric, *room.RubricID).Error
+	return rubric, err
+}
+
+// keys are derived from the labels when missing and have to be unique, the weight defaults to 1
+func normalizeCriteria(criteria []models.RubricCriterion) ([]models.RubricCriterion, error) {
+	if len(criteria) == 0 || len(criteria) > maxRubricCriteria {
+		return nil, fmt.Errorf("a rubric needs between 1 and %d criteria", maxRubricCriteria)
+	}
+	seen := make(map[string]bool, len(criteria))
+	normalized := make([]models.RubricCriterion, 0, len(criteria))
+	for _, criterion := range criteria {
+		criterion.Label = strings.TrimSpace(criterion.Label)
+		if criterion.Label == "" {
+			return nil, fmt.Errorf("every criterion needs a label")
+		}
+		if criterion.Key == "" {
+			criterion.Key = strings.ReplaceAll(strings.ToLower(criterion.Label), " ", "_")
+		}
+		criterion.Key = strings.TrimSpace(criterion.Key)
+		if seen[criterion.Key] {
+			return nil, fmt.Errorf("duplicate criterion %q", criterion.Key)
+		}
+		seen[criterion.Key] = true
+		if criterion.Weight < 0 {
+			return nil, fmt.Errorf("criterion weights can't be negative")
+		}
+		if criterion.Weight == 0 {
+			criterion.Weight = 1
+		}
+		normalized = append(normalized, criterion)
+	}
+	return normalized, nil
+}
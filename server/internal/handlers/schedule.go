@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+	"geekCode/internal/calendar"
+	"geekCode/internal/mailer"
+	"geekCode/internal/models"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rooms scheduled without a duration still need an end in the calendar
+const defaultInviteDuration = time.Hour
+
+// applySchedule validates the attendees and start time and works out the status and auto end of the room
+func (h *Handler) applySchedule(c *gin.Context, room *models.Room, start *time.Time, attendees []models.Attendee) bool {
+	normalized, err := normalizeAttendees(attendees)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	room.Attendees = normalized
+
+	if start == nil {
+		return true
+	}
+	// a minute of slack for clock differences between the browser and us
+	if start.Before(time.Now().Add(-time.Minute)) && (room.ScheduledStart == nil || !start.Equal(*room.ScheduledStart)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scheduledStart must be in the future"})
+		return false
+	}
+
+	utc := start.UTC()
+	room.ScheduledStart = &utc
+	room.AutoEndAt = h.window.AutoEnd(utc, room.DurationMinutes)
+	if time.Now().Before(h.window.Opens(utc)) {
+		room.Status = models.Scheduled
+	} else {
+		room.Status = models.Active
+	}
+	return true
+}
+
+// the invite as an .ics file, for "add to calendar" buttons
+func (h *Handler) RoomCalendar(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+	event, ok := h.roomEvent(c, room)
+	if !ok {
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="interview.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", calendar.ICS(event))
+}
+
+// mails the invite to every attendee, the response lists the ones that failed
+func (h *Handler) SendRoomInvites(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+	event, ok := h.roomEvent(c, room)
+	if !ok {
+		return
+	}
+	if len(room.Attendees) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the room has no attendees"})
+		return
+	}
+
+	ics := calendar.ICS(event)
+	body := fmt.Sprintf("You are invited to the interview \"%s\".\n\nStarts: %s\nJoin here: %s\n\nThe room opens %d minutes before the start.\n",
+		room.Name, event.Start.Format("Mon, 02 Jan 2006 15:04 MST"), event.URL, int(h.window.Early.Minutes()))
+
+	sent := 0
+	failed := []string{}
+	for _, attendee := range room.Attendees {
+		err := h.mailer.Send(c.Request.Context(), mailer.Message{
+			To:      attendee.Email,
+			Subject: "Interview invitation: " + room.Name,
+			Body:    body,
+			Attachments: []mailer.Attachment{{
+				Filename:    "invite.ics",
+				ContentType: "text/calendar; charset=utf-8; method=REQUEST",
+				Data:        ics,
+			}},
+		})
+		if err != nil {
+			log.Printf("Failed to send invite for room %s to %s: %v", room.RoomID, attendee.Email, err)
+			failed = append(failed, attendee.Email)
+			continue
+		}
+		sent++
+	}
+
+	status := http.StatusOK
+	if sent == 0 {
+		status = http.StatusBadGateway
+	}
+	c.JSON(status, gin.H{"sent": sent, "failed": failed})
+}
+
+func (h *Handler) roomEvent(c *gin.Context, room *models.Room) (calendar.Event, bool) {
+	if room.ScheduledStart == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "the room is not scheduled"})
+		return calendar.Event{}, false
+	}
+	duration := defaultInviteDuration
+	if room.DurationMinutes > 0 {
+		duration = time.Duration(room.DurationMinutes) * time.Minute
+	}
+
+	var organizer models.User
+	if err := h.DB.First(&organizer, room.CreatedBy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build the invite"})
+		return calendar.Event{}, false
+	}
+
+	attendees := make([]calendar.Attendee, 0, len(room.Attendees))
+	for _, a := range room.Attendees {
+		attendees = append(attendees, calendar.Attendee{Name: a.Name, Email: a.Email})
+	}
+	link := h.frontendBase() + "/code/" + room.RoomID
+
+	return calendar.Event{
+		UID:         room.RoomID + "@geekcode",
+		Sequence:    room.InviteSequence,
+		Start:       *room.ScheduledStart,
+		End:         room.ScheduledStart.Add(duration),
+		Summary:     "Interview: " + room.Name,
+		Description: "Join the interview room: " + link,
+		URL:         link,
+		Organizer:   calendar.Attendee{Name: strings.TrimSpace(organizer.FirstName + " " + organizer.LastName), Email: organizer.Email},
+		Attendees:   attendees,
+		Cancelled:   room.Status == models.Ended && room.EndedAt != nil && room.EndedAt.Before(*room.ScheduledStart),
+	}, true
+}
+
+func normalizeAttendees(attendees []models.Attendee) ([]models.Attendee, error) {
+	seen := make(map[string]bool, len(attendees))
+	normalized := make([]models.Attendee, 0, len(attendees))
+	for _, a := range attendees {
+		addr, err := mail.ParseAddress(a.Email)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attendee email %q", a.Email)
+		}
+		email := strings.ToLower(addr.Address)
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		if a.Role != "" && a.Role != "interviewer" && a.Role != "candidate" {
+			return nil, fmt.Errorf("attendee role must be interviewer or candidate")
+		}
+		normalized = append(normalized, models.Attendee{Email: email, Name: cleanName(a.Name), Role: a.Role})
+	}
+	return normalized, nil
+}
+
+// names end up in invites and mail headers, where a line break would start a property or header of its own
+func cleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
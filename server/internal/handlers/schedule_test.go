@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+
+	"geekCode/internal/models"
+)
+
+func TestNormalizeAttendees(t *testing.T) {
+	got, err := normalizeAttendees([]models.Attendee{
+		{Email: "Ann@Example.com", Name: "  Ann\r\nATTENDEE:mailto:eve@example.com "},
+		{Email: "ann@example.com", Name: "duplicate"},
+		{Email: "bob@example.com", Name: "Bob\t\x00Builder", Role: "interviewer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Attendee{
+		{Email: "ann@example.com", Name: "Ann ATTENDEE:mailto:eve@example.com"},
+		{Email: "bob@example.com", Name: "Bob Builder", Role: "interviewer"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("attendee %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	for _, bad := range []models.Attendee{
+		{Email: "not an address"},
+		{Email: "eve@example.com\r\nBcc: everyone@example.com"},
+		{Email: "eve@example.com", Role: "owner"},
+	} {
+		if _, err := normalizeAttendees([]models.Attendee{bad}); err == nil {
+			t.Errorf("%+v was accepted", bad)
+		}
+	}
+}
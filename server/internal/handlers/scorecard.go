@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ScorecardRequest struct {
+	Ratings        []models.CriterionRating `json:"ratings" binding:"max=20"`
+	Notes          string                   `json:"notes" binding:"max=20000"`
+	Recommendation models.Recommendation    `json:"recommendation" binding:"omitempty,oneof=strong_no_hire no_hire hire strong_hire"`
+	Submit         bool                     `json:"submit"` // final, the scorecard can't change afterwards
+}
+
+type criterionSummary struct {
+	Criterion string  `json:"criterion"`
+	Label     string  `json:"label"`
+	Score     float64 `json:"score"` // average rating mapped onto 0..1 so different scales compare
+	Ratings   int     `json:"ratings"`
+}
+
+type scorecardSummary struct {
+	Scorecards      int                           `json:"scorecards"`
+	Criteria        []criterionSummary            `json:"criteria"`
+	OverallScore    *float64                      `json:"overallScore"` // weighted, 0..1, nil without any ratings
+	Recommendations map[models.Recommendation]int `json:"recommendations"`
+}
+
+// the caller's own scorecard for the room (nil before the first save) and the rubric to fill in
+func (h *Handler) GetMyScorecard(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+	userId := c.MustGet("userId").(uint)
+
+	rubric, err := h.roomRubric(room)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load the rubric"})
+		return
+	}
+	scorecard, err := h.findScorecard(room.RoomID, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load the scorecard"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scorecard": scorecard, "rubric": rubric})
+}
+
+// saves a draft, or submits it with "submit": true which needs every criterion rated and a recommendation
+func (h *Handler) SaveScorecard(c *gin.Context) {
+	var req ScorecardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	room := c.MustGet("room").(*models.Room)
+	userId := c.MustGet("userId").(uint)
+	if room.Status == models.Scheduled {
+		c.JSON(http.StatusConflict, gin.H{"error": "the interview hasn't started yet"})
+		return
+	}
+
+	scorecard, err := h.findScorecard(room.RoomID, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load the scorecard"})
+		return
+	}
+	if scorecard == nil {
+		rubric, err := h.roomRubric(room)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load the rubric"})
+			return
+		}
+		scorecard = &models.Scorecard{
+			RoomID:        room.RoomID,
+			InterviewerID: userId,
+			RubricID:      room.RubricID,
+			Criteria:      rubric.Criteria,
+			Scale:         rubric.Scale,
+		}
+	}
+	if scorecard.SubmittedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "the scorecard was already submitted"})
+		return
+	}
+
+	if err := validateRatings(scorecard, req.Ratings, req.Submit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Submit && req.Recommendation == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a recommendation is required to submit"})
+		return
+	}
+	scorecard.CandidateID = room.CandidateID
+	scorecard.Ratings = req.Ratings
+	scorecard.Notes = strings.TrimSpace(req.Notes)
+	scorecard.Recommendation = req.Recommendation
+	if req.Submit {
+		now := time.Now()
+		scorecard.SubmittedAt = &now
+	}
+
+	if err := h.DB.Save(scorecard).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save the scorecard"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scorecard": scorecard})
+}
+
+// every submitted scorecard of the room with the aggregate, drafts only show up in the pending count
+func (h *Handler) ListRoomScorecards(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+
+	var scorecards []models.Scorecard
+	if err := h.DB.Where("room_id = ? AND submitted_at IS NOT NULL", room.RoomID).Order("submitted_at").Find(&scorecards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch scorecards"})
+		return
+	}
+	var pending int64
+	if err := h.DB.Model(&models.Scorecard{}).Where("room_id = ? AND submitted_at IS NULL", room.RoomID).Count(&pending).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch scorecards"})
+		return
+	}
+	interviewers, err := h.interviewerNames(scorecards)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch scorecards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scorecards":   scorecards,
+		"interviewers": interviewers,
+		"pending":      pending,
+		"summary":      summarizeScorecards(scorecards),
+	})
+}
+
+// a candidate's submitted scorecards across all the rooms the caller may see scorecards of
+func (h *Handler) CandidateScorecards(c *gin.Context) {
+	candidateID, ok := uintParam(c, "userId")
+	if !ok {
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+
+	var scorecards []models.Scorecard
+	if err := h.DB.Where("candidate_id = ? AND submitted_at IS NOT NULL", candidateID).Order("submitted_at").Find(&scorecards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch scorecards"})
+		return
+	}
+	roomIDs := make([]string, 0, len(scorecards))
+	for _, scorecard := range scorecards {
+		roomIDs = append(roomIDs, scorecard.RoomID)
+	}
+	var rooms []models.Room
+	if len(roomIDs) > 0 {
+		if err := h.DB.Where("room_id IN ?", roomIDs).Find(&rooms).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch scorecards"})
+			return
+		}
+	}
+
+	visible := make(map[string]bool, len(rooms))
+	roomNames := make(map[string]string, len(rooms))
+	for i := range rooms {
+		allowed, err := h.rbac.CanRoom(userId, &rooms[i], rbac.ScoreView)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+			return
+		}
+		if allowed {
+			visible[rooms[i].RoomID] = true
+			roomNames[rooms[i].RoomID] = rooms[i].Name
+		}
+	}
+	shown := scorecards[:0]
+	for _, scorecard := range scorecards {
+		if visible[scorecard.RoomID] {
+			shown = append(shown, scorecard)
+		}
+	}
+	interviewers, err := h.interviewerNames(shown)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch scorecards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scorecards":   shown,
+		"rooms":        roomNames,
+		"interviewers": interviewers,
+		"summary":      summarizeScorecards(shown),
+	})
+}
+
+// checks the candidate and rubric ids sent when creating or updating a room
+func (h *Handler) validateScoring(c *gin.Context, candidateID, rubricID *uint) bool {
+	if candidateID != nil {
+		var count int64
+		if err := h.DB.Model(&models.User{}).Where("id = ?", *candidateID).Count(&count).Error; err != nil || count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "candidate not found"})
+			return false
+		}
+	}
+	if rubricID != nil {
+		if _, ok := h.findRubric(c, *rubricID, rbac.OrgView); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) findScorecard(roomID string, interviewerID uint) (*models.Scorecard, error) {
+	var scorecard models.Scorecard
+	err := h.DB.Where("room_id = ? AND interviewer_id = ?", roomID, interviewerID).First(&scorecard).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &scorecard, nil
+}
+
+// full names by user id, the user model itself shouldn't end up in responses
+func (h *Handler) interviewerNames(scorecards []models.Scorecard) (map[uint]string, error) {
+	names := make(map[uint]string)
+	if len(scorecards) == 0 {
+		return names, nil
+	}
+	ids := make([]uint, 0, len(scorecards))
+	for _, scorecard := range scorecards {
+		ids = append(ids, scorecard.InterviewerID)
+	}
+	var users []models.User
+	if err := h.DB.Select("id", "first_name", "last_name").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		names[user.ID] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	return names, nil
+}
+
+// ratings must use the scorecard's criteria and scale, a submitted scorecard rates every criterion
+func validateRatings(scorecard *models.Scorecard, ratings []models.CriterionRating, complete bool) error {
+	known := make(map[string]bool, len(scorecard.Criteria))
+	for _, criterion := range scorecard.Criteria {
+		known[criterion.Key] = true
+	}
+	rated := make(map[string]bool, len(ratings))
+	for _, rating := range ratings {
+		if !known[rating.Criterion] {
+			return fmt.Errorf("unknown criterion %q", rating.Criterion)
+		}
+		if rated[rating.Criterion] {
+			return fmt.Errorf("criterion %q is rated twice", rating.Criterion)
+		}
+		rated[rating.Criterion] = true
+		if rating.Score < 1 || rating.Score > scorecard.Scale {
+			return fmt.Errorf("scores go from 1 to %d", scorecard.Scale)
+		}
+	}
+	if complete && len(rated) != len(known) {
+		return fmt.Errorf("every criterion has to be rated to submit")
+	}
+	return nil
+}
+
+func summarizeScorecards(scorecards []models.Scorecard) scorecardSummary {
+	summary := scorecardSummary{
+		Scorecards:      len(scorecards),
+		Criteria:        []criterionSummary{},
+		Recommendations: map[models.Recommendation]int{},
+	}
+	index := map[string]int{}
+	totals := map[string]float64{}
+	var overall float64
+	var overallCount int
+
+	for _, scorecard := range scorecards {
+		if scorecard.Recommendation != "" {
+			summary.Recommendations[scorecard.Recommendation]++
+		}
+		weights := make(map[string]float64, len(scorecard.Criteria))
+		for _, criterion := range scorecard.Criteria {
+			weights[criterion.Key] = criterion.Weight
+			if _, found := index[criterion.Key]; !found {
+				index[criterion.Key] = len(summary.Criteria)
+				summary.Criteria = append(summary.Criteria, criterionSummary{Criterion: criterion.Key, Label: criterion.Label})
+			}
+		}
+
+		var weighted, weightSum float64
+		for _, rating := range scorecard.Ratings {
+			score := normalizeScore(rating.Score, scorecard.Scale)
+			totals[rating.Criterion] += score
+			summary.Criteria[index[rating.Criterion]].Ratings++
+			weighted += score * weights[rating.Criterion]
+			weightSum += weights[rating.Criterion]
+		}
+		if weightSum > 0 {
+			overall += weighted / weightSum
+			overallCount++
+		}
+	}
+
+	for i, criterion := range summary.Criteria {
+		if criterion.Ratings > 0 {
+			summary.Criteria[i].Score = totals[criterion.Criterion] / float64(criterion.Ratings)
+		}
+	}
+	if overallCount > 0 {
+		score := overall / float64(overallCount)
+		summary.OverallScore = &score
+	}
+	return summary
+}
+
+// maps 1..scale onto 0..1
+func normalizeScore(score, scale int) float64 {
+	if scale <= 1 {
+		return 1
+	}
+	return float64(score-1) / float64(scale-1)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"geekCode/internal/middleware"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	owner       uint = 1 // created the personal room
+	orgAdmin    uint = 2 // created the org room
+	interviewer uint = 3 // in the org
+	outsider    uint = 4
+	candidate   uint = 5 // the candidate of both rooms
+	joined      uint = 6 // joined the org room through its link
+)
+
+// scorecardRouter wires the scorecard routes like routes.go, X-User picks the caller and X-Scopes the token scopes
+func scorecardRouter(t *testing.T) (*gin.Engine, *Handler) {
+	t.Helper()
+	db := newTestDB(t, &models.User{}, &models.Room{}, &models.Client{}, &models.OrgMember{}, &models.Rubric{}, &models.Scorecard{})
+	engine := rbac.NewEngine(db, rbac.DefaultPolicy())
+	h := &Handler{DB: db, rbac: engine}
+
+	for id := owner; id <= joined; id++ {
+		db.Create(&models.User{ID: id, FirstName: "User", LastName: strconv.Itoa(int(id)), Username: "user" + strconv.Itoa(int(id)), Email: strconv.Itoa(int(id)) + "@example.com", Password: "x"})
+	}
+	orgID := uint(1)
+	db.Create(&models.OrgMember{OrgID: orgID, UserID: orgAdmin, Role: models.OrgRoleAdmin})
+	db.Create(&models.OrgMember{OrgID: orgID, UserID: interviewer, Role: models.OrgRoleInterviewer})
+	candidateID := candidate
+	db.Create(&models.Room{RoomID: "personal", Name: "personal", CreatedBy: owner, CandidateID: &candidateID})
+	db.Create(&models.Room{RoomID: "org", Name: "org", CreatedBy: orgAdmin, OrgID: &orgID, CandidateID: &candidateID})
+	db.Create(&models.Client{RoomID: "org", UserID: joined})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.GetHeader("X-User"))
+		c.Set("userId", uint(id))
+		if scopes := c.GetHeader("X-Scopes"); scopes != "" {
+			c.Set("scopes", strings.Split(scopes, ","))
+		}
+	})
+	r.GET("/rooms/:roomId/scorecard", middleware.RequireRoomPermission(engine, rbac.ScoreSubmit), h.GetMyScorecard)
+	r.PUT("/rooms/:roomId/scorecard", middleware.RequireRoomPermission(engine, rbac.ScoreSubmit), h.SaveScorecard)
+	r.GET("/rooms/:roomId/scorecards", middleware.RequireRoomPermission(engine, rbac.ScoreView), h.ListRoomScorecards)
+	r.GET("/candidates/:userId/scorecards", middleware.RequireScope(rbac.ScoreView), h.CandidateScorecards)
+	return r, h
+}
+
+func scorecardRequest(r *gin.Engine, user uint, scopes, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User", strconv.Itoa(int(user)))
+	req.Header.Set("X-Scopes", scopes)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+const fullScorecard = `{"submit":true,"recommendation":"hire","ratings":[
+	{"criterion":"problem_solving","score":4},{"criterion":"code_quality","score":3},
+	{"criterion":"communication","score":2},{"criterion":"testing","score":1}]}`
+
+func TestScorecardPermissions(t *testing.T) {
+	r, _ := scorecardRouter(t)
+
+	tests := []struct {
+		name   string
+		user   uint
+		scopes string
+		method string
+		path   string
+		want   int
+	}{
+		{"owner writes", owner, "", http.MethodPut, "/rooms/personal/scorecard", http.StatusOK},
+		{"owner reads all", owner, "", http.MethodGet, "/rooms/personal/scorecards", http.StatusOK},
+		{"org admin writes", orgAdmin, "", http.MethodPut, "/rooms/org/scorecard", http.StatusOK},
+		{"interviewer writes", interviewer, "", http.MethodPut, "/rooms/org/scorecard", http.StatusOK},
+		{"interviewer reads all", interviewer, "", http.MethodGet, "/rooms/org/scorecards", http.StatusOK},
+		{"interviewer outside the room's org", interviewer, "", http.MethodGet, "/rooms/personal/scorecards", http.StatusNotFound},
+		{"candidate can't write", candidate, "", http.MethodPut, "/rooms/org/scorecard", http.StatusForbidden},
+		{"candidate can't read", candidate, "", http.MethodGet, "/rooms/org/scorecards", http.StatusForbidden},
+		{"joined participant can't read", joined, "", http.MethodGet, "/rooms/org/scorecards", http.StatusForbidden},
+		{"outsider doesn't see the room", outsider, "", http.MethodGet, "/rooms/org/scorecard", http.StatusNotFound},
+		{"token without the scope", interviewer, "scorecard.submit", http.MethodGet, "/rooms/org/scorecards", http.StatusForbidden},
+		{"token with the scope", interviewer, "scorecard.view", http.MethodGet, "/rooms/org/scorecards", http.StatusOK},
+		{"unknown room", owner, "", http.MethodGet, "/rooms/nope/scorecard", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.method == http.MethodPut {
+				body = fullScorecard
+			}
+			if w := scorecardRequest(r, tt.user, tt.scopes, tt.method, tt.path, body); w.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSaveScorecard(t *testing.T) {
+	r, h := scorecardRouter(t)
+	save := func(user uint, body string) *httptest.ResponseRecorder {
+		return scorecardRequest(r, user, "", http.MethodPut, "/rooms/org/scorecard", body)
+	}
+
+	for _, body := range []string{
+		`{"ratings":[{"criterion":"charisma","score":2}]}`,
+		`{"ratings":[{"criterion":"testing","score":5}]}`,
+		`{"ratings":[{"criterion":"testing","score":2},{"criterion":"testing","score":3}]}`,
+		`{"submit":true,"recommendation":"hire","ratings":[{"criterion":"testing","score":2}]}`,
+		strings.Replace(fullScorecard, `"recommendation":"hire",`, "", 1),
+		strings.Replace(fullScorecard, "hire", "maybe", 1),
+	} {
+		if w := save(interviewer, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+
+	// drafts change freely and stay out of the aggregate
+	if w := save(interviewer, `{"notes":" first impressions ","ratings":[{"criterion":"testing","score":2}]}`); w.Code != http.StatusOK {
+		t.Fatalf("draft: %d %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Scorecards []models.Scorecard `json:"scorecards"`
+		Pending    int64              `json:"pending"`
+	}
+	json.Unmarshal(scorecardRequest(r, orgAdmin, "", http.MethodGet, "/rooms/org/scorecards", "").Body.Bytes(), &list)
+	if len(list.Scorecards) != 0 || list.Pending != 1 {
+		t.Errorf("%d scorecards and %d pending with one draft", len(list.Scorecards), list.Pending)
+	}
+
+	if w := save(interviewer, fullScorecard); w.Code != http.StatusOK {
+		t.Fatalf("submit: %d %s", w.Code, w.Body.String())
+	}
+	var stored models.Scorecard
+	h.DB.First(&stored, "room_id = ? AND interviewer_id = ?", "org", interviewer)
+	if stored.SubmittedAt == nil || stored.CandidateID == nil || *stored.CandidateID != candidate || stored.Scale != defaultRubricScale {
+		t.Errorf("stored = %+v", stored)
+	}
+	if w := save(interviewer, `{"notes":"changed my mind"}`); w.Code != http.StatusConflict {
+		t.Errorf("editing a submitted scorecard: %d", w.Code)
+	}
+
+	// a scheduled interview can't be scored yet
+	h.DB.Model(&models.Room{}).Where("room_id = ?", "org").Update("status", models.Scheduled)
+	if w := save(orgAdmin, fullScorecard); w.Code != http.StatusConflict {
+		t.Errorf("scoring a scheduled room: %d", w.Code)
+	}
+}
+
+func TestCandidateScorecards(t *testing.T) {
+	r, _ := scorecardRouter(t)
+	for _, write := range []struct {
+		user uint
+		room string
+	}{{owner, "personal"}, {interviewer, "org"}, {orgAdmin, "org"}} {
+		if w := scorecardRequest(r, write.user, "", http.MethodPut, "/rooms/"+write.room+"/scorecard", fullScorecard); w.Code != http.StatusOK {
+			t.Fatalf("submit: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// everybody only gets the scorecards of the rooms they may see scorecards of
+	tests := []struct {
+		user   uint
+		scopes string
+		want   int
+		code   int
+	}{
+		{owner, "", 1, http.StatusOK},
+		{interviewer, "", 2, http.StatusOK},
+		{orgAdmin, "", 2, http.StatusOK},
+		{candidate, "", 0, http.StatusOK},
+		{outsider, "", 0, http.StatusOK},
+		{interviewer, "scorecard.submit", 0, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := scorecardRequest(r, tt.user, tt.scopes, http.MethodGet, "/candidates/"+strconv.Itoa(int(candidate))+"/scorecards", "")
+		if w.Code != tt.code {
+			t.Errorf("user %d: got %d, want %d", tt.user, w.Code, tt.code)
+			continue
+		}
+		var resp struct {
+			Scorecards   []models.Scorecard `json:"scorecards"`
+			Interviewers map[string]string  `json:"interviewers"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.Scorecards) != tt.want || len(resp.Interviewers) != tt.want {
+			t.Errorf("user %d sees %d scorecards by %v, want %d", tt.user, len(resp.Scorecards), resp.Interviewers, tt.want)
+		}
+		if strings.Contains(w.Body.String(), "@example.com") {
+			t.Errorf("user %d: the response leaks emails", tt.user)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"geekCode/internal/similarity"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxSimilarityCandidates  = 500 // past submissions compared per report, newest first
+	defaultSimilarityMatches = 10
+	maxSimilarityMatches     = 50
+)
+
+type SimilarityMatch struct {
+	RoomID      string     `json:"roomId,omitempty"` // these only for rooms the caller can view, the room id is the join link
+	Name        string     `json:"name,omitempty"`
+	CandidateID *uint      `json:"candidateId,omitempty"`
+	EndedAt     *time.Time `json:"endedAt,omitempty"`
+	Problems    []uint     `json:"problems"` // the problems both rooms used
+	similarity.Score
+
+	room *models.Room
+}
+
+// compares what the room ended with against past submissions for the same problems, closest first.
+// the starter files of both rooms are left out so shared boilerplate doesn't count as copying
+func (h *Handler) RoomSimilarity(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+	userId := c.MustGet("userId").(uint)
+
+	limit := defaultSimilarityMatches
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxSimilarityMatches {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxSimilarityMatches)})
+			return
+		}
+		limit = parsed
+	}
+
+	var submission models.Submission
+	if err := h.DB.Where("room_id = ?", room.RoomID).First(&submission).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "nothing was captured when the room ended"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch the submission"})
+		return
+	}
+
+	// the join table points at rooms.id rather than the public room id
+	var problemIDs []uint
+	if err := h.DB.Table("room_problems").Where("room_id = ?", room.ID).Pluck("problem_id", &problemIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch the room's problems"})
+		return
+	}
+	mine := similarity.Files(submission.Files).Without(similarity.Files(room.Files))
+	if len(problemIDs) == 0 || len(mine) == 0 {
+		c.JSON(http.StatusOK, gin.H{"matches": []SimilarityMatch{}, "compared": 0, "fingerprints": len(mine)})
+		return
+	}
+
+	// the newest submissions of other (not deleted) rooms that used one of the problems, picked in the database
+	// so a popular problem doesn't load every room that ever used it
+	var submissions []models.Submission
+	if err := h.DB.Model(&models.Submission{}).
+		Joins("JOIN rooms ON rooms.room_id = submissions.room_id AND rooms.deleted_at IS NULL").
+		Where("rooms.id <> ? AND EXISTS (SELECT 1 FROM room_problems WHERE room_problems.room_id = rooms.id AND room_problems.problem_id IN ?)", room.ID, problemIDs).
+		Order("submissions.updated_at DESC").
+		Limit(maxSimilarityCandidates).
+		Find(&submissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch past submissions"})
+		return
+	}
+	if len(submissions) == 0 {
+		c.JSON(http.StatusOK, gin.H{"matches": []SimilarityMatch{}, "compared": 0, "fingerprints": len(mine)})
+		return
+	}
+
+	roomIDs := make([]string, 0, len(submissions))
+	for _, other := range submissions {
+		roomIDs = append(roomIDs, other.RoomID)
+	}
+	var rooms []models.Room
+	if err := h.DB.Where("room_id IN ?", roomIDs).Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch past rooms"})
+		return
+	}
+	byRoomID := make(map[string]*models.Room, len(rooms))
+	ids := make([]uint, 0, len(rooms))
+	for i := range rooms {
+		byRoomID[rooms[i].RoomID] = &rooms[i]
+		ids = append(ids, rooms[i].ID)
+	}
+
+	var links []struct {
+		RoomID    uint
+		ProblemID uint
+	}
+	if err := h.DB.Table("room_problems").Select("room_id, problem_id").
+		Where("room_id IN ? AND problem_id IN ?", ids, problemIDs).Scan(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch past rooms"})
+		return
+	}
+	sharedProblems := map[uint][]uint{}
+	for _, link := range links {
+		sharedProblems[link.RoomID] = append(sharedProblems[link.RoomID], link.ProblemID)
+	}
+
+	matches := []SimilarityMatch{}
+	for _, other := range submissions {
+		otherRoom, found := byRoomID[other.RoomID]
+		if !found {
+			continue // deleted in the meantime
+		}
+		theirs := similarity.Files(other.Files).Without(similarity.Files(otherRoom.Files))
+		score := similarity.Compare(mine, theirs)
+		if score.Shared == 0 {
+			continue
+		}
+		matches = append(matches, SimilarityMatch{
+			Problems: sharedProblems[otherRoom.ID],
+			Score:    score,
+			room:     otherRoom,
+		})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Containment != matches[j].Containment {
+			return matches[i].Containment > matches[j].Containment
+		}
+		return matches[i].Jaccard > matches[j].Jaccard
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	// the scores are fine to share, who the other room was isn't
+	for i := range matches {
+		otherRoom := matches[i].room
+		allowed, err := h.rbac.CanRoom(userId, otherRoom, rbac.RoomView)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+			return
+		}
+		if allowed {
+			matches[i].RoomID = otherRoom.RoomID
+			matches[i].Name = otherRoom.Name
+			matches[i].CandidateID = otherRoom.CandidateID
+			matches[i].EndedAt = otherRoom.EndedAt
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"matches": matches, "compared": len(submissions), "fingerprints": len(mine)})
+}
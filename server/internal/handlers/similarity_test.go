@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoomSimilarityHidesRoomsTheCallerCantView(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.Room{}, &models.Problem{}, &models.Submission{}, &models.Client{}, &models.OrgMember{})
+	h := &Handler{DB: db, rbac: rbac.NewEngine(db, rbac.DefaultPolicy())}
+
+	const me, someoneElse = 1, 2
+	problem := models.Problem{Title: "two sum", CreatedBy: me}
+	db.Create(&problem)
+	code := strings.Repeat("for i := 0; i < len(nums); i++ { seen[target-nums[i]] = i }\n", 20)
+	rooms := []models.Room{
+		{RoomID: "mine", Name: "mine", CreatedBy: me},
+		{RoomID: "also-mine", Name: "also mine", CreatedBy: me},
+		{RoomID: "theirs", Name: "theirs", CreatedBy: someoneElse},
+	}
+	for i := range rooms {
+		rooms[i].Problems = []models.Problem{problem}
+		if err := db.Create(&rooms[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		db.Create(&models.Submission{RoomID: rooms[i].RoomID, Files: []models.CodeFile{{Name: "main.go", Content: code}}})
+	}
+
+	r := gin.New()
+	r.GET("/similarity", func(c *gin.Context) {
+		c.Set("room", &rooms[0])
+		c.Set("userId", uint(me))
+	}, h.RoomSimilarity)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/similarity", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Matches []map[string]any `json:"matches"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2: %s", len(resp.Matches), w.Body.String())
+	}
+	var visible, hidden int
+	for _, match := range resp.Matches {
+		switch match["roomId"] {
+		case "also-mine":
+			visible++
+		case nil:
+			if _, named := match["name"]; named {
+				t.Errorf("hidden match has a name: %v", match)
+			}
+			hidden++
+		default:
+			t.Errorf("match leaks room %v", match["roomId"])
+		}
+	}
+	if visible != 1 || hidden != 1 {
+		t.Errorf("%d visible and %d hidden matches, want one of each", visible, hidden)
+	}
+}
+
+func TestRoomSimilarityCandidates(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.Room{}, &models.Problem{}, &models.Submission{}, &models.Client{}, &models.OrgMember{})
+	h := &Handler{DB: db, rbac: rbac.NewEngine(db, rbac.DefaultPolicy())}
+
+	twoSum, threeSum, other := models.Problem{Title: "two sum"}, models.Problem{Title: "three sum"}, models.Problem{Title: "other"}
+	db.Create(&[]*models.Problem{&twoSum, &threeSum, &other})
+	code := strings.Repeat("for i := 0; i < len(nums); i++ { seen[target-nums[i]] = i }\n", 20)
+	files := []models.CodeFile{{Name: "main.go", Content: code}}
+
+	room := models.Room{RoomID: "mine", CreatedBy: 1, Problems: []models.Problem{twoSum, threeSum}}
+	db.Create(&room)
+	db.Create(&models.Submission{RoomID: "mine", Files: files})
+
+	// more past rooms than get compared, the newest ones win
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < maxSimilarityCandidates+5; i++ {
+		past := models.Room{RoomID: fmt.Sprintf("past-%d", i), CreatedBy: 1, Problems: []models.Problem{twoSum}}
+		if i == maxSimilarityCandidates+4 {
+			past.Problems = []models.Problem{twoSum, threeSum}
+		}
+		db.Create(&past)
+		db.Create(&models.Submission{RoomID: past.RoomID, Files: files, UpdatedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+	// newer still, but deleted or about another problem
+	deleted := models.Room{RoomID: "deleted", CreatedBy: 1, Problems: []models.Problem{twoSum}}
+	unrelated := models.Room{RoomID: "unrelated", CreatedBy: 1, Problems: []models.Problem{other}}
+	for _, past := range []*models.Room{&deleted, &unrelated} {
+		db.Create(past)
+		db.Create(&models.Submission{RoomID: past.RoomID, Files: files})
+	}
+	db.Delete(&deleted)
+
+	r := gin.New()
+	r.GET("/similarity", func(c *gin.Context) {
+		c.Set("room", &room)
+		c.Set("userId", uint(1))
+	}, h.RoomSimilarity)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/similarity?limit=50", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Matches []struct {
+			RoomID   string `json:"roomId"`
+			Problems []uint `json:"problems"`
+		} `json:"matches"`
+		Compared int `json:"compared"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Compared != maxSimilarityCandidates {
+		t.Errorf("compared %d submissions, want %d", resp.Compared, maxSimilarityCandidates)
+	}
+	for _, match := range resp.Matches {
+		switch match.RoomID {
+		case "deleted", "unrelated", "past-0", "past-1", "past-2", "past-3", "past-4":
+			t.Errorf("compared against %s", match.RoomID)
+		case fmt.Sprintf("past-%d", maxSimilarityCandidates+4):
+			if len(match.Problems) != 2 {
+				t.Errorf("shared problems of %s = %v", match.RoomID, match.Problems)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"geekCode/internal/assistant"
+	"geekCode/internal/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// writing a summary is cut off after this, so a pending summary older than summaryStaleAfter
+	// lost its writer (a crash or a restart) and may be claimed again
+	summaryWriteTimeout = 5 * time.Minute
+	summaryStaleAfter   = 2 * summaryWriteTimeout
+)
+
+// the summary and what it was written from
+func (h *Handler) GetRoomSummary(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+
+	var summary models.RoomSummary
+	summaryErr := h.DB.Where("room_id = ?", room.RoomID).First(&summary).Error
+	var submission models.Submission
+	submissionErr := h.DB.Where("room_id = ?", room.RoomID).First(&submission).Error
+	for _, err := range []error{summaryErr, submissionErr} {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch the summary"})
+			return
+		}
+	}
+	if summaryErr != nil && submissionErr != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "the room has no summary"})
+		return
+	}
+
+	response := gin.H{"summary": nil, "submission": nil}
+	if summaryErr == nil {
+		if summary.Status == models.SummaryPending && time.Since(summary.UpdatedAt) > summaryStaleAfter {
+			summary.Status = models.SummaryFailed
+			summary.Error = "writing the summary was interrupted, please try again"
+		}
+		response["summary"] = summary
+	}
+	if submissionErr == nil {
+		response["submission"] = submission
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// (re)writes the summary of an ended room in the background, poll GET for the result
+func (h *Handler) GenerateRoomSummary(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+	if room.Status != models.Ended && room.Status != models.Archived {
+		c.JSON(http.StatusConflict, gin.H{"error": "the room has to be ended first"})
+		return
+	}
+	if h.assistant.Provider() == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": assistant.ErrDisabled.Error()})
+		return
+	}
+	var submission models.Submission
+	if err := h.DB.Where("room_id = ?", room.RoomID).First(&submission).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "nothing was captured when the room ended"})
+		return
+	}
+
+	summary, claimed, err := h.startSummary(room)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start the summary"})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "the summary is already being written"})
+		return
+	}
+	// whoever asks for it pays for it, not the room owner
+	go h.writeSummary(*room, submission, c.MustGet("userId").(uint))
+	c.JSON(http.StatusAccepted, gin.H{"summary": summary})
+}
+
+// RoomEnded finishes a room that was active until now, whether it was ended by hand or by the scheduler
+func (h *Handler) RoomEnded(room *models.Room, reason string) {
+	h.captureSubmission(room)
+	h.hub.CloseRoom(room.RoomID, reason)
+}
+
+// keeps what the room ended with, and starts the summary when ASSISTANT_SUMMARIES is on.
+// has to run before the hub closes the room, closing drops the live document
+func (h *Handler) captureSubmission(room *models.Room) {
+	submission := h.hub.Submission(room.RoomID)
+	if submission == nil {
+		// nobody touched the editor since the server started and nothing was saved, the starter files are all there is
+		submission = &models.Submission{RoomID: room.RoomID, Language: room.Language, Files: room.Files}
+	}
+	err := h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"language", "files", "runs", "timeline", "updated_at"}),
+	}).Create(submission).Error
+	if err != nil {
+		log.Printf("Failed to save the submission of room %s: %v", room.RoomID, err)
+		return
+	}
+
+	if !h.cfg.AssistantSummaries || h.assistant.Provider() == "" {
+		return
+	}
+	// nobody asked for this one, so the room owner's quota pays for it
+	if _, claimed, err := h.startSummary(room); err == nil && claimed {
+		go h.writeSummary(*room, *submission, room.CreatedBy)
+	}
+}
+
+// claims the room's summary with a single upsert, false when a summary is still being written
+// by someone else (pending and not stale yet)
+func (h *Handler) startSummary(room *models.Room) (models.RoomSummary, bool, error) {
+	now := time.Now()
+	summary := models.RoomSummary{RoomID: room.RoomID, Status: models.SummaryPending, Provider: h.assistant.Provider(), UpdatedAt: now}
+	res := h.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "room_id"}},
+		Where: clause.Where{Exprs: []clause.Expression{
+			gorm.Expr("room_summaries.status <> ? OR room_summaries.updated_at < ?", models.SummaryPending, now.Add(-summaryStaleAfter)),
+		}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"status": summary.Status, "provider": summary.Provider, "content": "", "error": "", "updated_at": now}),
+	}).Create(&summary)
+	if res.Error != nil {
+		log.Printf("Failed to start the summary of room %s: %v", room.RoomID, res.Error)
+		return summary, false, res.Error
+	}
+	return summary, res.RowsAffected > 0, nil
+}
+
+// billTo is the user whose assistant quota pays for the summary
+func (h *Handler) writeSummary(room models.Room, submission models.Submission, billTo uint) {
+	var problems []models.Problem
+	if err := h.DB.Model(&room).Association("Problems").Find(&problems); err != nil {
+		log.Printf("Failed to load the problems of room %s for its summary: %v", room.RoomID, err)
+	}
+
+	prompt := assistant.BuildSummaryPrompt(room.Name, problems, submission)
+	ctx, cancel := context.WithTimeout(context.Background(), summaryWriteTimeout)
+	defer cancel()
+	content, err := h.assistant.Complete(ctx, billTo, &room, prompt)
+
+	updates := map[string]interface{}{"status": models.SummaryReady, "content": content, "error": ""}
+	if err != nil {
+		log.Printf("Failed to write the summary of room %s: %v", room.RoomID, err)
+		message := "the assistant failed to write the summary"
+		var quotaErr *assistant.QuotaError
+		if errors.As(err, &quotaErr) {
+			message = err.Error()
+		}
+		updates = map[string]interface{}{"status": models.SummaryFailed, "content": "", "error": message}
+	}
+	if err := h.DB.Model(&models.RoomSummary{}).Where("room_id = ? AND status = ?", room.RoomID, models.SummaryPending).Updates(updates).Error; err != nil {
+		log.Printf("Failed to save the summary of room %s: %v", room.RoomID, err)
+	}
+}
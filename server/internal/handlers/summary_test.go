@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"geekCode/internal/assistant"
+	"geekCode/internal/config"
+	"geekCode/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func summaryTestRouter(t *testing.T) (*gin.Engine, *Handler) {
+	t.Helper()
+	db := newTestDB(t, &models.Room{}, &models.Problem{}, &models.Submission{}, &models.RoomSummary{}, &models.AssistantUsage{})
+	// the summary is written from another goroutine, it has to see the same in-memory database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	room := &models.Room{RoomID: "room-1", Name: "interview", Language: "go", Status: models.Ended, CreatedBy: 1}
+	db.Create(room)
+	db.Create(&models.Submission{RoomID: "room-1", Language: "go", Files: []models.CodeFile{{Name: "main.go", Content: "package main"}}})
+	h := &Handler{
+		DB:        db,
+		cfg:       &config.Config{},
+		assistant: assistant.NewService(&assistant.FakeProvider{Reply: "solid solution"}, assistant.NewMeter(db, assistant.Limits{})),
+	}
+	r := gin.New()
+	withRoom := func(c *gin.Context) {
+		c.Set("userId", uint(2)) // an interviewer, not the owner
+		c.Set("room", room)
+	}
+	r.GET("/rooms/:roomId/summary", withRoom, h.GetRoomSummary)
+	r.POST("/rooms/:roomId/summary", withRoom, h.GenerateRoomSummary)
+	return r, h
+}
+
+func summaryStatus(t *testing.T, r *gin.Engine) models.RoomSummary {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rooms/room-1/summary", nil))
+	var body struct {
+		Summary models.RoomSummary `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("summary response %d: %s", w.Code, w.Body.String())
+	}
+	return body.Summary
+}
+
+func generate(r *gin.Engine) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rooms/room-1/summary", nil))
+	return w.Code
+}
+
+func TestGenerateRoomSummary(t *testing.T) {
+	r, h := summaryTestRouter(t)
+
+	if code := generate(r); code != http.StatusAccepted {
+		t.Fatalf("generate: %d", code)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	summary := summaryStatus(t, r)
+	for summary.Status == models.SummaryPending && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		summary = summaryStatus(t, r)
+	}
+	if summary.Status != models.SummaryReady || summary.Content != "solid solution" {
+		t.Fatalf("summary: %+v", summary)
+	}
+
+	var usage []models.AssistantUsage
+	h.DB.Find(&usage)
+	if len(usage) != 1 || usage[0].UserID != 2 {
+		t.Errorf("usage billed to %+v, want the user who asked for the summary", usage)
+	}
+}
+
+func TestGenerateRoomSummaryClaim(t *testing.T) {
+	r, h := summaryTestRouter(t)
+
+	// somebody else is writing it right now
+	h.DB.Create(&models.RoomSummary{RoomID: "room-1", Status: models.SummaryPending})
+	if code := generate(r); code != http.StatusConflict {
+		t.Fatalf("generate while pending: %d", code)
+	}
+
+	// the writer died a while ago, the row reads as failed and can be claimed again
+	h.DB.Model(&models.RoomSummary{}).Where("room_id = ?", "room-1").UpdateColumn("updated_at", time.Now().Add(-summaryStaleAfter-time.Minute))
+	if summary := summaryStatus(t, r); summary.Status != models.SummaryFailed || summary.Error == "" {
+		t.Errorf("stale summary: %+v", summary)
+	}
+	if code := generate(r); code != http.StatusAccepted {
+		t.Fatalf("generate after the writer died: %d", code)
+	}
+}
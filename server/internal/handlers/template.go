@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxTemplateFiles = 20
+
+type TemplateRequest struct {
+	Name            string              `json:"name" binding:"required,max=100"`
+	Language        string              `json:"language"`
+	Files           []models.CodeFile   `json:"files" binding:"max=20"`
+	ProblemIDs      []uint              `json:"problemIds"`
+	DurationMinutes int                 `json:"durationMinutes" binding:"min=0,max=1440"`
+	Settings        models.RoomSettings `json:"settings"`
+	OrgID           *uint               `json:"orgId"` // optional, shares the template with the org
+}
+
+type UpdateTemplateRequest struct {
+	Name            *string              `json:"name" binding:"omitempty,min=1,max=100"`
+	Language        *string              `json:"language"`
+	Files           *[]models.CodeFile   `json:"files" binding:"omitempty,max=20"`
+	ProblemIDs      *[]uint              `json:"problemIds"`
+	DurationMinutes *int                 `json:"durationMinutes" binding:"omitempty,min=0,max=1440"`
+	Settings        *models.RoomSettings `json:"settings"`
+}
+
+type SaveTemplateRequest struct {
+	Name  string `json:"name" binding:"required,max=100"`
+	OrgID *uint  `json:"orgId"`
+}
+
+func (h *Handler) CreateTemplate(c *gin.Context) {
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+	if !h.canUseOwned(c, userId, userId, req.OrgID, rbac.TemplateEdit) {
+		return
+	}
+	problems, ok := h.visibleProblems(c, userId, req.ProblemIDs)
+	if !ok {
+		return
+	}
+
+	template := models.RoomTemplate{
+		Name:            req.Name,
+		Language:        req.Language,
+		Files:           req.Files,
+		DurationMinutes: req.DurationMinutes,
+		Settings:        req.Settings,
+		Problems:        problems,
+		OrgID:           req.OrgID,
+		CreatedBy:       userId,
+	}
+	h.createTemplate(c, &template)
+}
+
+// the user's own templates, or the org's with ?orgId=
+func (h *Handler) ListTemplates(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+	scope, ok := h.ownedScope(c, userId)
+	if !ok {
+		return
+	}
+
+	var templates []models.RoomTemplate
+	if err := h.DB.Scopes(scope).Preload("Problems").Order("name").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch templates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+func (h *Handler) GetTemplate(c *gin.Context) {
+	templateID, ok := uintParam(c, "templateId")
+	if !ok {
+		return
+	}
+	template, ok := h.findTemplate(c, templateID, rbac.OrgView)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+func (h *Handler) UpdateTemplate(c *gin.Context) {
+	var req UpdateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	templateID, ok := uintParam(c, "templateId")
+	if !ok {
+		return
+	}
+	template, ok := h.findTemplate(c, templateID, rbac.TemplateEdit)
+	if !ok {
+		return
+	}
+	userId := c.MustGet("userId").(uint)
+
+	if req.Name != nil {
+		template.Name = *req.Name
+	}
+	if req.Language != nil {
+		template.Language = *req.Language
+	}
+	if req.Files != nil {
+		template.Files = *req.Files
+	}
+	if req.DurationMinutes != nil {
+		template.DurationMinutes = *req.DurationMinutes
+	}
+	if req.Settings != nil {
+		template.Settings = *req.Settings
+	}
+	var problems []models.Problem
+	if req.ProblemIDs != nil {
+		problems, ok = h.visibleProblems(c, userId, *req.ProblemIDs)
+		if !ok {
+			return
+		}
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Problems").Save(template).Error; err != nil {
+			return err
+		}
+		if req.ProblemIDs == nil {
+			return nil
+		}
+		return tx.Model(template).Association("Problems").Replace(problems)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+func (h *Handler) DeleteTemplate(c *gin.Context) {
+	templateID, ok := uintParam(c, "templateId")
+	if !ok {
+		return
+	}
+	template, ok := h.findTemplate(c, templateID, rbac.TemplateEdit)
+	if !ok {
+		return
+	}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(template).Association("Problems").Clear(); err != nil {
+			return err
+		}
+		// rooms keep their copy, they only lose the link
+		if err := tx.Model(&models.Room{}).Where("template_id = ?", template.ID).Update("template_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "template deleted"})
+}
+
+// saves the room's current setup (including what's in the editor right now) as a new template
+func (h *Handler) SaveRoomAsTemplate(c *gin.Context) {
+	var req SaveTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	room := c.MustGet("room").(*models.Room)
+	userId := c.MustGet("userId").(uint)
+	if !h.canUseOwned(c, userId, userId, req.OrgID, rbac.TemplateEdit) {
+		return
+	}
+
+	var problems []models.Problem
+	if err := h.DB.Model(room).Association("Problems").Find(&problems); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save template"})
+		return
+	}
+	files := h.hub.Files(room.RoomID)
+	if len(files) == 0 {
+		files = room.Files
+	}
+	language := room.Language
+	if live := h.hub.Snapshots(room.RoomID)[room.RoomID]; live.Language != "" {
+		language = live.Language
+	}
+
+	template := models.RoomTemplate{
+		Name:            req.Name,
+		Language:        language,
+		Files:           files,
+		DurationMinutes: room.DurationMinutes,
+		Settings:        room.Settings,
+		Problems:        problems,
+		OrgID:           req.OrgID,
+		CreatedBy:       userId,
+	}
+	h.createTemplate(c, &template)
+}
+
+func (h *Handler) createTemplate(c *gin.Context, template *models.RoomTemplate) {
+	if len(template.Files) > maxTemplateFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many files"})
+		return
+	}
+	// the problems already exist, only the links are created
+	if err := h.DB.Omit("Problems.*").Create(template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create template"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"template": template})
+}
+
+func (h *Handler) findTemplate(c *gin.Context, templateID uint, perm rbac.Permission) (*models.RoomTemplate, bool) {
+	var template models.RoomTemplate
+	if err := h.DB.Preload("Problems").First(&template, templateID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return nil, false
+	}
+	userId := c.MustGet("userId").(uint)
+	if !h.canUseOwned(c, userId, template.CreatedBy, template.OrgID, perm) {
+		return nil, false
+	}
+	return &template, true
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"geekCode/internal/auth"
+	"geekCode/internal/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer        = "GeekCode"
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var errInvalidOTP = errors.New("invalid verification code")
+
+type OTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type LoginOTPRequest struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"` // totp code or a recovery code
+}
+
+func (h *Handler) TwoFactorStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var remaining int64
+	h.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+	c.JSON(http.StatusOK, gin.H{"enabled": user.TOTPEnabled, "recoveryCodesLeft": remaining})
+}
+
+// creates a new secret, it only becomes active once a code from it is confirmed
+func (h *Handler) EnrollTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+	if err := h.DB.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":          secret,
+		"provisioningUri": auth.TOTPProvisioningURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// confirms the enrollment with a first code and hands out the recovery codes (shown only once)
+func (h *Handler) ActivateTwoFactor(c *gin.Context) {
+	var req OTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start the enrollment first"})
+		return
+	}
+
+	var codes []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifyTOTP(tx, user, req.Code); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errInvalidOTP) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two factor authentication enabled", "recoveryCodes": codes})
+}
+
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	var req OTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two factor authentication is not enabled"})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user, req.Code); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+	})
+	if errors.Is(err, errInvalidOTP) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "two factor authentication disabled"})
+}
+
+// replaces all recovery codes, the old ones stop working
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req OTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two factor authentication is not enabled"})
+		return
+	}
+
+	var codes []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifyTOTP(tx, user, req.Code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errInvalidOTP) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to regenerate recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// second login step, trades the mfa token plus an otp (or recovery code) for the real tokens
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var req LoginOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := auth.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login session expired, please sign in again"})
+		return
+	}
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login session expired, please sign in again"})
+		return
+	}
+
+	// six digit codes are easy to guess without a limit, so they count as failed logins too
+	ip := c.ClientIP()
+	if wait := h.loginGuard.RetryAfter(ip, user.Email); wait > 0 {
+		h.auditLoginFailure(c, user.Email, &user.ID, "throttled")
+		abortTooManyAttempts(c, wait, "too many login attempts, try again later")
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return verifySecondFactor(tx, &user, req.Code)
+	})
+	if errors.Is(err, errInvalidOTP) {
+		h.loginGuard.Failure(ip, user.Email)
+		h.auditLoginFailure(c, user.Email, &user.ID, "invalid_otp")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify code"})
+		return
+	}
+	h.loginGuard.Success(user.Email)
+
+	token, _, refreshToken, err := h.issueTokens(h.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	resp := h.tokenResponse(token, refreshToken)
+	resp["user"] = user
+	c.JSON(http.StatusOK, resp)
+}
+
+// the password (or identity provider) checked out, users with 2fa get an mfa token instead of access tokens
+func (h *Handler) mfaChallenge(user *models.User) (gin.H, bool, error) {
+	if !user.TOTPEnabled {
+		return nil, false, nil
+	}
+	mfaToken, err := auth.GenerateMFAToken(user.ID, mfaTokenTTL)
+	if err != nil {
+		return nil, true, err
+	}
+	return gin.H{
+		"mfaRequired": true,
+		"mfaToken":    mfaToken,
+		"expiresIn":   int(mfaTokenTTL.Seconds()),
+	}, true, nil
+}
+
+func (h *Handler) currentUser(c *gin.Context) (*models.User, bool) {
+	userId := c.MustGet("userId").(uint)
+	var user models.User
+	if err := h.DB.First(&user, userId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// accepts a totp code or, when it doesn't look like one, a recovery code
+func verifySecondFactor(tx *gorm.DB, user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == 6 {
+		return verifyTOTP(tx, user, code)
+	}
+	return useRecoveryCode(tx, user.ID, code)
+}
+
+func verifyTOTP(tx *gorm.DB, user *models.User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return errInvalidOTP
+	}
+	// the step only moves forward, a replayed (or older) code affects no rows
+	res := tx.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errInvalidOTP
+	}
+	return nil
+}
+
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	hash := auth.HashToken(auth.NormalizeRecoveryCode(code))
+	res := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errInvalidOTP
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := auth.GenerateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: auth.HashToken(code)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/auth"
+	"geekCode/internal/config"
+	"geekCode/internal/models"
+	"geekCode/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const twoFactorSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func twoFactorTestRouter(t *testing.T) (*gin.Engine, *Handler, *models.User) {
+	t.Helper()
+	initTestKeys(t)
+	h := &Handler{
+		DB:         newTestDB(t, &models.User{}, &models.RecoveryCode{}, &models.RefreshToken{}, &models.LoginAudit{}),
+		cfg:        &config.Config{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+		loginGuard: services.NewLoginGuard(3, time.Minute),
+	}
+	user := &models.User{FirstName: "Ada", LastName: "L", Username: "ada", Email: "ada@example.com", Password: "x", TOTPEnabled: true, TOTPSecret: twoFactorSecret}
+	h.DB.Create(user)
+	h.DB.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: auth.HashToken("abcd-efgh-ijkl-mnop")})
+
+	r := gin.New()
+	r.POST("/api/auth/login/2fa", h.LoginTwoFactor)
+	r.POST("/api/2fa/activate", func(c *gin.Context) { c.Set("userId", user.ID) }, h.ActivateTwoFactor)
+	return r, h, user
+}
+
+func loginTwoFactor(r *gin.Engine, mfaToken, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(LoginOTPRequest{MFAToken: mfaToken, Code: code})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login/2fa", strings.NewReader(string(body))))
+	return w
+}
+
+func currentCode(t *testing.T, offset time.Duration) string {
+	t.Helper()
+	code, err := auth.TOTPCode(twoFactorSecret, time.Now().Add(offset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	r, _, user := twoFactorTestRouter(t)
+	mfa, _ := auth.GenerateMFAToken(user.ID, time.Minute)
+
+	code := currentCode(t, 0)
+	w := loginTwoFactor(r, mfa, code)
+	if w.Code != http.StatusOK {
+		t.Fatalf("valid code: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if id, err := auth.ValidateToken(resp.Token); err != nil || id != user.ID || resp.RefreshToken == "" {
+		t.Fatalf("tokens after the second factor: %d %v %+v", id, err, resp)
+	}
+
+	// a code that was used once, or one from before it, can't be replayed
+	if w := loginTwoFactor(r, mfa, code); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: %d", w.Code)
+	}
+	if w := loginTwoFactor(r, mfa, currentCode(t, -30*time.Second)); w.Code != http.StatusUnauthorized {
+		t.Errorf("older code after a newer one: %d", w.Code)
+	}
+}
+
+func TestLoginTwoFactorRecoveryCode(t *testing.T) {
+	r, _, user := twoFactorTestRouter(t)
+	mfa, _ := auth.GenerateMFAToken(user.ID, time.Minute)
+
+	// typed the way people type them
+	if w := loginTwoFactor(r, mfa, "ABCD EFGH IJKL MNOP"); w.Code != http.StatusOK {
+		t.Fatalf("recovery code: %d %s", w.Code, w.Body.String())
+	}
+	if w := loginTwoFactor(r, mfa, "abcd-efgh-ijkl-mnop"); w.Code != http.StatusUnauthorized {
+		t.Errorf("recovery code used twice: %d", w.Code)
+	}
+}
+
+func TestLoginTwoFactorRejects(t *testing.T) {
+	r, h, user := twoFactorTestRouter(t)
+	mfa, _ := auth.GenerateMFAToken(user.ID, time.Minute)
+	access, _, _ := auth.GenerateToken(user.ID, time.Minute)
+	expired, _ := auth.GenerateMFAToken(user.ID, -time.Second)
+
+	tests := []struct {
+		name  string
+		token string
+		code  string
+		want  int
+	}{
+		{"access token instead of the mfa token", access, currentCode(t, 0), http.StatusUnauthorized},
+		{"expired mfa token", expired, currentCode(t, 0), http.StatusUnauthorized},
+		{"garbage mfa token", "nope", currentCode(t, 0), http.StatusUnauthorized},
+		{"missing code", mfa, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := loginTwoFactor(r, tt.token, tt.code); w.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// 2fa was switched off after the password step
+	h.DB.Model(user).Update("totp_enabled", false)
+	if w := loginTwoFactor(r, mfa, currentCode(t, 0)); w.Code != http.StatusUnauthorized {
+		t.Errorf("user without 2fa: %d", w.Code)
+	}
+}
+
+func TestLoginTwoFactorThrottled(t *testing.T) {
+	r, h, user := twoFactorTestRouter(t)
+	mfa, _ := auth.GenerateMFAToken(user.ID, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if w := loginTwoFactor(r, mfa, "000000"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: %d", i, w.Code)
+		}
+	}
+	// locked now, even the right code has to wait
+	w := loginTwoFactor(r, mfa, currentCode(t, 0))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("after the lockout: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	var reasons []string
+	h.DB.Model(&models.LoginAudit{}).Order("id").Pluck("reason", &reasons)
+	if strings.Join(reasons, ",") != "invalid_otp,invalid_otp,invalid_otp,throttled" {
+		t.Errorf("audit = %v", reasons)
+	}
+}
+
+func TestActivateTwoFactor(t *testing.T) {
+	r, h, user := twoFactorTestRouter(t)
+	h.DB.Model(user).Updates(map[string]interface{}{"totp_enabled": false, "totp_last_step": 0})
+	activate := func(code string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/2fa/activate", strings.NewReader(`{"code":"`+code+`"}`)))
+		return w
+	}
+
+	if w := activate("000000"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: %d", w.Code)
+	}
+	w := activate(currentCode(t, 0))
+	if w.Code != http.StatusOK {
+		t.Fatalf("activate: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("%d recovery codes", len(resp.RecoveryCodes))
+	}
+	// the old recovery code was replaced
+	var left int64
+	h.DB.Model(&models.RecoveryCode{}).Where("code_hash = ?", auth.HashToken("abcd-efgh-ijkl-mnop")).Count(&left)
+	if left != 0 {
+		t.Error("old recovery code survived the activation")
+	}
+	if w := activate(currentCode(t, 0)); w.Code != http.StatusConflict {
+		t.Errorf("activating twice: %d", w.Code)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"geekCode/internal/auth"
+	"geekCode/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// long enough to open the connection right after asking for it
+const webSocketTicketTTL = 30 * time.Second
+
+// hands out a single use ticket for /ws and /lsp, browsers can't set headers on the upgrade and a
+// token in the url would end up in access logs and the browser history
+func (h *Handler) CreateWebSocketTicket(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+
+	raw, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create ticket"})
+		return
+	}
+	// unlike the mailed tokens older tickets stay valid, every open editor needs its own
+	if err := h.DB.Create(&models.UserToken{
+		UserID:    userId,
+		Purpose:   models.TokenPurposeWebSocket,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(webSocketTicketTTL),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create ticket"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": raw, "expiresIn": int(webSocketTicketTTL.Seconds())})
+}
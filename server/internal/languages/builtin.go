@@ -0,0 +1,66 @@
+package languages
+
+// the runtimes the editor always offered, versions match the ones the browser asks piston for
+var builtin = []Runtime{
+	{
+		Name:        "javascript",
+		DisplayName: "JavaScript",
+		Version:     "18.15.0",
+		Extension:   ".js",
+		FileName:    "main.js",
+		Aliases:     []string{"js", "node"},
+		Run:         []string{"node", "{file}"},
+		Template:    "// Write your JavaScript code here...\nconsole.log('Hello, World!');",
+		Limits:      Limits{TimeoutMs: 10000, MemoryMB: -1}, // v8 reserves more address space than it uses
+		Diagnostics: "node",
+	},
+	{
+		Name:        "python",
+		DisplayName: "Python",
+		Version:     "3.10.0",
+		Extension:   ".py",
+		FileName:    "main.py",
+		Aliases:     []string{"py", "python3"},
+		Run:         []string{"python3", "{file}"},
+		Template:    "# Write your Python code here...\nprint('Hello, World!')",
+		Limits:      Limits{TimeoutMs: 10000, MemoryMB: 256},
+		Diagnostics: "python",
+	},
+	{
+		Name:        "java",
+		DisplayName: "Java",
+		Version:     "17.0.0",
+		Extension:   ".java",
+		FileName:    "Main.java",
+		Compile:     []string{"javac", "-d", "{dir}", "{file}"},
+		Run:         []string{"java", "-cp", "{dir}", "-Xmx256m", "{name}"},
+		Template:    "// Write your Java code here...\npublic class Main {\n    public static void main(String[] args) {\n        System.out.println(\"Hello, World!\");\n    }\n}",
+		Limits:      Limits{TimeoutMs: 15000, MemoryMB: -1},
+		Diagnostics: "javac",
+	},
+	{
+		Name:        "cpp",
+		DisplayName: "C++",
+		Version:     "10.2.0",
+		Extension:   ".cpp",
+		FileName:    "main.cpp",
+		Aliases:     []string{"c++"},
+		Compile:     []string{"g++", "-std=c++17", "-O2", "-o", "{dir}/main", "{file}"},
+		Run:         []string{"{dir}/main"},
+		Template:    "// Write your C++ code here...\n#include <iostream>\nusing namespace std;\n\nint main() {\n    cout << \"Hello, World!\" << endl;\n    return 0;\n}",
+		Limits:      Limits{TimeoutMs: 10000, MemoryMB: 256},
+		Diagnostics: "gcc",
+	},
+	{
+		Name:        "c",
+		DisplayName: "C",
+		Version:     "10.2.0",
+		Extension:   ".c",
+		FileName:    "main.c",
+		Compile:     []string{"gcc", "-std=c11", "-O2", "-o", "{dir}/main", "{file}", "-lm"},
+		Run:         []string{"{dir}/main"},
+		Template:    "// Write your C code here...\n#include <stdio.h>\n\nint main() {\n    printf(\"Hello, World!\\n\");\n    return 0;\n}",
+		Limits:      Limits{TimeoutMs: 10000, MemoryMB: 256},
+		Diagnostics: "gcc",
+	},
+}
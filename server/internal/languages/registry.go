@@ -0,0 +1,151 @@
+// Package languages describes the runtimes rooms can use: how files are named, how they are compiled
+// and run, what a new file starts with and the limits a run gets. the built in list can be extended
+// or replaced with a json file (LANGUAGES_FILE), so adding a language doesn't need a code change
+package languages
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"geekCode/internal/diagnostics"
+	"time"
+)
+
+// Limits cap a single run, zero means the executor's default
+type Limits struct {
+	TimeoutMs   int `json:"timeoutMs,omitempty"`   // wall clock time of the run step
+	MemoryMB    int `json:"memoryMb,omitempty"`    // address space of the process, -1 turns the cap off (the jvm needs that)
+	OutputBytes int `json:"outputBytes,omitempty"` // stdout and stderr each
+}
+
+func (l Limits) Timeout() time.Duration {
+	return time.Duration(l.TimeoutMs) * time.Millisecond
+}
+
+// Runtime is one language. commands are argument lists with placeholders: {file} is the main file,
+// {name} the main file without its extension and {dir} the directory the files were written to
+type Runtime struct {
+	Name        string   `json:"name"` // what the editor calls it, like "cpp"
+	DisplayName string   `json:"displayName"`
+	Version     string   `json:"version"`
+	Extension   string   `json:"extension"`         // of source files, with the dot
+	FileName    string   `json:"fileName"`          // for the main file when nothing better is known
+	Aliases     []string `json:"aliases,omitempty"` // other names clients use, like "c++"
+	Compile     []string `json:"compile,omitempty"` // left out for interpreted languages
+	Run         []string `json:"run"`
+	Template    string   `json:"template,omitempty"` // content of a new file
+	Limits      Limits   `json:"limits"`
+	Diagnostics string   `json:"diagnostics,omitempty"` // the parser for its errors, like "gcc" or "python"
+	Disabled    bool     `json:"disabled,omitempty"`    // in LANGUAGES_FILE, drops a built in runtime
+}
+
+// Registry is the list of runtimes, read only once it is built
+type Registry struct {
+	runtimes map[string]*Runtime
+	aliases  map[string]string
+}
+
+// Default returns the built in runtimes
+func Default() *Registry {
+	r := &Registry{runtimes: make(map[string]*Runtime), aliases: make(map[string]string)}
+	for i := range builtin {
+		runtime := builtin[i]
+		r.add(&runtime)
+	}
+	return r
+}
+
+// Load returns the built in runtimes merged with the ones in the json file, an empty path means
+// only the built in ones. the file holds an array of runtimes, a runtime with a known name replaces it
+func Load(path string) (*Registry, error) {
+	r := Default()
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var runtimes []Runtime
+	if err := json.Unmarshal(data, &runtimes); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i := range runtimes {
+		runtime := runtimes[i]
+		runtime.Name = strings.ToLower(strings.TrimSpace(runtime.Name))
+		if runtime.Name == "" {
+			return nil, fmt.Errorf("runtime %d in %s has no name", i, path)
+		}
+		if old, found := r.runtimes[runtime.Name]; found {
+			r.remove(old)
+		}
+		if runtime.Disabled {
+			continue
+		}
+		if len(runtime.Run) == 0 {
+			return nil, fmt.Errorf("runtime %s in %s has no run command", runtime.Name, path)
+		}
+		if runtime.Diagnostics != "" && !diagnostics.Supported(runtime.Diagnostics) {
+			return nil, fmt.Errorf("runtime %s in %s has an unknown diagnostics parser %q", runtime.Name, path, runtime.Diagnostics)
+		}
+		if runtime.Extension != "" && !strings.HasPrefix(runtime.Extension, ".") {
+			runtime.Extension = "." + runtime.Extension
+		}
+		if runtime.FileName == "" {
+			runtime.FileName = "main" + runtime.Extension
+		}
+		r.add(&runtime)
+	}
+	return r, nil
+}
+
+func (r *Registry) add(runtime *Runtime) {
+	r.runtimes[runtime.Name] = runtime
+	for _, alias := range runtime.Aliases {
+		r.aliases[strings.ToLower(alias)] = runtime.Name
+	}
+}
+
+func (r *Registry) remove(runtime *Runtime) {
+	delete(r.runtimes, runtime.Name)
+	for alias, name := range r.aliases {
+		if name == runtime.Name {
+			delete(r.aliases, alias)
+		}
+	}
+}
+
+// Get looks a runtime up by name or alias, ignoring case
+func (r *Registry) Get(name string) (*Runtime, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, found := r.aliases[name]; found {
+		name = alias
+	}
+	runtime, found := r.runtimes[name]
+	return runtime, found
+}
+
+// ForFile finds the runtime by the file's extension
+func (r *Registry) ForFile(fileName string) (*Runtime, bool) {
+	ext := filepath.Ext(fileName)
+	for _, runtime := range r.runtimes {
+		if ext != "" && runtime.Extension == ext {
+			return runtime, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the runtimes sorted by name
+func (r *Registry) List() []Runtime {
+	list := make([]Runtime, 0, len(r.runtimes))
+	for _, runtime := range r.runtimes {
+		list = append(list, *runtime)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,135 @@
+package languages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	r := Default()
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"python", "python"},
+		{"py", "python"},
+		{" Python3 ", "python"},
+		{"C++", "cpp"},
+		{"cpp", "cpp"},
+		{"JS", "javascript"},
+		{"node", "javascript"},
+		{"Java", "java"},
+		{"cobol", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		runtime, found := r.Get(tt.name)
+		if found != (tt.want != "") {
+			t.Errorf("Get(%q) found = %v", tt.name, found)
+			continue
+		}
+		if found && runtime.Name != tt.want {
+			t.Errorf("Get(%q) = %s, want %s", tt.name, runtime.Name, tt.want)
+		}
+	}
+}
+
+func TestForFile(t *testing.T) {
+	r := Default()
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"main.py", "python"},
+		{"src/Main.java", "java"},
+		{"solution.cpp", "cpp"},
+		{"lib.c", "c"},
+		{"index.js", "javascript"},
+		{"notes.txt", ""},
+		{"Makefile", ""},
+	}
+	for _, tt := range tests {
+		runtime, found := r.ForFile(tt.file)
+		if found != (tt.want != "") || (found && runtime.Name != tt.want) {
+			t.Errorf("ForFile(%q) = %v, %v, want %q", tt.file, runtime, found, tt.want)
+		}
+	}
+}
+
+func writeLanguages(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "languages.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	r, err := Load(writeLanguages(t, `[
+		{"name": " Ruby ", "extension": "rb", "aliases": ["rb"], "run": ["ruby", "{file}"]},
+		{"name": "python", "extension": ".py", "aliases": ["py3"], "run": ["pypy3", "{file}"], "diagnostics": "python"},
+		{"name": "java", "disabled": true}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ruby, found := r.Get("RB")
+	if !found || ruby.Name != "ruby" || ruby.Extension != ".rb" || ruby.FileName != "main.rb" {
+		t.Errorf("ruby = %+v, %v", ruby, found)
+	}
+	if runtime, found := r.ForFile("app.rb"); !found || runtime.Name != "ruby" {
+		t.Errorf("ForFile(app.rb) = %v, %v", runtime, found)
+	}
+
+	// a replaced runtime keeps only the aliases of its replacement
+	python, _ := r.Get("py3")
+	if python == nil || python.Run[0] != "pypy3" {
+		t.Errorf("python = %+v", python)
+	}
+	if _, found := r.Get("python3"); found {
+		t.Error("the built in python alias survived the replacement")
+	}
+
+	// disabled runtimes are gone under every name
+	if _, found := r.Get("java"); found {
+		t.Error("java is still there")
+	}
+	if _, found := r.ForFile("Main.java"); found {
+		t.Error("java files still have a runtime")
+	}
+	var names []string
+	for _, runtime := range r.List() {
+		names = append(names, runtime.Name)
+	}
+	if got := strings.Join(names, ","); got != "c,cpp,javascript,python,ruby" {
+		t.Errorf("List() = %s", got)
+	}
+
+	// the built in registry isn't touched by loading a file
+	if runtime, found := Default().Get("python3"); !found || runtime.Run[0] == "pypy3" {
+		t.Errorf("default python = %+v", runtime)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if r, err := Load(""); err != nil || len(r.List()) != len(builtin) {
+		t.Errorf("empty path: %v", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file loaded")
+	}
+	for _, content := range []string{
+		`{"name": "ruby"}`,
+		`[{"extension": ".rb", "run": ["ruby"]}]`,
+		`[{"name": "ruby", "extension": ".rb"}]`,
+		`[{"name": "ruby", "run": ["ruby"], "diagnostics": "rubocop"}]`,
+	} {
+		if _, err := Load(writeLanguages(t, content)); err == nil {
+			t.Errorf("%s loaded", content)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// language servers can send big completion lists, anything past this is treated as a broken stream
+const maxServerMessage = 16 << 20
+
+// message is any json-rpc 2.0 message, params and results stay raw since they are only passed along
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   json.RawMessage  `json:"error,omitempty"`
+}
+
+func (m *message) isRequest() bool      { return m.Method != "" && m.ID != nil }
+func (m *message) isNotification() bool { return m.Method != "" && m.ID == nil }
+func (m *message) isResponse() bool     { return m.Method == "" && m.ID != nil }
+
+func rawID(id int64) *json.RawMessage {
+	raw := json.RawMessage(strconv.FormatInt(id, 10))
+	return &raw
+}
+
+func response(id *json.RawMessage, result interface{}) []byte {
+	body, _ := json.Marshal(result)
+	out, _ := json.Marshal(message{JSONRPC: "2.0", ID: id, Result: body})
+	return out
+}
+
+// json-rpc error codes the gateway answers with
+const (
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+func errorResponse(id *json.RawMessage, code int, text string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{"code": code, "message": text})
+	out, _ := json.Marshal(message{JSONRPC: "2.0", ID: id, Error: body})
+	return out
+}
+
+func notification(method string, params interface{}) []byte {
+	var body json.RawMessage
+	if params != nil {
+		body, _ = json.Marshal(params)
+	}
+	out, _ := json.Marshal(message{JSONRPC: "2.0", Method: method, Params: body})
+	return out
+}
+
+// readFrame reads one message of the base protocol: headers, an empty line, then Content-Length bytes
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length")
+	}
+	if length > maxServerMessage {
+		return nil, fmt.Errorf("message of %d bytes is too large", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func writeFrame(w io.Writer, body []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
@@ -0,0 +1,266 @@
+// Package lsp runs language servers for rooms and bridges them to the browser over a websocket.
+// one server runs per room and language, shared by everybody in the room; the gateway keeps its
+// view of the files in sync with the collaborative edits
+package lsp
+
+import (
+	"errors"
+	"geekCode/internal/config"
+	"geekCode/internal/formatter"
+	"geekCode/internal/models"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// the same close code the room websocket uses when a room is ended
+const closeRoomClosed = 4000
+
+// a peer sending more than this in one message is up to no good
+const maxPeerMessage = 1 << 20
+
+var (
+	ErrNoServer     = errors.New("no language server is available for this language")
+	ErrTooManyRooms = errors.New("too many language servers are running, try again later")
+)
+
+// the servers used when they are on the PATH, LSP_SERVER_<LANGUAGE> replaces them
+var defaultCommands = map[string]string{
+	"go":         "gopls",
+	"c":          "clangd",
+	"cpp":        "clangd",
+	"python":     "pyright-langserver --stdio",
+	"javascript": "typescript-language-server --stdio",
+	"typescript": "typescript-language-server --stdio",
+	"rust":       "rust-analyzer",
+}
+
+// for files the editor didn't give a language
+var extensions = map[string]string{
+	".go":  "go",
+	".c":   "c",
+	".h":   "c",
+	".cpp": "cpp",
+	".cc":  "cpp",
+	".hpp": "cpp",
+	".py":  "python",
+	".js":  "javascript",
+	".ts":  "typescript",
+	".rs":  "rust",
+}
+
+// Documents is where sessions get the room's files from when they start
+type Documents interface {
+	Files(roomId string) []models.CodeFile
+}
+
+// Manager starts, shares and stops the language servers
+type Manager struct {
+	docs        Documents
+	commands    map[string][]string
+	workDir     string
+	idleTimeout time.Duration
+	maxSessions int
+
+	mu       sync.Mutex
+	sessions map[string]*session // by room id and language
+}
+
+func NewManager(cfg *config.Config, docs Documents) *Manager {
+	workDir := cfg.LSPWorkDir
+	if workDir == "" {
+		workDir = filepath.Join(os.TempDir(), "geekcode-lsp")
+	}
+	m := &Manager{
+		docs:        docs,
+		commands:    make(map[string][]string),
+		workDir:     workDir,
+		idleTimeout: cfg.LSPIdleTimeout,
+		maxSessions: cfg.LSPMaxSessions,
+		sessions:    make(map[string]*session),
+	}
+	commands := make(map[string]string, len(defaultCommands))
+	for language, command := range defaultCommands {
+		commands[language] = command
+	}
+	for language, command := range cfg.LSPServers {
+		commands[formatter.Normalize(language)] = command
+	}
+	for language, command := range commands {
+		args := strings.Fields(command)
+		if len(args) == 0 || command == "off" {
+			continue
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			if _, configured := cfg.LSPServers[language]; configured {
+				log.Printf("Warning: language server %q for %s is not installed, skipping", args[0], language)
+			}
+			continue
+		}
+		m.commands[language] = args
+	}
+	return m
+}
+
+// Languages lists the languages a server is available for
+func (m *Manager) Languages() []string {
+	languages := make([]string, 0, len(m.commands))
+	for language := range m.commands {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// HandleWebSocket bridges the browser to the room's language server, one json-rpc message per text
+// frame. the rbac middleware runs before this and puts the room in the context
+func (m *Manager) HandleWebSocket(c *gin.Context) {
+	room := c.MustGet("room").(*models.Room)
+	language := formatter.Normalize(c.Param("language"))
+	if room.Status != models.Active {
+		c.JSON(http.StatusGone, gin.H{"error": "Room is no longer active"})
+		return
+	}
+
+	s, err := m.session(room.RoomID, language)
+	switch {
+	case errors.Is(err, ErrNoServer):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "languages": m.Languages()})
+		return
+	case errors.Is(err, ErrTooManyRooms):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Failed to start the %s language server for room %s: %v", language, room.RoomID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to start the language server"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Error upgrading to websocket: %v", err)
+		return
+	}
+	conn.SetReadLimit(maxPeerMessage)
+	p := &peer{conn: conn}
+	if !s.attach(p) {
+		// stopped between starting and attaching
+		p.close(websocket.CloseTryAgainLater, "the language server stopped")
+		return
+	}
+	defer s.detach(p)
+	defer conn.Close()
+
+	for {
+		_, body, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.fromPeer(p, body)
+	}
+}
+
+// session returns the running session, starting one when needed. starting happens outside the lock,
+// others asking for the same session meanwhile wait for it
+func (m *Manager) session(roomId, language string) (*session, error) {
+	args, found := m.commands[language]
+	if !found {
+		return nil, ErrNoServer
+	}
+	key := roomId + "/" + language
+
+	m.mu.Lock()
+	s := m.sessions[key]
+	starting := s == nil
+	if starting {
+		if m.maxSessions > 0 && len(m.sessions) >= m.maxSessions {
+			m.mu.Unlock()
+			return nil, ErrTooManyRooms
+		}
+		s = newSession(m, roomId, language)
+		m.sessions[key] = s
+	}
+	m.mu.Unlock()
+
+	if starting {
+		s.start(args, m.docs.Files(roomId))
+	}
+	<-s.ready
+	if s.startErr != nil {
+		if starting {
+			m.remove(s, "")
+		}
+		return nil, s.startErr
+	}
+	return s, nil
+}
+
+// remove stops the session and disconnects its peers, an empty reason means it went idle
+func (m *Manager) remove(s *session, reason string) {
+	m.mu.Lock()
+	key := s.roomId + "/" + s.language
+	if m.sessions[key] == s {
+		delete(m.sessions, key)
+	}
+	m.mu.Unlock()
+
+	if reason != "" {
+		s.closePeers(websocket.CloseInternalServerErr, reason)
+	}
+	s.stop()
+}
+
+func (m *Manager) roomSessions(roomId string) []*session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []*session
+	for _, s := range m.sessions {
+		if s.roomId == roomId {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// DocumentChanged passes the hub's document on to the room's servers, it doesn't block
+func (m *Manager) DocumentChanged(roomId string, files []models.CodeFile) {
+	for _, s := range m.roomSessions(roomId) {
+		s.update(files)
+	}
+}
+
+// RoomClosed stops the room's servers and disconnects everybody from them
+func (m *Manager) RoomClosed(roomId string) {
+	for _, s := range m.roomSessions(roomId) {
+		go func(s *session) {
+			s.closePeers(closeRoomClosed, "room closed")
+			m.remove(s, "")
+		}(s)
+	}
+}
+
+// safeName keeps file and directory names inside the workspace
+func safeName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." || name == "" {
+		return "main"
+	}
+	return name
+}
@@ -0,0 +1,603 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"geekCode/internal/formatter"
+	"geekCode/internal/models"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// clients address files as file:///room/<name>, the gateway maps that onto the session's workspace
+const virtualRoot = "file:///room/"
+
+const initializeTimeout = 30 * time.Second
+
+// a browser connected to the session
+type peer struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (p *peer) send(msg []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+func (p *peer) close(code int, reason string) {
+	p.writeMu.Lock()
+	p.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	p.writeMu.Unlock()
+	p.conn.Close()
+}
+
+// a request waiting for the server's answer, from a peer or from the gateway itself
+type pending struct {
+	peer  *peer
+	id    *json.RawMessage // the id the peer used
+	reply chan *message    // set for the gateway's own requests
+}
+
+// session is one language server process working on one room's files. the gateway owns the document:
+// it opens and updates the files from the collaborative edits, peers only send queries
+type session struct {
+	manager  *Manager
+	roomId   string
+	language string
+	dir      string
+	rootURI  string
+
+	ready    chan struct{} // closed once the server answered initialize or failed to
+	startErr error
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu           sync.Mutex
+	peers        map[*peer]bool
+	requests     map[int64]pending
+	nextID       int64
+	capabilities json.RawMessage
+	diagnostics  map[string][]byte // latest publishDiagnostics per document, replayed to new peers
+	latest       []models.CodeFile // the document as the hub last reported it
+	idle         *time.Timer
+	stopped      bool
+
+	changed  chan struct{}
+	done     chan struct{}
+	versions map[string]int    // per file, only touched by the sync loop
+	synced   map[string]string // content the server has, only touched by the sync loop
+}
+
+func newSession(m *Manager, roomId, language string) *session {
+	dir := filepath.Join(m.workDir, safeName(roomId)+"-"+language)
+	return &session{
+		manager:     m,
+		roomId:      roomId,
+		language:    language,
+		dir:         dir,
+		rootURI:     "file://" + filepath.ToSlash(dir),
+		ready:       make(chan struct{}),
+		peers:       make(map[*peer]bool),
+		requests:    make(map[int64]pending),
+		diagnostics: make(map[string][]byte),
+		changed:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		versions:    make(map[string]int),
+		synced:      make(map[string]string),
+	}
+}
+
+// start runs the server in a fresh workspace and initializes it, ready is closed either way
+func (s *session) start(args []string, files []models.CodeFile) {
+	defer close(s.ready)
+	if s.startErr = s.spawn(args); s.startErr != nil {
+		s.stop()
+		return
+	}
+	if s.startErr = s.initialize(); s.startErr != nil {
+		s.stop()
+		return
+	}
+	s.update(files)
+	go s.syncLoop()
+}
+
+func (s *session) spawn(args []string) error {
+	os.RemoveAll(s.dir)
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	if s.language == "go" {
+		// gopls wants a module to work in
+		if err := os.WriteFile(filepath.Join(s.dir, "go.mod"), []byte("module room\n\ngo 1.21\n"), 0o600); err != nil {
+			return err
+		}
+	}
+
+	s.cmd = exec.Command(args[0], args[1:]...)
+	s.cmd.Dir = s.dir
+	stdin, err := s.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := s.cmd.Start(); err != nil {
+		return err
+	}
+	s.stdin = stdin
+	go s.readLoop(bufio.NewReader(stdout))
+	return nil
+}
+
+func (s *session) initialize() error {
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   s.rootURI,
+		"workspaceFolders": []map[string]string{
+			{"uri": s.rootURI, "name": "room"},
+		},
+		"capabilities": map[string]interface{}{
+			"workspace": map[string]interface{}{"configuration": true, "workspaceFolders": true},
+			"textDocument": map[string]interface{}{
+				"synchronization":    map[string]interface{}{"dynamicRegistration": false},
+				"publishDiagnostics": map[string]interface{}{"relatedInformation": true},
+				"completion": map[string]interface{}{
+					"completionItem": map[string]interface{}{"snippetSupport": true, "documentationFormat": []string{"markdown", "plaintext"}},
+				},
+				"hover":          map[string]interface{}{"contentFormat": []string{"markdown", "plaintext"}},
+				"signatureHelp":  map[string]interface{}{"signatureInformation": map[string]interface{}{"documentationFormat": []string{"markdown", "plaintext"}}},
+				"definition":     map[string]interface{}{},
+				"references":     map[string]interface{}{},
+				"documentSymbol": map[string]interface{}{"hierarchicalDocumentSymbolSupport": true},
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+	defer cancel()
+	reply, err := s.call(ctx, "initialize", params)
+	if err != nil {
+		return err
+	}
+	if len(reply.Error) > 0 {
+		return fmt.Errorf("initialize failed: %s", reply.Error)
+	}
+	var result struct {
+		Capabilities json.RawMessage `json:"capabilities"`
+	}
+	if err := json.Unmarshal(reply.Result, &result); err != nil {
+		return fmt.Errorf("invalid initialize result: %w", err)
+	}
+	s.mu.Lock()
+	s.capabilities = result.Capabilities
+	s.mu.Unlock()
+	return s.write(notification("initialized", struct{}{}))
+}
+
+// call sends a request of the gateway's own and waits for the answer
+func (s *session) call(ctx context.Context, method string, params interface{}) (*message, error) {
+	body, _ := json.Marshal(params)
+	reply := make(chan *message, 1)
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.requests[id] = pending{reply: reply}
+	s.mu.Unlock()
+
+	out, _ := json.Marshal(message{JSONRPC: "2.0", ID: rawID(id), Method: method, Params: body})
+	if err := s.write(out); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-s.done:
+		return nil, errors.New("the language server stopped")
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (s *session) write(body []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return writeFrame(s.stdin, bytes.ReplaceAll(body, []byte(virtualRoot), []byte(s.rootURI+"/")))
+}
+
+// readLoop handles everything the server sends until it exits
+func (s *session) readLoop(r *bufio.Reader) {
+	defer s.manager.remove(s, "the language server stopped")
+	for {
+		body, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Language server %s for room %s: %v", s.language, s.roomId, err)
+			}
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			log.Printf("Language server %s for room %s sent invalid json: %v", s.language, s.roomId, err)
+			continue
+		}
+		switch {
+		case msg.isResponse():
+			s.answer(&msg)
+		case msg.isRequest():
+			s.serverRequest(&msg)
+		case msg.Method == "textDocument/publishDiagnostics":
+			out := s.toPeers(body)
+			var params struct {
+				URI string `json:"uri"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			s.mu.Lock()
+			s.diagnostics[params.URI] = out
+			s.mu.Unlock()
+			s.broadcast(out)
+		case msg.Method == "window/logMessage":
+			// chatty and only interesting to whoever runs the server
+		default:
+			s.broadcast(s.toPeers(body))
+		}
+	}
+}
+
+// answer routes a response to whoever asked, with the id they used
+func (s *session) answer(msg *message) {
+	id, err := strconv.ParseInt(string(*msg.ID), 10, 64)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	req, found := s.requests[id]
+	delete(s.requests, id)
+	s.mu.Unlock()
+	if !found {
+		return
+	}
+	if req.reply != nil {
+		req.reply <- msg
+		return
+	}
+	msg.ID = req.id
+	out, _ := json.Marshal(msg)
+	if err := req.peer.send(s.toPeers(out)); err != nil {
+		log.Printf("Error sending language server answer in room %s: %v", s.roomId, err)
+	}
+}
+
+// serverRequest answers what servers ask of the editor, the gateway plays a client without settings
+func (s *session) serverRequest(msg *message) {
+	var result interface{}
+	if msg.Method == "workspace/configuration" {
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		result = make([]interface{}, len(params.Items))
+	}
+	if err := s.write(response(msg.ID, result)); err != nil {
+		log.Printf("Error answering language server in room %s: %v", s.roomId, err)
+	}
+}
+
+// peerMethods are the requests browsers may make, all of them only read. commands in particular
+// never reach the server, some run programs on the host (gopls.generate, gopls.run_tests)
+var peerMethods = map[string]bool{
+	"textDocument/completion":     true,
+	"textDocument/hover":          true,
+	"textDocument/signatureHelp":  true,
+	"textDocument/definition":     true,
+	"textDocument/references":     true,
+	"textDocument/documentSymbol": true,
+	"textDocument/formatting":     true,
+}
+
+// roomURIs tells whether the request is about one of the room's files and names no others: every
+// file uri in the params has to be a plain name under virtualRoot
+func roomURIs(params json.RawMessage) bool {
+	var request struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if json.Unmarshal(params, &request) != nil || request.TextDocument.URI == "" {
+		return false
+	}
+	var value interface{}
+	if json.Unmarshal(params, &value) != nil {
+		return false
+	}
+	return allRoomURIs(value)
+}
+
+func allRoomURIs(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, ":") || !strings.HasPrefix(strings.ToLower(v), "file:") {
+			return true
+		}
+		if !strings.HasPrefix(v, virtualRoot) {
+			return false
+		}
+		name, err := url.PathUnescape(strings.TrimPrefix(v, virtualRoot))
+		return err == nil && name != ".." && name == safeName(name)
+	case map[string]interface{}:
+		for _, item := range v {
+			if !allRoomURIs(item) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if !allRoomURIs(item) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fromPeer handles a message a browser sent
+func (s *session) fromPeer(p *peer, body []byte) {
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return
+	}
+	switch msg.Method {
+	case "initialize":
+		// the server is shared and already initialized, the peer gets its capabilities
+		s.mu.Lock()
+		capabilities := s.capabilities
+		s.mu.Unlock()
+		p.send(response(msg.ID, map[string]interface{}{"capabilities": capabilities}))
+		return
+	case "shutdown":
+		p.send(response(msg.ID, nil))
+		return
+	case "$/cancelRequest":
+		s.cancel(p, msg.Params)
+		return
+	}
+
+	// anything else a peer may only ask, never tell: the document comes from the hub and the
+	// lifecycle belongs to the gateway, so notifications and answers to server requests are dropped
+	if !msg.isRequest() {
+		return
+	}
+	if !peerMethods[msg.Method] {
+		p.send(errorResponse(msg.ID, codeMethodNotFound, msg.Method+" is not available"))
+		return
+	}
+	if !roomURIs(msg.Params) {
+		p.send(errorResponse(msg.ID, codeInvalidParams, "only the room's files can be asked about"))
+		return
+	}
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.requests[id] = pending{peer: p, id: msg.ID}
+	s.mu.Unlock()
+	msg.ID = rawID(id)
+
+	out, _ := json.Marshal(msg)
+	if err := s.write(out); err != nil {
+		log.Printf("Error writing to language server in room %s: %v", s.roomId, err)
+	}
+}
+
+// cancel passes a cancellation on under the id the server knows the request by
+func (s *session) cancel(p *peer, params json.RawMessage) {
+	var cancel struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(params, &cancel) != nil {
+		return
+	}
+	s.mu.Lock()
+	var serverID int64
+	for id, req := range s.requests {
+		if req.peer == p && bytes.Equal(*req.id, cancel.ID) {
+			serverID = id
+			break
+		}
+	}
+	s.mu.Unlock()
+	if serverID != 0 {
+		s.write(notification("$/cancelRequest", map[string]int64{"id": serverID}))
+	}
+}
+
+func (s *session) toPeers(body []byte) []byte {
+	return bytes.ReplaceAll(body, []byte(s.rootURI+"/"), []byte(virtualRoot))
+}
+
+func (s *session) broadcast(msg []byte) {
+	s.mu.Lock()
+	peers := make([]*peer, 0, len(s.peers))
+	for p := range s.peers {
+		peers = append(peers, p)
+	}
+	s.mu.Unlock()
+	for _, p := range peers {
+		if err := p.send(msg); err != nil {
+			log.Printf("Error sending to language server peer in room %s: %v", s.roomId, err)
+		}
+	}
+}
+
+// attach adds a peer and replays the current diagnostics to it
+func (s *session) attach(p *peer) bool {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return false
+	}
+	s.peers[p] = true
+	if s.idle != nil {
+		s.idle.Stop()
+		s.idle = nil
+	}
+	diagnostics := make([][]byte, 0, len(s.diagnostics))
+	for _, msg := range s.diagnostics {
+		diagnostics = append(diagnostics, msg)
+	}
+	s.mu.Unlock()
+
+	for _, msg := range diagnostics {
+		p.send(msg)
+	}
+	return true
+}
+
+// detach drops the peer and its open requests, the server is stopped after a while without peers
+func (s *session) detach(p *peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.peers, p)
+	for id, req := range s.requests {
+		if req.peer == p {
+			delete(s.requests, id)
+		}
+	}
+	if len(s.peers) == 0 && !s.stopped {
+		s.idle = time.AfterFunc(s.manager.idleTimeout, func() {
+			s.manager.remove(s, "")
+		})
+	}
+}
+
+// update stores the latest document and wakes the sync loop, it never blocks since the hub calls it
+// with its lock held
+func (s *session) update(files []models.CodeFile) {
+	s.mu.Lock()
+	s.latest = files
+	s.mu.Unlock()
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// syncLoop sends the server the files in its language as full text changes, edits made while a
+// change is being written are folded into the next one
+func (s *session) syncLoop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.changed:
+		}
+		s.mu.Lock()
+		files := s.latest
+		s.mu.Unlock()
+
+		for _, file := range files {
+			if !s.handles(file) {
+				continue
+			}
+			name := safeName(file.Name)
+			if content, found := s.synced[name]; found && content == file.Content {
+				continue
+			}
+			// servers look at the disk for files that aren't open, keep it current too
+			if err := os.WriteFile(filepath.Join(s.dir, name), []byte(file.Content), 0o600); err != nil {
+				log.Printf("Failed to write %s for the language server of room %s: %v", name, s.roomId, err)
+			}
+			uri := virtualRoot + name
+			var err error
+			if version, open := s.versions[name]; open {
+				s.versions[name] = version + 1
+				err = s.write(notification("textDocument/didChange", map[string]interface{}{
+					"textDocument":   map[string]interface{}{"uri": uri, "version": version + 1},
+					"contentChanges": []map[string]string{{"text": file.Content}},
+				}))
+			} else {
+				s.versions[name] = 1
+				err = s.write(notification("textDocument/didOpen", map[string]interface{}{
+					"textDocument": map[string]interface{}{"uri": uri, "languageId": s.language, "version": 1, "text": file.Content},
+				}))
+			}
+			if err != nil {
+				log.Printf("Failed to sync %s to the language server of room %s: %v", name, s.roomId, err)
+				continue
+			}
+			s.synced[name] = file.Content
+		}
+	}
+}
+
+// handles tells whether the file belongs to this server, by its language or else by its extension
+func (s *session) handles(file models.CodeFile) bool {
+	language := formatter.Normalize(file.Language)
+	if language == "" {
+		language = extensions[filepath.Ext(file.Name)]
+	}
+	return language == s.language
+}
+
+// stop ends the server and removes its workspace, safe to call more than once
+func (s *session) stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	s.mu.Unlock()
+	close(s.done)
+
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.write(notification("exit", nil))
+		s.stdin.Close()
+		exited := make(chan struct{})
+		go func() {
+			s.cmd.Wait()
+			close(exited)
+		}()
+		select {
+		case <-exited:
+		case <-time.After(2 * time.Second):
+			s.cmd.Process.Kill()
+			<-exited
+		}
+	}
+	os.RemoveAll(s.dir)
+}
+
+// closePeers disconnects everybody, the read loops in HandleWebSocket clean up after them
+func (s *session) closePeers(code int, reason string) {
+	s.mu.Lock()
+	peers := make([]*peer, 0, len(s.peers))
+	for p := range s.peers {
+		peers = append(peers, p)
+	}
+	s.mu.Unlock()
+	for _, p := range peers {
+		p.close(code, reason)
+	}
+}
@@ -0,0 +1,39 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRoomURIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   bool
+	}{
+		{"room file", `{"textDocument":{"uri":"file:///room/main.go"},"position":{"line":1,"character":2}}`, true},
+		{"escaped name", `{"textDocument":{"uri":"file:///room/my%20file.py"}}`, true},
+		{"no document", `{"position":{"line":1,"character":2}}`, false},
+		{"host file", `{"textDocument":{"uri":"file:///etc/passwd"}}`, false},
+		{"traversal", `{"textDocument":{"uri":"file:///room/../../etc/passwd"}}`, false},
+		{"escaped traversal", `{"textDocument":{"uri":"file:///room/..%2F..%2Fetc%2Fpasswd"}}`, false},
+		{"subdirectory", `{"textDocument":{"uri":"file:///room/a/b.go"}}`, false},
+		{"other uri in params", `{"textDocument":{"uri":"file:///room/main.go"},"context":{"extra":["FILE:///etc/shadow"]}}`, false},
+		{"plain strings", `{"textDocument":{"uri":"file:///room/main.go"},"options":{"label":"a: b"}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roomURIs(json.RawMessage(tt.params)); got != tt.want {
+				t.Errorf("roomURIs(%s) = %v, want %v", tt.params, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeerMethods(t *testing.T) {
+	for _, method := range []string{"workspace/executeCommand", "workspace/symbol", "textDocument/codeAction", "textDocument/rename"} {
+		if peerMethods[method] {
+			t.Errorf("%s is forwarded to the language server", method)
+		}
+	}
+}
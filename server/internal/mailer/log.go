@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogMailer is the local development / test stand-in, mails are logged and
+// optionally written to Dir as .eml files so links can be clicked
+type LogMailer struct {
+	Dir string
+
+	mu   sync.Mutex
+	Sent []Message // kept in memory so tests can inspect what would have been sent
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	m.Sent = append(m.Sent, msg)
+	m.mu.Unlock()
+
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+
+	if m.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage("geekcode@localhost", msg), 0o644)
+}
+
+// Last returns the most recent message, handy in tests
+func (m *LogMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.Sent) == 0 {
+		return Message{}, false
+	}
+	return m.Sent[len(m.Sent)-1], true
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"geekCode/internal/config"
+	"log"
+)
+
+type Message struct {
+	To          string
+	Subject     string
+	Body        string // plain text
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string // e.g. "text/calendar; method=REQUEST"
+	Data        []byte
+}
+
+// Mailer sends transactional emails (verification links, password resets ...)
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// picks smtp when a host is configured, otherwise mails are only written locally
+func New(cfg *config.Config) Mailer {
+	if cfg.SMTPHost != "" {
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	}
+	log.Printf("SMTP_HOST not set, emails will be logged instead of sent")
+	return &LogMailer{Dir: cfg.MailDir}
+}
@@ -4,13 +4,18 @@ import (
 	"fmt"
 	"net/http"
 	"strings" 	
+	"time"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 
 	"geekCode/internal/auth"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
 )
 
 
-func AuthMiddleware(secret string) gin.HandlerFunc {
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) { //anonymous function
 		authHeader := c.GetHeader("Authorization")
 		fmt.Printf("Auth Header: %s\n", authHeader) // Debugging line to print the auth header
@@ -26,14 +31,44 @@ func AuthMiddleware(secret string) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "invalid auth header"})
 			return
 		}
+		//personal api tokens are opaque, they are looked up instead of parsed
+		if auth.IsAPIToken(parts[1]) {
+			authenticateAPIToken(c, db, parts[1])
+			return
+		}
 		fmt.Printf("Token: %s\n", parts[1]) // Debugging line to print the token part	
-		userID, err := auth.ValidateToken(parts[1], secret)
-
+		claims, err := auth.ParseToken(parts[1])
 		if err != nil {
 			fmt.Printf("Token Validation Error: %v\n", err) // Debugging line to print the error
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "invalid auth token"})
 			return
 		}
+		userID, err := auth.UserIDFromClaims(claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "invalid auth token"})
+			return
+		}
+
+		//tokens revoked on logout stay valid signature wise, so we check the denylist by jti
+		var revoked int64
+		if err := db.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&revoked).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error" : "failed to verify token"})
+			return
+		}
+		if revoked > 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "token has been revoked"})
+			return
+		}
+		//a password reset ends every session at once, without listing their jtis
+		var user models.User
+		if err := db.Select("id", "tokens_valid_after").First(&user, userID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "invalid auth token"})
+			return
+		}
+		if issuedBefore(claims.IssuedAt, user.TokensValidAfter) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "token has been revoked"})
+			return
+		}
 
 
 		//attaching user id to context (works like localstorage in js) , but its the gins context storage
@@ -46,6 +81,117 @@ func AuthMiddleware(secret string) gin.HandlerFunc {
 		*/
 
 		c.Set("userId", userID)
+		c.Set("tokenId", claims.ID)
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
 		c.Next() 
 	}
 }
+
+// iat only has whole seconds, so a token from the same second as the cutoff counts as older
+func issuedBefore(iat *jwt.NumericDate, cutoff *time.Time) bool {
+	if cutoff == nil {
+		return false
+	}
+	return iat == nil || !iat.Time.After(cutoff.Truncate(time.Second))
+}
+
+// last used is only written once a minute so busy ci jobs don't turn every request into an update
+const apiTokenTouchInterval = time.Minute
+
+func authenticateAPIToken(c *gin.Context, db *gorm.DB, raw string) {
+	var token models.APIToken
+	if err := db.First(&token, "token_hash = ?", auth.HashToken(raw)).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "invalid auth token"})
+		return
+	}
+	now := time.Now()
+	if token.RevokedAt != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "token has been revoked"})
+		return
+	}
+	if now.After(token.ExpiresAt) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "token has expired"})
+		return
+	}
+	//api tokens only reach the routes that opted in, everything else is session only
+	if !c.GetBool(apiTokensAllowedKey) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error" : "not available for api tokens"})
+		return
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval {
+		db.Model(&models.APIToken{}).Where("id = ?", token.ID).Update("last_used_at", now)
+	}
+
+	scopes := token.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	c.Set("userId", token.UserID)
+	c.Set("apiTokenId", token.ID)
+	c.Set("scopes", scopes)
+	c.Next()
+}
+
+// set by AllowAPITokens, api tokens are only accepted on routes that opted in
+const apiTokensAllowedKey = "apiTokensAllowed"
+
+// AllowAPITokens lets personal api tokens through the AuthMiddleware after it, every route
+// behind it has to check a scope (RequireScope, RequireRoomPermission or RequireOrgPermission)
+func AllowAPITokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiTokensAllowedKey, true)
+		c.Next()
+	}
+}
+
+// RequireScope limits api tokens to the routes their scopes cover, login jwts pass through
+func RequireScope(perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !rbac.ScopeAllows(c.GetStringSlice("scopes"), perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error" : "token scope does not include " + string(perm)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionOnly keeps api tokens away from account management (logout, 2fa, tokens themselves)
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAPIToken := c.Get("apiTokenId"); isAPIToken {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error" : "not available for api tokens"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// browsers can't set headers on websocket upgrades, so they trade their token for a short lived single
+// use ?ticket= first (POST /api/ws-ticket), other clients send the Authorization header as usual
+func WebSocketAuth(db *gorm.DB) gin.HandlerFunc {
+	authenticate := AuthMiddleware(db)
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			authenticate(c)
+			return
+		}
+		now := time.Now()
+		//conditional update so a ticket opens one connection at most
+		res := db.Model(&models.UserToken{}).
+			Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", auth.HashToken(ticket), models.TokenPurposeWebSocket, now).
+			Update("used_at", now)
+		if res.Error != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error" : "failed to verify ticket"})
+			return
+		}
+		var token models.UserToken
+		if res.RowsAffected == 0 || db.First(&token, "token_hash = ?", auth.HashToken(ticket)).Error != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error" : "invalid or expired ticket"})
+			return
+		}
+		c.Set("userId", token.UserID)
+		c.Next()
+	}
+}
@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"geekCode/internal/auth"
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.APIToken{}, &models.RevokedToken{}, &models.UserToken{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint{1, 3} {
+		db.Create(&models.User{ID: id, Username: fmt.Sprint("user", id), Email: fmt.Sprint("user", id, "@example.com")})
+	}
+	if _, err := auth.Init(auth.KeyConfig{Algorithm: "HS256", Secret: "test-secret", Issuer: "geekcode-test"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAPITokensNeedAnOptedInRoute(t *testing.T) {
+	db := newTestDB(t)
+
+	apiToken, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.APIToken{UserID: 1, Name: "ci", Prefix: apiToken[:8], TokenHash: hash, Scopes: []string{string(rbac.RoomView)}, ExpiresAt: time.Now().Add(time.Hour)})
+	session, _, err := auth.GenerateToken(1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	protected := r.Group("/")
+	protected.Use(AuthMiddleware(db))
+	protected.GET("/profile", ok)
+	// a scope check alone doesn't let api tokens in, the route has to opt in
+	protected.GET("/orgs", RequireScope(rbac.RoomView), ok)
+	scoped := r.Group("/")
+	scoped.Use(AllowAPITokens(), AuthMiddleware(db))
+	scoped.GET("/rooms", RequireScope(rbac.RoomView), ok)
+	scoped.POST("/rooms", RequireScope(rbac.RoomCreate), ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"api token on a session route", http.MethodGet, "/profile", apiToken, http.StatusForbidden},
+		{"api token on a route that didn't opt in", http.MethodGet, "/orgs", apiToken, http.StatusForbidden},
+		{"api token within its scope", http.MethodGet, "/rooms", apiToken, http.StatusOK},
+		{"api token outside its scope", http.MethodPost, "/rooms", apiToken, http.StatusForbidden},
+		{"session on a session route", http.MethodGet, "/profile", session, http.StatusOK},
+		{"session on a scoped route", http.MethodPost, "/rooms", session, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebSocketTickets(t *testing.T) {
+	db := newTestDB(t)
+	ticket := func(expiresAt time.Time) string {
+		raw, hash, err := auth.GenerateOpaqueToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Create(&models.UserToken{UserID: 3, Purpose: models.TokenPurposeWebSocket, TokenHash: hash, ExpiresAt: expiresAt})
+		return raw
+	}
+	// a password reset token is single use too, but it doesn't open websockets
+	reset, hash, _ := auth.GenerateOpaqueToken()
+	db.Create(&models.UserToken{UserID: 3, Purpose: models.TokenPurposePasswordReset, TokenHash: hash, ExpiresAt: time.Now().Add(time.Hour)})
+	session, _, _ := auth.GenerateToken(3, time.Hour)
+
+	r := gin.New()
+	r.GET("/ws", WebSocketAuth(db), func(c *gin.Context) {
+		c.String(http.StatusOK, "%d", c.MustGet("userId").(uint))
+	})
+	get := func(query, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ws"+query, nil)
+		if header != "" {
+			req.Header.Set("Authorization", "Bearer "+header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	valid := ticket(time.Now().Add(time.Minute))
+	if w := get("?ticket="+valid, ""); w.Code != http.StatusOK || w.Body.String() != "3" {
+		t.Fatalf("valid ticket: %d %s", w.Code, w.Body.String())
+	}
+	if w := get("?ticket="+valid, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("ticket used twice: %d", w.Code)
+	}
+	if w := get("?ticket="+ticket(time.Now().Add(-time.Second)), ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired ticket: %d", w.Code)
+	}
+	if w := get("?ticket="+reset, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("token of another purpose: %d", w.Code)
+	}
+	if w := get("?token="+session, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token in the url: %d", w.Code)
+	}
+	if w := get("", session); w.Code != http.StatusOK {
+		t.Errorf("authorization header: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTokensIssuedBeforeTheCutoff(t *testing.T) {
+	db := newTestDB(t)
+	r := gin.New()
+	r.GET("/profile", AuthMiddleware(db), func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	before, _, _ := auth.GenerateToken(1, time.Hour)
+	db.Model(&models.User{}).Where("id = ?", 1).Update("tokens_valid_after", time.Now())
+	if code := get(before); code != http.StatusUnauthorized {
+		t.Errorf("token from before the password reset: %d", code)
+	}
+
+	// a login after the reset works again
+	db.Model(&models.User{}).Where("id = ?", 1).Update("tokens_valid_after", time.Now().Add(-2*time.Second))
+	after, _, _ := auth.GenerateToken(1, time.Hour)
+	if code := get(after); code != http.StatusOK {
+		t.Errorf("token from after the password reset: %d", code)
+	}
+
+	// so does a token of a user that never reset anything, an unknown user doesn't
+	other, _, _ := auth.GenerateToken(3, time.Hour)
+	if code := get(other); code != http.StatusOK {
+		t.Errorf("token without a cutoff: %d", code)
+	}
+	gone, _, _ := auth.GenerateToken(99, time.Hour)
+	if code := get(gone); code != http.StatusUnauthorized {
+		t.Errorf("token of a deleted user: %d", code)
+	}
+}
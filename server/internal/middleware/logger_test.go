@@ -0,0 +1,21 @@
+package middleware
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/rooms", "/api/rooms"},
+		{"/api/rooms?status=active", "/api/rooms?status=active"},
+		{"/api/ws/abc?ticket=s3cret", "/api/ws/abc?ticket=REDACTED"},
+		{"/api/lsp/abc/go?token=s3cret&x=1", "/api/lsp/abc/go?token=REDACTED&x=1"},
+		{"/api/ws/abc?ticket=%zz", "/api/ws/abc"},
+	}
+	for _, tt := range tests {
+		if got := redactQuery(tt.path); got != tt.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"geekCode/internal/models"
+	"geekCode/internal/rbac"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRoomPermission loads the :roomId room and checks the caller's roles on it,
+// the room and roles are left in the context for the handler
+func RequireRoomPermission(engine *rbac.Engine, perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+
+		var room models.Room
+		if err := engine.DB().Where("room_id = ?", c.Param("roomId")).First(&room).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Room not found!"})
+			return
+		}
+		roles, err := engine.RoomRoles(userId, &room)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+			return
+		}
+		// people with no relation to the room shouldn't learn it exists
+		if len(roles) == 0 {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Room not found!"})
+			return
+		}
+		if !engine.Allows(roles, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + string(perm)})
+			return
+		}
+		if !rbac.ScopeAllows(c.GetStringSlice("scopes"), perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token scope does not include " + string(perm)})
+			return
+		}
+
+		c.Set("room", &room)
+		c.Set("roles", roles)
+		c.Next()
+	}
+}
+
+// RequireOrgPermission does the same for the :orgId org routes
+func RequireOrgPermission(engine *rbac.Engine, perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+
+		orgID, err := strconv.ParseUint(c.Param("orgId"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid orgId"})
+			return
+		}
+		roles, err := engine.OrgRoles(userId, uint(orgID))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+			return
+		}
+		if len(roles) == 0 {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+			return
+		}
+		if !engine.Allows(roles, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + string(perm)})
+			return
+		}
+		if !rbac.ScopeAllows(c.GetStringSlice("scopes"), perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token scope does not include " + string(perm)})
+			return
+		}
+
+		c.Set("orgId", uint(orgID))
+		c.Set("roles", roles)
+		c.Next()
+	}
+}
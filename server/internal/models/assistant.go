@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// who may use the ai assistant in a room, stored under "assistant" in the room settings
+type AssistantSettings struct {
+	Enabled bool     `json:"enabled"`
+	Roles   []string `json:"roles"` // rbac roles allowed to ask, e.g. "owner", "interviewer", "candidate"
+}
+
+const assistantSettingsKey = "assistant"
+
+// rooms that never set anything keep the assistant away from candidates
+func DefaultAssistantSettings() AssistantSettings {
+	return AssistantSettings{Enabled: true, Roles: []string{"owner", "org_admin", "interviewer"}}
+}
+
+// Assistant reads the assistant settings, falling back to the defaults when they are missing or unreadable
+func (s RoomSettings) Assistant() AssistantSettings {
+	raw, found := s[assistantSettingsKey]
+	if !found {
+		return DefaultAssistantSettings()
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return DefaultAssistantSettings()
+	}
+	var settings AssistantSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return DefaultAssistantSettings()
+	}
+	return settings
+}
+
+// WithAssistant returns a copy of the settings with the assistant settings replaced
+func (s RoomSettings) WithAssistant(assistant AssistantSettings) RoomSettings {
+	settings := make(RoomSettings, len(s)+1)
+	for key, value := range s {
+		settings[key] = value
+	}
+	settings[assistantSettingsKey] = assistant
+	return settings
+}
+
+// one question to the assistant, counted against the user's and the org's quota
+type AssistantUsage struct {
+	ID               uint   `gorm:"primaryKey"`
+	UserID           uint   `gorm:"index:idx_assistant_usage_user;not null"`
+	OrgID            *uint  `gorm:"index:idx_assistant_usage_org"` // the room's org, nil for personal rooms
+	RoomID           string `gorm:"index;not null"`                // This references Room.RoomID
+	Provider         string
+	PromptTokens     int
+	CompletionTokens int
+	Failed           bool
+	CreatedAt        time.Time `gorm:"index:idx_assistant_usage_user;index:idx_assistant_usage_org"`
+}
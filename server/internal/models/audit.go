@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// one row per rejected login, kept for security reviews
+type LoginAudit struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    *uint  `gorm:"index"` // nil when the email doesn't belong to an account
+	Email     string `gorm:"index"`
+	IP        string `gorm:"index"`
+	UserAgent string
+	Reason    string    // invalid_password, unknown_email, throttled ...
+	CreatedAt time.Time `gorm:"index"`
+}
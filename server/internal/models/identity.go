@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// links a user to an account at an external identity provider (oidc "sub" claim)
+type UserIdentity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Provider  string `gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Subject   string `gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Email     string
+	CreatedAt time.Time
+	User      User `gorm:"foreignKey:UserID;references:ID"`
+}
+
+// pending oidc logins, the state comes back on the callback and is consumed once
+type OAuthState struct {
+	State        string    `gorm:"primaryKey"`
+	Provider     string    `gorm:"not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"index;not null"`
+	CreatedAt    time.Time
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type IntegrityKind string
+
+const (
+	IntegrityPaste     IntegrityKind = "paste"      // reported by the browser
+	IntegrityFocusLost IntegrityKind = "focus_lost" // reported by the browser
+	IntegrityTabHidden IntegrityKind = "tab_hidden" // reported by the browser
+	IntegrityLargeEdit IntegrityKind = "large_edit" // detected by the hub from the edit stream
+)
+
+// a proctoring signal about a participant, only interviewers get to see them
+type IntegrityEvent struct {
+	ID         uint          `gorm:"primaryKey" json:"id"`
+	RoomID     string        `gorm:"index:idx_integrity_room;not null" json:"roomId"` // This references Room.RoomID
+	UserID     uint          `gorm:"not null" json:"userId"`
+	User       string        `json:"user"`
+	Kind       IntegrityKind `gorm:"not null" json:"kind"`
+	Source     string        `json:"source"` // "client" or "server"
+	FileName   string        `json:"fileName,omitempty"`
+	Chars      int           `json:"chars,omitempty"`      // pasted or inserted characters
+	DurationMs int64         `json:"durationMs,omitempty"` // how long the focus was away, when the browser knows
+	CreatedAt  time.Time     `gorm:"index:idx_integrity_room" json:"createdAt"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// live state of a room as seen by the websocket hub, it is never stored
+type LiveRoom struct {
+	Participants     []LiveParticipant `json:"participants"`
+	ParticipantCount int               `json:"participantCount"`
+	LastActivity     *time.Time        `json:"lastActivity,omitempty"`
+	Language         string            `json:"language,omitempty"`
+	Running          *LiveExecution    `json:"running,omitempty"`
+}
+
+type LiveParticipant struct {
+	User     string    `json:"user"`
+	UserID   string    `json:"userId"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// a run somebody started in the room that hasn't reported a result yet
+type LiveExecution struct {
+	User      string    `json:"user"`
+	Language  string    `json:"language,omitempty"`
+	FileName  string    `json:"fileName,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
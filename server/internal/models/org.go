@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+type OrgRole string
+
+const (
+	OrgRoleAdmin       OrgRole = "admin"
+	OrgRoleInterviewer OrgRole = "interviewer"
+)
+
+func (r OrgRole) Valid() bool {
+	return r == OrgRoleAdmin || r == OrgRoleInterviewer
+}
+
+type Organization struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"not null"`
+	Slug      string `gorm:"uniqueIndex;not null"`
+	CreatedBy uint   `gorm:"not null"`
+	CreatedAt time.Time
+	Members   []OrgMember `gorm:"foreignKey:OrgID" json:",omitempty"`
+}
+
+type OrgMember struct {
+	ID        uint    `gorm:"primaryKey"`
+	OrgID     uint    `gorm:"uniqueIndex:idx_org_member;not null"`
+	UserID    uint    `gorm:"uniqueIndex:idx_org_member;index;not null"`
+	Role      OrgRole `gorm:"not null;default:interviewer"`
+	CreatedAt time.Time
+	User      User `gorm:"foreignKey:UserID;references:ID"`
+}
+
+// teams group interviewers inside an org, rooms can optionally belong to one
+type Team struct {
+	ID        uint   `gorm:"primaryKey"`
+	OrgID     uint   `gorm:"index;not null"`
+	Name      string `gorm:"not null"`
+	CreatedAt time.Time
+	Members   []TeamMember `gorm:"foreignKey:TeamID" json:",omitempty"`
+}
+
+type TeamMember struct {
+	ID        uint `gorm:"primaryKey"`
+	TeamID    uint `gorm:"uniqueIndex:idx_team_member;not null"`
+	UserID    uint `gorm:"uniqueIndex:idx_team_member;not null"`
+	CreatedAt time.Time
+	User      User `gorm:"foreignKey:UserID;references:ID"`
+}
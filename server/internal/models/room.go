@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
 
 type Status int
 
@@ -8,8 +12,23 @@ const (
     Active Status = iota
     Ended
     Archived
+    Scheduled // created ahead of time, becomes active when the join window opens
 )
 
+func (s Status) String() string {
+    switch s {
+    case Active:
+        return "active"
+    case Ended:
+        return "ended"
+    case Archived:
+        return "archived"
+    case Scheduled:
+        return "scheduled"
+    }
+    return "unknown"
+}
+
 type Room struct {
     ID        uint      `gorm:"primaryKey"`
     Name      string    `gorm:"not null"`
@@ -18,6 +37,38 @@ type Room struct {
     CreatedBy uint      `gorm:"not null"` // the user ID who created the room
     Creator   User      `gorm:"foreignKey:CreatedBy;references:ID"`
     Status    Status    `gorm:"default:0"` // Default to Active
+    OrgID     *uint     `gorm:"index"` // nil for personal rooms
+    TeamID    *uint     `gorm:"index"`
+    Language  string    `gorm:"index"` // main language of the interview, used for filtering
+    Tags      []RoomTag `gorm:"foreignKey:RoomID;references:RoomID"`
+    TemplateID      *uint        `gorm:"index"` // the template the room was created from
+    Files           []CodeFile   `gorm:"serializer:json"` // starter files, the hub seeds the editor with them
+    DurationMinutes int
+    Settings        RoomSettings `gorm:"serializer:json"`
+    Problems        []Problem    `gorm:"many2many:room_problems"`
+    ScheduledStart  *time.Time   `gorm:"index"`
+    AutoEndAt       *time.Time   `gorm:"index"` // the scheduler ends the room at this time, cleared on reopen
+    Attendees       []Attendee   `gorm:"serializer:json"`
+    InviteSequence  int          // bumped whenever the invite changes so calendars update it
+    CandidateID     *uint        `gorm:"index"` // the user being interviewed, scorecards are linked to them
+    RubricID        *uint        // what the interviewers score, the default rubric when nil
+    EndedAt   *time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"` // soft delete, purged after the retention period
+    Live      *LiveRoom `gorm:"-"` // filled from the websocket hub, not stored
+}
+
+type Attendee struct {
+    Email string `json:"email"`
+    Name  string `json:"name,omitempty"`
+    Role  string `json:"role,omitempty"` // interviewer or candidate
+}
+
+// free form labels like "backend" or "senior" used to filter the room list
+type RoomTag struct {
+    ID     uint   `gorm:"primaryKey"`
+    RoomID string `gorm:"uniqueIndex:idx_room_tag;not null"` // This references Room.RoomID
+    Tag    string `gorm:"uniqueIndex:idx_room_tag;index;not null"`
 }
 
 type Client struct {
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// one thing the interviewers rate, like "problem solving"
+type RubricCriterion struct {
+	Key         string  `json:"key"`
+	Label       string  `json:"label"`
+	Description string  `json:"description,omitempty"`
+	Weight      float64 `json:"weight"` // share of the overall score, relative to the other criteria
+}
+
+// the criteria interviewers score a room on, personal or shared with an org
+type Rubric struct {
+	ID        uint              `gorm:"primaryKey"`
+	Name      string            `gorm:"not null"`
+	Criteria  []RubricCriterion `gorm:"serializer:json"`
+	Scale     int               `gorm:"not null"` // ratings go from 1 to Scale
+	OrgID     *uint             `gorm:"index"`
+	CreatedBy uint              `gorm:"index;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Recommendation string
+
+const (
+	StrongNoHire Recommendation = "strong_no_hire"
+	NoHire       Recommendation = "no_hire"
+	Hire         Recommendation = "hire"
+	StrongHire   Recommendation = "strong_hire"
+)
+
+type CriterionRating struct {
+	Criterion string `json:"criterion"` // RubricCriterion.Key
+	Score     int    `json:"score"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+// an interviewer's feedback on a room, one per interviewer
+type Scorecard struct {
+	ID            uint   `gorm:"primaryKey"`
+	RoomID        string `gorm:"uniqueIndex:idx_scorecard_interviewer;not null"` // This references Room.RoomID
+	InterviewerID uint   `gorm:"uniqueIndex:idx_scorecard_interviewer;not null"`
+	CandidateID   *uint  `gorm:"index"`
+	RubricID      *uint
+	// copied from the rubric so editing it later doesn't change written feedback
+	Criteria       []RubricCriterion `gorm:"serializer:json"`
+	Scale          int
+	Ratings        []CriterionRating `gorm:"serializer:json"`
+	Notes          string            `gorm:"type:text"`
+	Recommendation Recommendation
+	SubmittedAt    *time.Time // nil while it's a draft, submitted scorecards can't change anymore
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
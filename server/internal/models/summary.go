@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// output of a run shared in the room
+type RunRecord struct {
+	User     string    `json:"user"`
+	Language string    `json:"language,omitempty"`
+	FileName string    `json:"fileName,omitempty"`
+	Output   string    `json:"output,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// a change big enough to stand out (a paste, rewriting a function, deleting a file's content)
+type EditSnapshot struct {
+	User     string    `json:"user"`
+	FileName string    `json:"fileName"`
+	Delta    int       `json:"delta"` // characters added, negative when removed
+	Size     int       `json:"size"`  // size of the file afterwards
+	At       time.Time `json:"at"`
+}
+
+// what the editor looked like when the room ended, the summary is written from it
+type Submission struct {
+	ID        uint   `gorm:"primaryKey"`
+	RoomID    string `gorm:"uniqueIndex;not null"` // This references Room.RoomID
+	Language  string
+	Files     []CodeFile     `gorm:"serializer:json"`
+	Runs      []RunRecord    `gorm:"serializer:json"`
+	Timeline  []EditSnapshot `gorm:"serializer:json"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type SummaryStatus string
+
+const (
+	SummaryPending SummaryStatus = "pending"
+	SummaryReady   SummaryStatus = "ready"
+	SummaryFailed  SummaryStatus = "failed"
+)
+
+// the ai written summary of the candidate's solution
+type RoomSummary struct {
+	ID        uint          `gorm:"primaryKey"`
+	RoomID    string        `gorm:"uniqueIndex;not null"` // This references Room.RoomID
+	Status    SummaryStatus `gorm:"not null"`
+	Content   string        `gorm:"type:text"` // markdown
+	Provider  string
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
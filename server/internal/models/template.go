@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// a file in the shared editor, also used for the starter files of templates and rooms
+type CodeFile struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+// settings are free form so new room options don't need a migration
+type RoomSettings map[string]interface{}
+
+// interview problems, personal or shared with an org
+type Problem struct {
+	ID          uint   `gorm:"primaryKey"`
+	Title       string `gorm:"not null"`
+	Description string `gorm:"type:text"`
+	Difficulty  string
+	OrgID       *uint `gorm:"index"`
+	CreatedBy   uint  `gorm:"index;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// a reusable room setup, rooms created from it get a copy so later template edits don't change them
+type RoomTemplate struct {
+	ID              uint   `gorm:"primaryKey"`
+	Name            string `gorm:"not null"`
+	Language        string
+	Files           []CodeFile `gorm:"serializer:json"`
+	DurationMinutes int
+	Settings        RoomSettings `gorm:"serializer:json"`
+	Problems        []Problem    `gorm:"many2many:template_problems"`
+	OrgID           *uint        `gorm:"index"`
+	CreatedBy       uint         `gorm:"index;not null"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
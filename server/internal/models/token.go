@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// refresh tokens are rotated on every use, the old one gets revoked and points to its replacement
+type RefreshToken struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"index;not null"`
+	TokenHash    string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	ReplacedByID *uint
+	GraceUsed    bool `gorm:"not null;default:false"` // a parallel refresh already got tokens with it after the rotation
+	CreatedAt    time.Time
+}
+
+// access tokens that were revoked before they expired (logout), keyed by their jti
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index;not null"` // after this the row can be purged
+	CreatedAt time.Time
+}
+
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeWebSocket         = "websocket"
+)
+
+// single use tokens mailed to the user (verify email, reset password), also the tickets browsers
+// open websockets with
+type UserToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	Purpose   string    `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// personal api tokens for scripts and ci, only the hash is stored
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null" json:"prefix"` // start of the token so users can tell them apart
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     []string   `gorm:"serializer:json;not null" json:"scopes"` // rbac permissions the token is limited to
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
@@ -3,12 +3,26 @@ package models
 import "time"
 
 type User struct {
-	ID        uint      `gorm:"primaryKey"`
-	FirstName string    `gorm:"not null"`
-	LastName  string    `gorm:"not null"` //corrected from Lastname to LastName
-	Username  string    `gorm:"unique;not null"`
-	Email     string    `gorm:"unique;not null"`
-	Password  string    `gorm:"not null"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	ID               uint   `gorm:"primaryKey"`
+	FirstName        string `gorm:"not null"`
+	LastName         string `gorm:"not null"` //corrected from Lastname to LastName
+	Username         string `gorm:"unique;not null"`
+	Email            string `gorm:"unique;not null"`
+	Password         string `gorm:"not null" json:"-"`
+	EmailVerifiedAt  *time.Time
+	TOTPEnabled      bool       `gorm:"not null;default:false"`
+	TOTPSecret       string     `json:"-"` // set on enrollment, only trusted once TOTPEnabled is true
+	TOTPLastStep     int64      `json:"-"` // last accepted time step, stops the same code from being used twice
+	TokensValidAfter *time.Time `json:"-"` // access tokens issued before this are rejected (set by a password reset)
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime"`
+}
+
+// one time codes to get in when the authenticator is lost, stored hashed
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
 }
@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"geekCode/internal/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "geekcode"
+	testRedirectURL = "http://localhost:8080/api/auth/oidc/mock/callback"
+)
+
+func testProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	server := oidctest.NewServer(testClientID)
+	t.Cleanup(server.Close)
+	provider := NewProvider(Config{
+		Name:        "mock",
+		Issuer:      server.Issuer(),
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, server.Client())
+	return provider, server
+}
+
+// login goes through the authorize endpoint the way a browser would and returns the code and state
+func login(t *testing.T, provider *Provider, server *oidctest.Server, state, nonce, challenge string) (string, string) {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL) {
+		t.Fatalf("redirected to %s", location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider, server := testProvider(t)
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := login(t, provider, server, "state-1", "nonce-1", challenge)
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+
+	tokens, err := provider.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), tokens.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	if claims.Subject != oidctest.Subject || claims.Email != "ada@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// codes are single use
+	if _, err := provider.Exchange(context.Background(), code, verifier); err == nil {
+		t.Error("a used code was exchanged again")
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("verifier length %d is outside RFC 7636's 43-128", len(verifier))
+	}
+	if strings.ContainsAny(verifier+challenge, "+/=") {
+		t.Error("verifier or challenge isn't unpadded base64url")
+	}
+	other, _, _ := NewPKCE()
+	if other == verifier {
+		t.Error("two verifiers are the same")
+	}
+
+	provider, server := testProvider(t)
+	tests := []struct {
+		name     string
+		verifier string
+		wantErr  bool
+	}{
+		{"matching verifier", verifier, false},
+		{"other verifier", other, true},
+		{"challenge sent as verifier", challenge, true},
+		{"no verifier", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := login(t, provider, server, "state", "nonce", challenge)
+			_, err := provider.Exchange(context.Background(), code, tt.verifier)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, server := testProvider(t)
+	now := time.Now()
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		nonce   string
+		wantErr string
+	}{
+		{"valid", jwt.MapClaims{"nonce": "n"}, "n", ""},
+		{"nonce mismatch", jwt.MapClaims{"nonce": "other"}, "n", "nonce mismatch"},
+		{"nonce missing", jwt.MapClaims{}, "n", "nonce mismatch"},
+		{"other issuer", jwt.MapClaims{"nonce": "n", "iss": "https://evil.example.com"}, "n", "issuer"},
+		{"other audience", jwt.MapClaims{"nonce": "n", "aud": "someone-else"}, "n", "audience"},
+		{"several audiences with azp", jwt.MapClaims{"nonce": "n", "aud": []string{testClientID, "api"}, "azp": testClientID}, "n", ""},
+		{"several audiences without azp", jwt.MapClaims{"nonce": "n", "aud": []string{testClientID, "api"}}, "n", "authorized party"},
+		{"several audiences, other azp", jwt.MapClaims{"nonce": "n", "aud": []string{testClientID, "api"}, "azp": "api"}, "n", "authorized party"},
+		{"expired", jwt.MapClaims{"nonce": "n", "iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-10 * time.Minute).Unix()}, "n", "expired"},
+		{"expired within leeway", jwt.MapClaims{"nonce": "n", "exp": now.Add(-30 * time.Second).Unix()}, "n", ""},
+		{"no expiry", jwt.MapClaims{"nonce": "n", "exp": nil}, "n", "exp"},
+		{"issued in the future", jwt.MapClaims{"nonce": "n", "iat": now.Add(time.Hour).Unix()}, "n", "before issued"},
+		{"no subject", jwt.MapClaims{"nonce": "n", "sub": nil}, "n", "subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), server.IDToken(tt.claims), tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyIDToken() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyIDToken() error = %v, want one about %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other := oidctest.NewServer(testClientID)
+		defer other.Close()
+		forged := other.IDToken(jwt.MapClaims{"nonce": "n", "iss": server.Issuer()})
+		if _, err := provider.VerifyIDToken(context.Background(), forged, "n"); err == nil {
+			t.Error("a token signed with another key was accepted")
+		}
+	})
+	t.Run("unsigned", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+			"iss": server.Issuer(), "aud": testClientID, "sub": "x", "nonce": "n", "exp": now.Add(time.Minute).Unix(),
+		})
+		unsigned, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if _, err := provider.VerifyIDToken(context.Background(), unsigned, "n"); err == nil {
+			t.Error("an unsigned token was accepted")
+		}
+	})
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	// a document that names another issuer, like a proxy or a misconfigured tenant would serve
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issuer": "https://evil.example.com", "authorization_endpoint": "https://evil.example.com/a",
+			"token_endpoint": "https://evil.example.com/t", "jwks_uri": "https://evil.example.com/k"}`))
+	}))
+	defer server.Close()
+	provider := NewProvider(Config{Name: "mock", Issuer: server.URL, ClientID: testClientID}, server.Client())
+	if _, err := provider.Discover(context.Background()); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Errorf("Discover() error = %v, want an issuer mismatch", err)
+	}
+}
@@ -0,0 +1,93 @@
+package rbac
+
+import (
+	"errors"
+	"geekCode/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Engine resolves which roles a user holds on a room or org and checks them against the policy
+type Engine struct {
+	db     *gorm.DB
+	policy *Policy
+}
+
+func NewEngine(db *gorm.DB, policy *Policy) *Engine {
+	return &Engine{db: db, policy: policy}
+}
+
+func (e *Engine) DB() *gorm.DB {
+	return e.db
+}
+
+func (e *Engine) Allows(roles []Role, perm Permission) bool {
+	return e.policy.Allows(roles, perm)
+}
+
+// RoomRoles returns the user's roles on the room, empty when they have nothing to do with it
+func (e *Engine) RoomRoles(userID uint, room *models.Room) ([]Role, error) {
+	var roles []Role
+	if room.CreatedBy == userID {
+		roles = append(roles, RoleOwner)
+	}
+	if room.OrgID != nil {
+		orgRoles, err := e.OrgRoles(userID, *room.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, orgRoles...)
+	}
+	if len(roles) > 0 {
+		return roles, nil
+	}
+	// the candidate the room was set up for, even before they joined
+	if room.CandidateID != nil && *room.CandidateID == userID {
+		return []Role{RoleCandidate}, nil
+	}
+
+	// anybody else only counts once they joined through the link
+	var joined int64
+	if err := e.db.Model(&models.Client{}).Where("room_id = ? AND user_id = ?", room.RoomID, userID).Count(&joined).Error; err != nil {
+		return nil, err
+	}
+	if joined > 0 {
+		roles = append(roles, RoleCandidate)
+	}
+	return roles, nil
+}
+
+// OrgRoles maps the org membership onto policy roles
+func (e *Engine) OrgRoles(userID, orgID uint) ([]Role, error) {
+	var member models.OrgMember
+	err := e.db.Select("role").First(&member, "org_id = ? AND user_id = ?", orgID, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch member.Role {
+	case models.OrgRoleAdmin:
+		return []Role{RoleOrgAdmin}, nil
+	case models.OrgRoleInterviewer:
+		return []Role{RoleInterviewer}, nil
+	}
+	return nil, nil
+}
+
+func (e *Engine) CanRoom(userID uint, room *models.Room, perm Permission) (bool, error) {
+	roles, err := e.RoomRoles(userID, room)
+	if err != nil {
+		return false, err
+	}
+	return e.Allows(roles, perm), nil
+}
+
+func (e *Engine) CanOrg(userID, orgID uint, perm Permission) (bool, error) {
+	roles, err := e.OrgRoles(userID, orgID)
+	if err != nil {
+		return false, err
+	}
+	return e.Allows(roles, perm), nil
+}
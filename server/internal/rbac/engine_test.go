@@ -0,0 +1,121 @@
+package rbac
+
+import (
+	"geekCode/internal/models"
+	"slices"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Client{}, &models.OrgMember{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewEngine(db, DefaultPolicy())
+}
+
+func TestRoomRoles(t *testing.T) {
+	const (
+		owner = iota + 1
+		orgAdmin
+		orgInterviewer
+		participant
+		invited
+		stranger
+	)
+	e := testEngine(t)
+	orgID := uint(7)
+	candidateID := uint(invited)
+	e.db.Create(&[]models.OrgMember{
+		{OrgID: orgID, UserID: orgAdmin, Role: models.OrgRoleAdmin},
+		{OrgID: orgID, UserID: orgInterviewer, Role: models.OrgRoleInterviewer},
+		// interviewer in another org has no say over this room
+		{OrgID: orgID + 1, UserID: stranger, Role: models.OrgRoleAdmin},
+	})
+	e.db.Create(&models.Client{RoomID: "room-1", UserID: participant})
+	e.db.Create(&models.Client{RoomID: "room-2", UserID: stranger})
+
+	room := &models.Room{RoomID: "room-1", CreatedBy: owner, OrgID: &orgID, CandidateID: &candidateID}
+	personal := &models.Room{RoomID: "room-1", CreatedBy: owner}
+
+	tests := []struct {
+		name string
+		room *models.Room
+		user uint
+		want []Role
+	}{
+		{"owner", room, owner, []Role{RoleOwner}},
+		{"org admin", room, orgAdmin, []Role{RoleOrgAdmin}},
+		{"org interviewer", room, orgInterviewer, []Role{RoleInterviewer}},
+		{"participant", room, participant, []Role{RoleCandidate}},
+		{"invited candidate before joining", room, invited, []Role{RoleCandidate}},
+		{"stranger", room, stranger, nil},
+		{"org admin on a personal room", personal, orgAdmin, nil},
+		{"participant of a personal room", personal, participant, []Role{RoleCandidate}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.RoomRoles(tt.user, tt.room)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("RoomRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanRoomAndOrg(t *testing.T) {
+	e := testEngine(t)
+	orgID := uint(3)
+	e.db.Create(&[]models.OrgMember{
+		{OrgID: orgID, UserID: 1, Role: models.OrgRoleAdmin},
+		{OrgID: orgID, UserID: 2, Role: models.OrgRoleInterviewer},
+	})
+	e.db.Create(&models.Client{RoomID: "room", UserID: 3})
+	room := &models.Room{RoomID: "room", CreatedBy: 9, OrgID: &orgID}
+
+	tests := []struct {
+		name string
+		user uint
+		perm Permission
+		want bool
+	}{
+		{"admin deletes", 1, RoomDelete, true},
+		{"interviewer can't delete", 2, RoomDelete, false},
+		{"interviewer views integrity", 2, IntegrityView, true},
+		{"candidate edits", 3, RoomEdit, true},
+		{"candidate can't see scores", 3, ScoreView, false},
+		{"stranger can't view", 4, RoomView, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.CanRoom(tt.user, room, tt.perm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanRoom(%d, %s) = %v, want %v", tt.user, tt.perm, got, tt.want)
+			}
+		})
+	}
+
+	if ok, _ := e.CanOrg(1, orgID, OrgAdmin); !ok {
+		t.Error("org admin can't administer the org")
+	}
+	if ok, _ := e.CanOrg(2, orgID, OrgAdmin); ok {
+		t.Error("interviewer can administer the org")
+	}
+	if ok, _ := e.CanOrg(3, orgID, OrgView); ok {
+		t.Error("non member can view the org")
+	}
+}
@@ -0,0 +1,135 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type Permission string
+
+const (
+	RoomView      Permission = "room.view"
+	RoomCreate    Permission = "room.create"
+	RoomJoin      Permission = "room.join"
+	RoomEdit      Permission = "room.edit" // typing in the shared editor, changing the language
+	RoomRun       Permission = "room.run"
+	RoomEnd       Permission = "room.end"    // also covers reopening
+	RoomUpdate    Permission = "room.update" // rename, archive and unarchive
+	RoomDelete    Permission = "room.delete"
+	ProblemEdit   Permission = "problem.edit"
+	TemplateEdit  Permission = "template.edit"
+	RubricEdit    Permission = "rubric.edit"
+	ScoreSubmit   Permission = "scorecard.submit" // write your own scorecard for a room
+	ScoreView     Permission = "scorecard.view"   // read everybody's scorecards and the aggregate
+	AssistantUse  Permission = "assistant.use"
+	IntegrityView Permission = "integrity.view" // proctoring signals, whoever holds it isn't proctored
+	OrgView       Permission = "org.view"
+	OrgAdmin      Permission = "org.admin"
+)
+
+type Role string
+
+const (
+	RoleOwner       Role = "owner"       // created the room
+	RoleOrgAdmin    Role = "org_admin"   // admin of the org the room (or org route) belongs to
+	RoleInterviewer Role = "interviewer" // interviewer in that org
+	RoleCandidate   Role = "candidate"   // joined the room through its link
+)
+
+// wildcard granting every permission
+const allPermissions Permission = "*"
+
+var knownPermissions = map[Permission]bool{
+	RoomView: true, RoomCreate: true, RoomJoin: true, RoomEdit: true, RoomRun: true, RoomEnd: true,
+	RoomUpdate: true, RoomDelete: true,
+	ProblemEdit: true, TemplateEdit: true, RubricEdit: true, ScoreSubmit: true, ScoreView: true,
+	AssistantUse: true, IntegrityView: true, OrgView: true, OrgAdmin: true,
+}
+
+func (p Permission) Valid() bool {
+	return knownPermissions[p]
+}
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleOwner, RoleOrgAdmin, RoleInterviewer, RoleCandidate:
+		return true
+	}
+	return false
+}
+
+// Policy maps roles to the permissions they grant
+type Policy struct {
+	roles map[Role]map[Permission]bool
+}
+
+func NewPolicy(grants map[Role][]Permission) *Policy {
+	p := &Policy{roles: make(map[Role]map[Permission]bool)}
+	for role, perms := range grants {
+		set := make(map[Permission]bool, len(perms))
+		for _, perm := range perms {
+			set[perm] = true
+		}
+		p.roles[role] = set
+	}
+	return p
+}
+
+// the built in policy, RBAC_POLICY_FILE can replace it
+func DefaultPolicy() *Policy {
+	return NewPolicy(map[Role][]Permission{
+		RoleOwner:       {RoomView, RoomJoin, RoomEdit, RoomRun, RoomEnd, RoomUpdate, RoomDelete, ProblemEdit, TemplateEdit, RubricEdit, ScoreSubmit, ScoreView, AssistantUse, IntegrityView},
+		RoleOrgAdmin:    {allPermissions},
+		RoleInterviewer: {RoomView, RoomCreate, RoomJoin, RoomEdit, RoomRun, RoomEnd, RoomUpdate, ProblemEdit, TemplateEdit, RubricEdit, ScoreSubmit, ScoreView, AssistantUse, IntegrityView, OrgView},
+		RoleCandidate:   {RoomView, RoomJoin, RoomEdit, RoomRun, AssistantUse},
+	})
+}
+
+// LoadPolicy reads a json file like {"owner": ["room.view", "room.end"], "org_admin": ["*"]}
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var grants map[Role][]Permission
+	if err := json.Unmarshal(data, &grants); err != nil {
+		return nil, fmt.Errorf("invalid rbac policy %s: %w", path, err)
+	}
+	// a typo would silently take a permission away, or grant nothing at all
+	for role, perms := range grants {
+		if !role.Valid() {
+			return nil, fmt.Errorf("invalid rbac policy %s: unknown role %q", path, role)
+		}
+		for _, perm := range perms {
+			if perm != allPermissions && !perm.Valid() {
+				return nil, fmt.Errorf("invalid rbac policy %s: unknown permission %q for %s", path, perm, role)
+			}
+		}
+	}
+	return NewPolicy(grants), nil
+}
+
+// Allows is true when any of the roles grants the permission
+func (p *Policy) Allows(roles []Role, perm Permission) bool {
+	for _, role := range roles {
+		granted := p.roles[role]
+		if granted[perm] || granted[allPermissions] {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeAllows checks the scopes of an api token, nil means the request isn't scope limited (a login jwt)
+func ScopeAllows(scopes []string, perm Permission) bool {
+	if scopes == nil {
+		return true
+	}
+	for _, scope := range scopes {
+		if Permission(scope) == perm {
+			return true
+		}
+	}
+	return false
+}
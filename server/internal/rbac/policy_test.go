@@ -0,0 +1,131 @@
+package rbac
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func allKnown() []Permission {
+	perms := make([]Permission, 0, len(knownPermissions))
+	for perm := range knownPermissions {
+		perms = append(perms, perm)
+	}
+	return perms
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	granted := map[Role][]Permission{
+		RoleOwner:       {RoomView, RoomJoin, RoomEdit, RoomRun, RoomEnd, RoomUpdate, RoomDelete, ProblemEdit, TemplateEdit, RubricEdit, ScoreSubmit, ScoreView, AssistantUse, IntegrityView},
+		RoleOrgAdmin:    allKnown(),
+		RoleInterviewer: {RoomView, RoomCreate, RoomJoin, RoomEdit, RoomRun, RoomEnd, RoomUpdate, ProblemEdit, TemplateEdit, RubricEdit, ScoreSubmit, ScoreView, AssistantUse, IntegrityView, OrgView},
+		RoleCandidate:   {RoomView, RoomJoin, RoomEdit, RoomRun, AssistantUse},
+	}
+	policy := DefaultPolicy()
+	for role, perms := range granted {
+		set := make(map[Permission]bool)
+		for _, perm := range perms {
+			set[perm] = true
+		}
+		for _, perm := range allKnown() {
+			t.Run(string(role)+"/"+string(perm), func(t *testing.T) {
+				if got := policy.Allows([]Role{role}, perm); got != set[perm] {
+					t.Errorf("Allows(%s, %s) = %v, want %v", role, perm, got, set[perm])
+				}
+			})
+		}
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	policy := NewPolicy(map[Role][]Permission{
+		RoleOrgAdmin:  {allPermissions},
+		RoleCandidate: {RoomView},
+		RoleOwner:     {RoomEnd},
+	})
+	tests := []struct {
+		name  string
+		roles []Role
+		perm  Permission
+		want  bool
+	}{
+		{"wildcard grants known permissions", []Role{RoleOrgAdmin}, OrgAdmin, true},
+		{"wildcard grants permissions added later", []Role{RoleOrgAdmin}, Permission("report.export"), true},
+		{"granted", []Role{RoleCandidate}, RoomView, true},
+		{"not granted", []Role{RoleCandidate}, RoomEnd, false},
+		{"any of the roles", []Role{RoleCandidate, RoleOwner}, RoomEnd, true},
+		{"role without grants", []Role{RoleInterviewer}, RoomView, false},
+		{"no roles", nil, RoomView, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allows(tt.roles, tt.perm); got != tt.want {
+				t.Errorf("Allows(%v, %s) = %v, want %v", tt.roles, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"owner": ["room.view", "room.end"], "org_admin": ["*"], "candidate": []}`, false},
+		{"malformed json", `{"owner": ["room.view"`, true},
+		{"unknown role", `{"guest": ["room.view"]}`, true},
+		{"unknown permission", `{"owner": ["room.veiw"]}`, true},
+		{"wrong shape", `{"owner": "room.view"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			policy, err := LoadPolicy(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !policy.Allows([]Role{RoleOwner}, RoomEnd) || policy.Allows([]Role{RoleOwner}, RoomDelete) {
+				t.Error("owner grants don't match the file")
+			}
+			if !policy.Allows([]Role{RoleOrgAdmin}, RoomDelete) {
+				t.Error("org_admin wildcard not applied")
+			}
+			if policy.Allows([]Role{RoleCandidate}, RoomView) {
+				t.Error("candidate got a permission the file doesn't grant")
+			}
+		})
+	}
+
+	if _, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadPolicy() of a missing file succeeded")
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		perm   Permission
+		want   bool
+	}{
+		{"login jwt", nil, RoomDelete, true},
+		{"token without scopes", []string{}, RoomView, false},
+		{"scope granted", []string{"room.view", "room.run"}, RoomRun, true},
+		{"scope missing", []string{"room.view"}, RoomEdit, false},
+		{"no wildcard for tokens", []string{"*"}, RoomView, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScopeAllows(tt.scopes, tt.perm); got != tt.want {
+				t.Errorf("ScopeAllows(%v, %s) = %v, want %v", tt.scopes, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
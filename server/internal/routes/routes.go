@@ -1,9 +1,17 @@
 package routes
 
 import (
+	"geekCode/internal/assistant"
 	"geekCode/internal/config"
+	"geekCode/internal/executor"
+	"geekCode/internal/formatter"
+	"geekCode/internal/lsp"
 	"geekCode/internal/handlers"
+	"geekCode/internal/languages"
 	"geekCode/internal/middleware"
+	"geekCode/internal/rbac"
+	"geekCode/internal/services"
+	"log"
 
 	"geekCode/internal/ws"
 
@@ -11,38 +19,155 @@ import (
 	"gorm.io/gorm"
 )
 
-func RegisterRoutes(r *gin.Engine, db *gorm.DB, jwtSecret string) {
+func RegisterRoutes(r *gin.Engine, db *gorm.DB) services.RoomCloser {
 	cfg := config.LoadConfig()
 	api := r.Group("/api")
 
+	//who may do what, the defaults can be overridden with a json policy file
+	policy := rbac.DefaultPolicy()
+	if cfg.RBACPolicyFile != "" {
+		var err error
+		policy, err = rbac.LoadPolicy(cfg.RBACPolicyFile)
+		if err != nil {
+			log.Fatalf("Failed to load rbac policy: %v", err)
+		}
+	}
+	engine := rbac.NewEngine(db, policy)
+
 	//inits handlers w db
-	h := handlers.NewHandler(db, cfg)
+	assistantService := assistant.NewService(assistant.New(cfg), assistant.NewMeter(db, assistant.LimitsFromConfig(cfg)))
+	formatters := formatter.New(cfg)
+	runtimes, err := languages.Load(cfg.LanguagesFile)
+	if err != nil {
+		log.Fatalf("Failed to load languages: %v", err)
+	}
+	var runs *executor.Queue
+	if cfg.ExecEnabled {
+		runs = executor.NewQueue(executor.New(cfg), cfg)
+	}
+	hub := ws.NewHub(db, engine, services.NewJoinWindow(cfg), assistantService, formatters, runtimes, runs)
+	h := handlers.NewHandler(db, cfg, engine, hub, assistantService, formatters, runtimes)
+	languageServers := lsp.NewManager(cfg, hub)
+	hub.Observe(languageServers)
+
+	//public signing keys so other services can verify our tokens
+	r.GET("/.well-known/jwks.json", handlers.JWKS)
 
 	//for heallth check
 	api.GET("/ping", handlers.Ping)
-	api.GET("/ws/:roomId", ws.HandleWebSocket) //websocket route
+	api.GET("/languages", h.ListLanguages)    // Runtimes the editor can use, with templates and limits
+	api.GET("/ws/:roomId", middleware.WebSocketAuth(db), hub.HandleWebSocket) //websocket route
+	api.GET("/lsp/:roomId/:language", middleware.AllowAPITokens(), middleware.WebSocketAuth(db), middleware.RequireRoomPermission(engine, rbac.RoomEdit), languageServers.HandleWebSocket) // language server bridge, json-rpc per text frame
 
 	//for auth
 	auth := api.Group("/auth")
 
 	auth.POST("/login", h.Login)
+	auth.POST("/login/2fa", h.LoginTwoFactor)
 	auth.POST("/register", h.Register)
+	auth.POST("/refresh", h.Refresh)
+	auth.POST("/logout", middleware.AuthMiddleware(db), middleware.SessionOnly(), h.Logout)
+
+	//email verification and password reset
+	auth.POST("/verify-email", h.VerifyEmail)
+	auth.POST("/verify-email/resend", middleware.AuthMiddleware(db), middleware.SessionOnly(), h.ResendVerificationEmail)
+	auth.POST("/password-reset", h.RequestPasswordReset)
+	auth.POST("/password-reset/confirm", h.ConfirmPasswordReset)
+
+	//oidc login (sign in with an external identity provider)
+	auth.GET("/oidc/providers", h.ListOIDCProviders)
+	auth.GET("/oidc/:provider/login", h.OIDCLogin)
+	auth.GET("/oidc/:provider/callback", h.OIDCCallback)
 
 	//protectedRoutes
 	protected := api.Group("/")
 	//profile route
 	
-	protected.Use(middleware.AuthMiddleware(jwtSecret))
+	protected.Use(middleware.AuthMiddleware(db))
+	//the routes personal api tokens may use, each one checks a token scope
+	scoped := api.Group("/")
+	scoped.Use(middleware.AllowAPITokens(), middleware.AuthMiddleware(db))
 	protected.GET("/profile", h.GetProfile)
 
+	//two factor auth (totp)
+	sessionOnly := middleware.SessionOnly()
+	protected.GET("/2fa", sessionOnly, h.TwoFactorStatus)
+	protected.POST("/2fa/enroll", sessionOnly, h.EnrollTwoFactor)
+	protected.POST("/2fa/activate", sessionOnly, h.ActivateTwoFactor)
+	protected.POST("/2fa/disable", sessionOnly, h.DisableTwoFactor)
+	protected.POST("/2fa/recovery-codes", sessionOnly, h.RegenerateRecoveryCodes)
+
+	//how much of the assistant quota is used
+	scoped.GET("/assistant/usage", middleware.RequireScope(rbac.AssistantUse), h.AssistantUsage)
+
+	//personal api tokens (for scripts and ci)
+	protected.GET("/tokens", sessionOnly, h.ListAPITokens)
+	protected.POST("/tokens", sessionOnly, h.CreateAPIToken)
+	protected.DELETE("/tokens/:tokenId", sessionOnly, h.RevokeAPIToken)
+
+	//single use ticket the browser opens /ws and /lsp with, instead of putting its token in the url
+	protected.POST("/ws-ticket", sessionOnly, h.CreateWebSocketTicket)
+
 	//room routes
-	protected.POST("/rooms", h.CreateRoom)        // Create room
-	protected.GET("/rooms", h.ListRooms)          // List user's rooms
-	protected.GET("/rooms/:roomId", h.GetRoom)    // Get specific room
-	protected.GET("/rooms/active", h.GetActiveRooms)  // Get active rooms
-	protected.GET("/rooms/ended", h.GetEndedRooms)    // Get ended rooms
-	protected.PUT("/rooms/:roomId/end", h.EndRoom)    // End a room
+	scoped.POST("/rooms", middleware.RequireScope(rbac.RoomCreate), h.CreateRoom)        // Create room
+	scoped.GET("/rooms", middleware.RequireScope(rbac.RoomView), h.ListRooms)          // List rooms (paged, filterable by status, date, participant, tag, language)
+	scoped.GET("/rooms/:roomId", middleware.RequireRoomPermission(engine, rbac.RoomView), h.GetRoom)    // Get specific room
+	scoped.PUT("/rooms/:roomId/end", middleware.RequireRoomPermission(engine, rbac.RoomEnd), h.EndRoom)    // End a room
+	scoped.PUT("/rooms/:roomId/reopen", middleware.RequireRoomPermission(engine, rbac.RoomEnd), h.ReopenRoom)    // Reopen an ended room
+	scoped.PATCH("/rooms/:roomId", middleware.RequireRoomPermission(engine, rbac.RoomUpdate), h.UpdateRoom)    // Rename, retag or change the language
+	scoped.POST("/rooms/:roomId/format", middleware.RequireRoomPermission(engine, rbac.RoomEdit), h.FormatRoomFile)    // Format a file of the live document for everybody
+	scoped.PUT("/rooms/:roomId/archive", middleware.RequireRoomPermission(engine, rbac.RoomUpdate), h.ArchiveRoom)
+	scoped.PUT("/rooms/:roomId/unarchive", middleware.RequireRoomPermission(engine, rbac.RoomUpdate), h.UnarchiveRoom)
+	scoped.DELETE("/rooms/:roomId", middleware.RequireRoomPermission(engine, rbac.RoomDelete), h.DeleteRoom)    // Soft delete, purged after the retention period
+	scoped.GET("/rooms/:roomId/calendar.ics", middleware.RequireRoomPermission(engine, rbac.RoomView), h.RoomCalendar)    // iCalendar invite for a scheduled room
+	scoped.POST("/rooms/:roomId/invites", middleware.RequireRoomPermission(engine, rbac.RoomUpdate), h.SendRoomInvites)    // Mail the invite to the attendees
+
+	scoped.POST("/rooms/:roomId/assistant", middleware.RequireRoomPermission(engine, rbac.AssistantUse), h.AskAssistant)    // Ask the ai assistant about the room's code (server sent events)
+	scoped.GET("/rooms/:roomId/scorecard", middleware.RequireRoomPermission(engine, rbac.ScoreSubmit), h.GetMyScorecard)    // Own scorecard and the rubric
+	scoped.PUT("/rooms/:roomId/scorecard", middleware.RequireRoomPermission(engine, rbac.ScoreSubmit), h.SaveScorecard)    // Save a draft or submit
+	scoped.GET("/rooms/:roomId/scorecards", middleware.RequireRoomPermission(engine, rbac.ScoreView), h.ListRoomScorecards)    // Submitted scorecards with the aggregate
+	scoped.GET("/rooms/:roomId/summary", middleware.RequireRoomPermission(engine, rbac.ScoreView), h.GetRoomSummary)    // Ai summary of the solution and what the room ended with
+	scoped.POST("/rooms/:roomId/summary", middleware.RequireRoomPermission(engine, rbac.ScoreView), h.GenerateRoomSummary)    // Write the summary (again)
+	scoped.GET("/rooms/:roomId/similarity", middleware.RequireRoomPermission(engine, rbac.ScoreView), h.RoomSimilarity)    // Closest past submissions for the same problems
+	scoped.GET("/rooms/:roomId/integrity", middleware.RequireRoomPermission(engine, rbac.IntegrityView), h.ListIntegrityEvents)    // Proctoring timeline, interviewers only
+	scoped.GET("/candidates/:userId/scorecards", middleware.RequireScope(rbac.ScoreView), h.CandidateScorecards)    // A candidate's scorecards across rooms
+
+	scoped.POST("/rooms/:roomId/template", middleware.RequireRoomPermission(engine, rbac.RoomUpdate), middleware.RequireScope(rbac.TemplateEdit), h.SaveRoomAsTemplate)    // Save the room setup as a template
 
+	//problems, room templates and rubrics, personal or shared with an org (?orgId=)
+	problemScope := middleware.RequireScope(rbac.ProblemEdit)
+	scoped.POST("/problems", problemScope, h.CreateProblem)
+	scoped.GET("/problems", problemScope, h.ListProblems)
+	scoped.GET("/problems/:problemId", problemScope, h.GetProblem)
+	scoped.PATCH("/problems/:problemId", problemScope, h.UpdateProblem)
+	scoped.DELETE("/problems/:problemId", problemScope, h.DeleteProblem)
+	templateScope := middleware.RequireScope(rbac.TemplateEdit)
+	scoped.POST("/templates", templateScope, h.CreateTemplate)
+	scoped.GET("/templates", templateScope, h.ListTemplates)
+	scoped.GET("/templates/:templateId", templateScope, h.GetTemplate)
+	scoped.PATCH("/templates/:templateId", templateScope, h.UpdateTemplate)
+	scoped.DELETE("/templates/:templateId", templateScope, h.DeleteTemplate)
+	rubricScope := middleware.RequireScope(rbac.RubricEdit)
+	scoped.POST("/rubrics", rubricScope, h.CreateRubric)
+	scoped.GET("/rubrics", rubricScope, h.ListRubrics)
+	scoped.GET("/rubrics/:rubricId", rubricScope, h.GetRubric)
+	scoped.PATCH("/rubrics/:rubricId", rubricScope, h.UpdateRubric)
+	scoped.DELETE("/rubrics/:rubricId", rubricScope, h.DeleteRubric)
 
+	//organizations and teams
+	protected.POST("/orgs", sessionOnly, h.CreateOrg)
+	scoped.GET("/orgs", middleware.RequireScope(rbac.OrgView), h.ListOrgs)
+	orgView := middleware.RequireOrgPermission(engine, rbac.OrgView)
+	orgAdmin := middleware.RequireOrgPermission(engine, rbac.OrgAdmin)
+	scoped.GET("/orgs/:orgId", orgView, h.GetOrg)
+	scoped.POST("/orgs/:orgId/members", orgAdmin, h.AddOrgMember)
+	scoped.PATCH("/orgs/:orgId/members/:userId", orgAdmin, h.UpdateOrgMember)
+	scoped.DELETE("/orgs/:orgId/members/:userId", orgView, h.RemoveOrgMember) // members may leave, removing others is checked in the handler
+	scoped.POST("/orgs/:orgId/teams", orgAdmin, h.CreateTeam)
+	scoped.GET("/orgs/:orgId/teams", orgView, h.ListTeams)
+	scoped.GET("/orgs/:orgId/assistant/usage", orgAdmin, h.OrgAssistantUsage)
+	scoped.POST("/orgs/:orgId/teams/:teamId/members", orgAdmin, h.AddTeamMember)
+	scoped.DELETE("/orgs/:orgId/teams/:teamId/members/:userId", orgAdmin, h.RemoveTeamMember)
 
-}
\ No newline at end of file
+	return h
+}
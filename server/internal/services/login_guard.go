@@ -0,0 +1,58 @@
+package services
+
+import (
+	"strings"
+	"time"
+)
+
+// LoginGuard throttles login attempts per client ip and per account, the ip limits are
+// looser since many users can share one address (offices, campuses)
+type LoginGuard struct {
+	byIP      *Throttle
+	byAccount *Throttle
+}
+
+func NewLoginGuard(maxAttempts int, lockout time.Duration) *LoginGuard {
+	return &LoginGuard{
+		byAccount: NewThrottle(ThrottleConfig{
+			FreeAttempts:     3,
+			BaseDelay:        time.Second,
+			MaxDelay:         lockout,
+			LockoutThreshold: maxAttempts,
+			LockoutDuration:  lockout,
+			Window:           time.Hour,
+		}),
+		byIP: NewThrottle(ThrottleConfig{
+			FreeAttempts:     maxAttempts,
+			BaseDelay:        time.Second,
+			MaxDelay:         lockout,
+			LockoutThreshold: maxAttempts * 5,
+			LockoutDuration:  lockout,
+			Window:           time.Hour,
+		}),
+	}
+}
+
+func accountKey(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+// RetryAfter returns how long the caller has to wait before trying again, zero if allowed
+func (g *LoginGuard) RetryAfter(ip, account string) time.Duration {
+	wait := g.byIP.Blocked(ip)
+	if accountWait := g.byAccount.Blocked(accountKey(account)); accountWait > wait {
+		wait = accountWait
+	}
+	return wait
+}
+
+func (g *LoginGuard) Failure(ip, account string) {
+	g.byIP.Failure(ip)
+	g.byAccount.Failure(accountKey(account))
+}
+
+// only the account is reset, otherwise an attacker could clear the ip counter by
+// logging into their own account between guesses
+func (g *LoginGuard) Success(account string) {
+	g.byAccount.Reset(accountKey(account))
+}
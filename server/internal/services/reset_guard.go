@@ -0,0 +1,42 @@
+package services
+
+import "time"
+
+// PasswordResetGuard limits reset requests per client ip and per email address. Every request
+// counts, not only the failed ones, since each of them can send a mail
+type PasswordResetGuard struct {
+	byIP    *Throttle
+	byEmail *Throttle
+}
+
+func NewPasswordResetGuard() *PasswordResetGuard {
+	return &PasswordResetGuard{
+		byEmail: NewThrottle(ThrottleConfig{
+			FreeAttempts: 3,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			Window:       time.Hour,
+		}),
+		byIP: NewThrottle(ThrottleConfig{
+			FreeAttempts: 10,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			Window:       time.Hour,
+		}),
+	}
+}
+
+// Attempt records a request and returns how long the caller has to wait, zero if it may go ahead.
+// the email is counted whether it has an account or not, so the limit doesn't tell them apart
+func (g *PasswordResetGuard) Attempt(ip, email string) time.Duration {
+	wait := g.byIP.Blocked(ip)
+	if emailWait := g.byEmail.Blocked(accountKey(email)); emailWait > wait {
+		wait = emailWait
+	}
+	if wait > 0 {
+		return wait
+	}
+	g.byIP.Failure(ip)
+	g.byEmail.Failure(accountKey(email))
+	return 0
+}
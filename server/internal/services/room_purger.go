@@ -0,0 +1,91 @@
+package services
+
+import (
+	"geekCode/internal/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RoomPurger removes soft deleted rooms for good once they are older than the retention period
+type RoomPurger struct {
+	db        *gorm.DB
+	retention time.Duration
+	stop      chan struct{}
+}
+
+func NewRoomPurger(db *gorm.DB, retention time.Duration) *RoomPurger {
+	return &RoomPurger{db: db, retention: retention}
+}
+
+// Purge hard deletes the expired rooms together with their participants, tags, scorecards, summaries and problem links
+func (p *RoomPurger) Purge() (int64, error) {
+	cutoff := time.Now().Add(-p.retention)
+	var purged int64
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		// a fresh subquery per statement, gorm chains shouldn't be reused
+		expired := func() *gorm.DB {
+			return tx.Unscoped().Model(&models.Room{}).Select("room_id").Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+		}
+		if err := tx.Where("room_id IN (?)", expired()).Delete(&models.Client{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("room_id IN (?)", expired()).Delete(&models.RoomTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("room_id IN (?)", expired()).Delete(&models.Scorecard{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("room_id IN (?)", expired()).Delete(&models.Submission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("room_id IN (?)", expired()).Delete(&models.RoomSummary{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("room_id IN (?)", expired()).Delete(&models.IntegrityEvent{}).Error; err != nil {
+			return err
+		}
+		// the join table points at rooms.id rather than the public room id
+		if err := tx.Exec("DELETE FROM room_problems WHERE room_id IN (?)",
+			tx.Unscoped().Model(&models.Room{}).Select("id").Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff)).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(&models.Room{})
+		purged = res.RowsAffected
+		return res.Error
+	})
+	return purged, err
+}
+
+// Start purges on a fixed interval until Stop is called
+func (p *RoomPurger) Start(interval time.Duration) {
+	if interval <= 0 || p.retention <= 0 {
+		return
+	}
+	p.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				purged, err := p.Purge()
+				if err != nil {
+					log.Printf("Failed to purge deleted rooms: %v", err)
+				} else if purged > 0 {
+					log.Printf("Purged %d deleted rooms", purged)
+				}
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (p *RoomPurger) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
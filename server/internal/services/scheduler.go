@@ -0,0 +1,114 @@
+package services
+
+import (
+	"geekCode/internal/config"
+	"geekCode/internal/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JoinWindow is the time around a scheduled start during which people can join the room
+type JoinWindow struct {
+	Early time.Duration // how long before the start the room opens
+	Grace time.Duration // how long after the planned end it stays open
+}
+
+func NewJoinWindow(cfg *config.Config) JoinWindow {
+	return JoinWindow{Early: cfg.ScheduleJoinEarly, Grace: cfg.ScheduleEndGrace}
+}
+
+// Opens returns when a room scheduled for start becomes joinable
+func (w JoinWindow) Opens(start time.Time) time.Time {
+	return start.Add(-w.Early)
+}
+
+// AutoEnd returns when the scheduler ends the room, nil when it has no duration (open ended)
+func (w JoinWindow) AutoEnd(start time.Time, durationMinutes int) *time.Time {
+	if durationMinutes <= 0 {
+		return nil
+	}
+	end := start.Add(time.Duration(durationMinutes)*time.Minute + w.Grace)
+	return &end
+}
+
+// RoomCloser finishes a room that just ended: it keeps what the room ended with (files, runs,
+// timeline) and then disconnects everybody, the same way ending it by hand does
+type RoomCloser interface {
+	RoomEnded(room *models.Room, reason string)
+}
+
+// RoomScheduler opens scheduled rooms when their join window starts and ends them when it is over
+type RoomScheduler struct {
+	db     *gorm.DB
+	window JoinWindow
+	closer RoomCloser
+	stop   chan struct{}
+}
+
+func NewRoomScheduler(db *gorm.DB, window JoinWindow, closer RoomCloser) *RoomScheduler {
+	return &RoomScheduler{db: db, window: window, closer: closer}
+}
+
+// Tick applies every transition that is due at now
+func (s *RoomScheduler) Tick(now time.Time) error {
+	opened := s.db.Model(&models.Room{}).
+		Where("status = ? AND scheduled_start <= ?", models.Scheduled, now.Add(s.window.Early)).
+		Update("status", models.Active)
+	if opened.Error != nil {
+		return opened.Error
+	}
+	if opened.RowsAffected > 0 {
+		log.Printf("Opened %d scheduled rooms", opened.RowsAffected)
+	}
+
+	var due []models.Room
+	if err := s.db.Where("status = ? AND auto_end_at <= ?", models.Active, now).Find(&due).Error; err != nil {
+		return err
+	}
+	for i := range due {
+		room := &due[i]
+		// conditional, somebody may have ended or reopened it in the meantime
+		res := s.db.Model(&models.Room{}).
+			Where("id = ? AND status = ? AND auto_end_at <= ?", room.ID, models.Active, now).
+			Updates(map[string]interface{}{"status": models.Ended, "ended_at": now, "auto_end_at": nil})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			room.Status, room.EndedAt, room.AutoEndAt = models.Ended, &now, nil
+			s.closer.RoomEnded(room, "scheduled time is over")
+		}
+	}
+	return nil
+}
+
+// Start ticks on a fixed interval until Stop is called
+func (s *RoomScheduler) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if err := s.Tick(now); err != nil {
+					log.Printf("Room scheduler failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *RoomScheduler) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
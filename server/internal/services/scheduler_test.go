@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"geekCode/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type endedRooms []models.Room
+
+func (e *endedRooms) RoomEnded(room *models.Room, reason string) {
+	*e = append(*e, *room)
+}
+
+func TestSchedulerTick(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Room{}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	rooms := []models.Room{
+		{Name: "due", RoomID: "due", Status: models.Active, AutoEndAt: &past, Language: "go", Files: []models.CodeFile{{Name: "main.go", Content: "package main"}}},
+		{Name: "running", RoomID: "running", Status: models.Active, AutoEndAt: &future},
+		{Name: "open ended", RoomID: "open-ended", Status: models.Active},
+		{Name: "starting", RoomID: "starting", Status: models.Scheduled, ScheduledStart: &future},
+		{Name: "opening", RoomID: "opening", Status: models.Scheduled, ScheduledStart: &past},
+	}
+	if err := db.Create(&rooms).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var ended endedRooms
+	scheduler := NewRoomScheduler(db, JoinWindow{Early: 5 * time.Minute}, &ended)
+	if err := scheduler.Tick(now); err != nil {
+		t.Fatal(err)
+	}
+
+	// the closer gets the whole room, capturing the submission needs its files and language
+	if len(ended) != 1 || ended[0].RoomID != "due" || ended[0].Language != "go" || len(ended[0].Files) != 1 || ended[0].Status != models.Ended {
+		t.Fatalf("ended rooms = %+v, want only the due one, fully loaded", ended)
+	}
+	want := map[string]models.Status{
+		"due":        models.Ended,
+		"running":    models.Active,
+		"open-ended": models.Active,
+		"starting":   models.Scheduled,
+		"opening":    models.Active,
+	}
+	for roomID, status := range want {
+		var room models.Room
+		db.First(&room, "room_id = ?", roomID)
+		if room.Status != status {
+			t.Errorf("room %s has status %v, want %v", roomID, room.Status, status)
+		}
+	}
+
+	// a second tick has nothing left to end
+	if err := scheduler.Tick(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(ended) != 1 {
+		t.Errorf("room ended twice")
+	}
+}
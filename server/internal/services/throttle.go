@@ -0,0 +1,113 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+type ThrottleConfig struct {
+	FreeAttempts     int           // failures allowed before backoff kicks in
+	BaseDelay        time.Duration // first backoff delay, doubled on every further failure
+	MaxDelay         time.Duration
+	LockoutThreshold int // failures that lock the key for LockoutDuration
+	LockoutDuration  time.Duration
+	Window           time.Duration // failures are forgotten after this much quiet time
+}
+
+type attempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// Throttle tracks failed attempts per key (an ip, an account ...) with exponential backoff
+// and a hard lockout. It lives in memory, so every server instance counts on its own
+type Throttle struct {
+	cfg     ThrottleConfig
+	mu      sync.Mutex
+	entries map[string]*attempts
+	ops     int
+	now     func() time.Time // replaced in tests
+}
+
+func NewThrottle(cfg ThrottleConfig) *Throttle {
+	return &Throttle{cfg: cfg, entries: make(map[string]*attempts), now: time.Now}
+}
+
+// Blocked reports how long the key still has to wait, zero when it may try again
+func (t *Throttle) Blocked(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	entry := t.lookup(key, now)
+	if entry == nil {
+		return 0
+	}
+	if wait := entry.blockedUntil.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Failure records a failed attempt and returns how long the key is now blocked for
+func (t *Throttle) Failure(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	entry := t.lookup(key, now)
+	if entry == nil {
+		entry = &attempts{}
+		t.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	var delay time.Duration
+	switch {
+	case t.cfg.LockoutThreshold > 0 && entry.failures >= t.cfg.LockoutThreshold:
+		delay = t.cfg.LockoutDuration
+	case entry.failures > t.cfg.FreeAttempts:
+		shift := entry.failures - t.cfg.FreeAttempts - 1
+		delay = t.cfg.MaxDelay
+		if shift < 30 && t.cfg.BaseDelay<<shift < t.cfg.MaxDelay {
+			delay = t.cfg.BaseDelay << shift
+		}
+	}
+	if delay > 0 {
+		entry.blockedUntil = now.Add(delay)
+	}
+
+	t.ops++
+	if t.ops%1000 == 0 {
+		t.cleanup(now)
+	}
+	return delay
+}
+
+// Reset forgets the failures of a key (after a successful login)
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// returns the entry unless it went quiet for longer than the window
+func (t *Throttle) lookup(key string, now time.Time) *attempts {
+	entry, found := t.entries[key]
+	if !found {
+		return nil
+	}
+	if now.After(entry.blockedUntil) && now.Sub(entry.lastFailure) > t.cfg.Window {
+		delete(t.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (t *Throttle) cleanup(now time.Time) {
+	for key := range t.entries {
+		t.lookup(key, now)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is moved by hand so backoff and lockout can be checked without sleeping
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestThrottle(cfg ThrottleConfig) (*Throttle, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	t := NewThrottle(cfg)
+	t.now = clock.Now
+	return t, clock
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	th, clock := newTestThrottle(ThrottleConfig{
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         10 * time.Second,
+		LockoutThreshold: 8,
+		LockoutDuration:  time.Hour,
+		Window:           time.Hour,
+	})
+
+	// failures past the free ones double the delay until MaxDelay, then the lockout takes over
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, time.Hour}
+	for i, delay := range want {
+		if got := th.Failure("ada"); got != delay {
+			t.Fatalf("failure %d: delay %s, want %s", i+1, got, delay)
+		}
+		if got := th.Blocked("ada"); got != delay {
+			t.Fatalf("failure %d: blocked %s, want %s", i+1, got, delay)
+		}
+	}
+	if got := th.Blocked("bob"); got != 0 {
+		t.Errorf("another key is blocked for %s", got)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if got := th.Blocked("ada"); got != time.Minute {
+		t.Errorf("a minute before the lockout ends: %s", got)
+	}
+	clock.Advance(time.Minute)
+	if got := th.Blocked("ada"); got != 0 {
+		t.Errorf("after the lockout: %s", got)
+	}
+}
+
+func TestThrottleWindow(t *testing.T) {
+	th, clock := newTestThrottle(ThrottleConfig{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, Window: 10 * time.Minute})
+
+	th.Failure("ada")
+	if got := th.Failure("ada"); got != time.Second {
+		t.Fatalf("second failure: %s", got)
+	}
+	// quiet for longer than the window, the failures are forgotten
+	clock.Advance(11 * time.Minute)
+	if got := th.Failure("ada"); got != 0 {
+		t.Errorf("first failure after the window: %s", got)
+	}
+	// but not while it is still counting
+	clock.Advance(9 * time.Minute)
+	if got := th.Failure("ada"); got != time.Second {
+		t.Errorf("failure within the window: %s", got)
+	}
+}
+
+func TestThrottleReset(t *testing.T) {
+	th, _ := newTestThrottle(ThrottleConfig{FreeAttempts: 0, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour})
+	th.Failure("ada")
+	th.Failure("ada")
+	th.Reset("ada")
+	if got := th.Blocked("ada"); got != 0 {
+		t.Errorf("blocked after a reset: %s", got)
+	}
+	if got := th.Failure("ada"); got != time.Second {
+		t.Errorf("first failure after a reset: %s", got)
+	}
+}
+
+func TestLoginGuard(t *testing.T) {
+	guard := NewLoginGuard(5, 15*time.Minute)
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard.byIP.now = clock.Now
+	guard.byAccount.now = clock.Now
+
+	// three free failures per account, then backoff
+	for i := 0; i < 3; i++ {
+		guard.Failure("10.0.0.1", "Ada@Example.com ")
+	}
+	if got := guard.RetryAfter("10.0.0.1", "ada@example.com"); got != 0 {
+		t.Fatalf("after the free attempts: %s", got)
+	}
+	guard.Failure("10.0.0.1", "ada@example.com")
+	if got := guard.RetryAfter("10.0.0.9", "ADA@example.com"); got != time.Second {
+		t.Errorf("account backoff from another ip: %s", got)
+	}
+
+	// the fifth failure locks the account
+	guard.Failure("10.0.0.2", "ada@example.com")
+	if got := guard.RetryAfter("10.0.0.3", "ada@example.com"); got != 15*time.Minute {
+		t.Errorf("account lockout: %s", got)
+	}
+	if got := guard.RetryAfter("10.0.0.1", "bob@example.com"); got != 0 {
+		t.Errorf("another account from the same ip: %s", got)
+	}
+
+	// a successful login clears the account but not the ip
+	guard.Success("ada@example.com")
+	if got := guard.RetryAfter("10.0.0.3", "ada@example.com"); got != 0 {
+		t.Errorf("after a successful login: %s", got)
+	}
+	for i := 0; i < 2; i++ {
+		guard.Failure("10.0.0.1", "someone"+string(rune('a'+i))+"@example.com")
+	}
+	// 10.0.0.1 has 6 failures now, one past the ip's free attempts
+	if got := guard.RetryAfter("10.0.0.1", "carol@example.com"); got != time.Second {
+		t.Errorf("ip backoff: %s", got)
+	}
+	guard.Success("someonea@example.com")
+	if got := guard.RetryAfter("10.0.0.1", "carol@example.com"); got != time.Second {
+		t.Errorf("a success reset the ip: %s", got)
+	}
+	clock.Advance(time.Second)
+	if got := guard.RetryAfter("10.0.0.1", "carol@example.com"); got != 0 {
+		t.Errorf("after the ip backoff: %s", got)
+	}
+}
+
+func TestPasswordResetGuard(t *testing.T) {
+	guard := NewPasswordResetGuard()
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard.byIP.now = clock.Now
+	guard.byEmail.now = clock.Now
+
+	for i := 0; i < 4; i++ {
+		if wait := guard.Attempt("10.0.0.1", "ada@example.com"); wait != 0 {
+			t.Fatalf("request %d: wait %s", i+1, wait)
+		}
+	}
+	if wait := guard.Attempt("10.0.0.2", "ADA@example.com"); wait != time.Minute {
+		t.Errorf("over the email limit: %s", wait)
+	}
+	clock.Advance(time.Minute)
+	if wait := guard.Attempt("10.0.0.2", "ada@example.com"); wait != 0 {
+		t.Errorf("after waiting: %s", wait)
+	}
+	if wait := guard.Attempt("10.0.0.2", "ada@example.com"); wait != 2*time.Minute {
+		t.Errorf("the wait grows: %s", wait)
+	}
+}
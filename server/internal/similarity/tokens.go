@@ -0,0 +1,102 @@
+package similarity
+
+import (
+	"strings"
+	"unicode"
+)
+
+// keywords survive normalization, every other identifier becomes the same token so renaming variables
+// doesn't hide a copy. the set covers the languages the editor offers, a word that is a keyword in one
+// language and a name in another only makes the comparison slightly stricter
+var keywords = map[string]bool{
+	"if": true, "else": true, "elif": true, "for": true, "while": true, "do": true, "switch": true, "case": true,
+	"default": true, "break": true, "continue": true, "return": true, "yield": true, "goto": true,
+	"func": true, "function": true, "def": true, "fn": true, "lambda": true, "class": true, "struct": true,
+	"interface": true, "enum": true, "type": true, "var": true, "let": true, "const": true, "static": true,
+	"new": true, "delete": true, "try": true, "catch": true, "except": true, "finally": true, "throw": true,
+	"raise": true, "import": true, "from": true, "package": true, "in": true, "of": true, "is": true,
+	"not": true, "and": true, "or": true, "range": true, "map": true, "go": true, "defer": true, "select": true,
+	"chan": true, "with": true, "as": true, "pass": true, "public": true, "private": true, "protected": true,
+	"void": true, "int": true, "long": true, "float": true, "double": true, "char": true, "bool": true,
+	"boolean": true, "string": true, "true": true, "false": true, "null": true, "nil": true, "none": true,
+	"this": true, "self": true, "super": true, "match": true, "impl": true, "mut": true, "pub": true,
+}
+
+// languages where # starts a comment rather than a preprocessor line
+var hashComments = map[string]bool{
+	"python": true, "ruby": true, "shell": true, "bash": true, "r": true, "perl": true,
+}
+
+// Tokenize turns source code into a normalized token stream: comments and whitespace are dropped,
+// names become "id", number literals "num" and string literals "str"
+func Tokenize(code, language string) []string {
+	hashComment := hashComments[strings.ToLower(language)]
+	src := []rune(code)
+	tokens := make([]string, 0, len(src)/4)
+	for i := 0; i < len(src); {
+		r := src[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(src) && src[i+1] == '/', r == '#' && hashComment:
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/') {
+				i++
+			}
+			i += 2
+		case r == '"' || r == '\'' || r == '`':
+			i = skipString(src, i)
+			tokens = append(tokens, "str")
+		case unicode.IsDigit(r):
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '.' || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, "num")
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			start := i
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '_' || src[i] == '$') {
+				i++
+			}
+			word := strings.ToLower(string(src[start:i]))
+			if keywords[word] {
+				tokens = append(tokens, word)
+			} else {
+				tokens = append(tokens, "id")
+			}
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+// skipString returns the index after the literal starting at i, python's triple quotes included
+func skipString(src []rune, i int) int {
+	quote := src[i]
+	if i+2 < len(src) && src[i+1] == quote && src[i+2] == quote {
+		for j := i + 3; j+2 < len(src); j++ {
+			if src[j] == quote && src[j+1] == quote && src[j+2] == quote {
+				return j + 3
+			}
+		}
+		return len(src)
+	}
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		case '\n':
+			if quote != '`' {
+				return j
+			}
+		}
+	}
+	return len(src)
+}
@@ -0,0 +1,108 @@
+// Package similarity compares source code the way MOSS does: the normalized token stream is cut into
+// k-grams, the k-gram hashes are winnowed down to a fingerprint and fingerprints are compared as sets.
+// it survives renamed variables, reformatting, changed comments and reordered functions
+package similarity
+
+import (
+	"geekCode/internal/models"
+	"hash/fnv"
+)
+
+const (
+	// k-gram length in tokens, shorter matches are treated as noise
+	gramSize = 12
+	// winnowing window, any match of at least gramSize+windowSize-1 tokens is guaranteed to be found
+	windowSize = 8
+)
+
+// Fingerprint is the set of selected k-gram hashes of some code
+type Fingerprint map[uint64]struct{}
+
+// Of fingerprints a single piece of code
+func Of(code, language string) Fingerprint {
+	return winnow(Tokenize(code, language))
+}
+
+// Files fingerprints every file of a submission into one set, so moving code between files doesn't matter
+func Files(files []models.CodeFile) Fingerprint {
+	fp := Fingerprint{}
+	for _, file := range files {
+		for hash := range Of(file.Content, file.Language) {
+			fp[hash] = struct{}{}
+		}
+	}
+	return fp
+}
+
+// Without drops the hashes found in other, used to ignore the starter code everybody got
+func (f Fingerprint) Without(other Fingerprint) Fingerprint {
+	out := make(Fingerprint, len(f))
+	for hash := range f {
+		if _, found := other[hash]; !found {
+			out[hash] = struct{}{}
+		}
+	}
+	return out
+}
+
+// Score compares two fingerprints, all values are between 0 and 1
+type Score struct {
+	Shared      int     `json:"shared"`      // fingerprints in both
+	Jaccard     float64 `json:"jaccard"`     // shared over the union, how alike the two are overall
+	Containment float64 `json:"containment"` // share of a's fingerprints found in b, high when a was copied from b
+}
+
+func Compare(a, b Fingerprint) Score {
+	if len(a) == 0 || len(b) == 0 {
+		return Score{}
+	}
+	shared := 0
+	for hash := range a {
+		if _, found := b[hash]; found {
+			shared++
+		}
+	}
+	return Score{
+		Shared:      shared,
+		Jaccard:     float64(shared) / float64(len(a)+len(b)-shared),
+		Containment: float64(shared) / float64(len(a)),
+	}
+}
+
+// winnow keeps the smallest hash of every window of k-gram hashes (Schleimer et al., 2003)
+func winnow(tokens []string) Fingerprint {
+	fp := Fingerprint{}
+	if len(tokens) < gramSize {
+		return fp
+	}
+	hashes := make([]uint64, 0, len(tokens)-gramSize+1)
+	for i := 0; i+gramSize <= len(tokens); i++ {
+		h := fnv.New64a()
+		for _, token := range tokens[i : i+gramSize] {
+			h.Write([]byte(token))
+			h.Write([]byte{0})
+		}
+		hashes = append(hashes, h.Sum64())
+	}
+	if len(hashes) < windowSize {
+		// too short for a full window, the minimum still says something
+		min := hashes[0]
+		for _, hash := range hashes[1:] {
+			if hash < min {
+				min = hash
+			}
+		}
+		fp[min] = struct{}{}
+		return fp
+	}
+	for start := 0; start+windowSize <= len(hashes); start++ {
+		min := hashes[start]
+		for _, hash := range hashes[start+1 : start+windowSize] {
+			if hash <= min {
+				min = hash
+			}
+		}
+		fp[min] = struct{}{}
+	}
+	return fp
+}
@@ -0,0 +1,177 @@
+package similarity
+
+import (
+	"slices"
+	"testing"
+
+	"geekCode/internal/models"
+)
+
+const original = `package main
+
+// twoSum returns the indices of the two numbers adding up to target
+func twoSum(nums []int, target int) []int {
+	seen := map[int]int{}
+	for i, n := range nums {
+		if j, ok := seen[target-n]; ok {
+			return []int{j, i}
+		}
+		seen[n] = i
+	}
+	return nil
+}
+
+func maxProfit(prices []int) int {
+	best, low := 0, prices[0]
+	for _, p := range prices[1:] {
+		if p < low {
+			low = p
+		} else if p-low > best {
+			best = p - low
+		}
+	}
+	return best
+}
+`
+
+// the same code with other names, other comments and other formatting
+const disguised = `package main
+
+/* finds a pair, O(n) */
+func findPair(values []int, goal int) []int { lookup := map[int]int{}
+	for idx, v := range values { if other, found := lookup[goal-v]; found { return []int{other, idx} }
+		lookup[v] = idx }
+	return nil }
+
+func stocks(xs []int) int {
+	result, minimum := 0, xs[0]
+	for _, x := range xs[1:] {
+		if x < minimum { minimum = x } else if x-minimum > result { result = x - minimum }
+	}
+	return result // done
+}
+`
+
+// the two functions swapped
+const reordered = `package main
+
+func maxProfit(prices []int) int {
+	best, low := 0, prices[0]
+	for _, p := range prices[1:] {
+		if p < low {
+			low = p
+		} else if p-low > best {
+			best = p - low
+		}
+	}
+	return best
+}
+
+func twoSum(nums []int, target int) []int {
+	seen := map[int]int{}
+	for i, n := range nums {
+		if j, ok := seen[target-n]; ok {
+			return []int{j, i}
+		}
+		seen[n] = i
+	}
+	return nil
+}
+`
+
+const unrelated = `package main
+
+import "sort"
+
+func mergeIntervals(intervals [][2]int) [][2]int {
+	sort.Slice(intervals, func(a, b int) bool { return intervals[a][0] < intervals[b][0] })
+	var merged [][2]int
+	for _, iv := range intervals {
+		if len(merged) > 0 && iv[0] <= merged[len(merged)-1][1] {
+			merged[len(merged)-1][1] = max(merged[len(merged)-1][1], iv[1])
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+`
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name           string
+		other          string
+		minJaccard     float64
+		maxJaccard     float64
+		minContainment float64
+	}{
+		{"identical", original, 1, 1, 1},
+		{"renamed and reformatted", disguised, 1, 1, 1},
+		{"functions reordered", reordered, 0.7, 1, 0.8},
+		{"unrelated", unrelated, 0, 0.1, 0},
+	}
+	a := Of(original, "go")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := Compare(a, Of(tt.other, "go"))
+			if score.Jaccard < tt.minJaccard || score.Jaccard > tt.maxJaccard || score.Containment < tt.minContainment {
+				t.Errorf("got %+v, want jaccard in [%v, %v] and containment at least %v",
+					score, tt.minJaccard, tt.maxJaccard, tt.minContainment)
+			}
+		})
+	}
+}
+
+func TestCompareCopyInsideLargerSolution(t *testing.T) {
+	copied := Of(original, "go")
+	larger := Of(original+unrelated, "go")
+	score := Compare(copied, larger)
+	if score.Containment < 0.9 {
+		t.Errorf("containment %v, the whole copy is in the larger solution", score.Containment)
+	}
+	if score.Jaccard > 0.8 {
+		t.Errorf("jaccard %v, the larger solution has a lot of its own", score.Jaccard)
+	}
+}
+
+func TestFilesWithoutStarterCode(t *testing.T) {
+	starter := []models.CodeFile{{Name: "main.go", Language: "go", Content: original}}
+	// only the starter code, spread over two files
+	submission := []models.CodeFile{
+		{Name: "main.go", Language: "go", Content: reordered},
+		{Name: "extra.go", Language: "go", Content: "package main\n"},
+	}
+	if left := Files(submission).Without(Files(starter)); len(left) > len(Files(starter))/5 {
+		t.Errorf("%d fingerprints left after removing the starter code", len(left))
+	}
+	if score := Compare(Fingerprint{}, Files(starter)); score != (Score{}) {
+		t.Errorf("empty fingerprint scored %+v", score)
+	}
+	if fp := Of("x := 1", "go"); len(fp) != 0 {
+		t.Errorf("code shorter than a k-gram has %d fingerprints", len(fp))
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		language string
+		want     []string
+	}{
+		{"names and literals", `total := price * 2 + "tax"`, "go", []string{"id", ":", "=", "id", "*", "num", "+", "str"}},
+		{"keywords keep their name", "for i in range(10): pass", "python", []string{"for", "id", "in", "range", "(", "num", ")", ":", "pass"}},
+		{"line and block comments", "a /* b */ // c\nd", "go", []string{"id", "id"}},
+		{"hash comments in python", "x = 1 # note", "python", []string{"id", "=", "num"}},
+		{"hash is an operator elsewhere", "#include <x>", "cpp", []string{"#", "id", "<", "id", ">"}},
+		{"triple quoted strings", "s = \"\"\"a \"quoted\" b\"\"\"\nt", "python", []string{"id", "=", "str", "id"}},
+		{"escaped quotes", `s = "a \" b"; t`, "javascript", []string{"id", "=", "str", ";", "id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.code, tt.language); !slices.Equal(got, tt.want) {
+				t.Errorf("Tokenize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
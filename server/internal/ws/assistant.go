@@ -0,0 +1,120 @@
+package ws
+
+import (
+    "encoding/json"
+    "errors"
+    "geekCode/internal/assistant"
+    "geekCode/internal/models"
+    "log"
+    "strings"
+    "time"
+)
+
+const (
+    maxQuestionLength = 4000
+    maxHistoryLength  = 20 // same as the rest endpoint, the prompt keeps the latest turns of those
+)
+
+// askAssistant streams the answer back to the client that asked, as assistant_chunk messages followed by
+// assistant_done. it runs in the background so edits keep flowing, one question per client at a time
+func (h *Hub) askAssistant(c *Client, msg Message) {
+    question := strings.TrimSpace(msg.Question)
+    if question == "" || len(question) > maxQuestionLength {
+        h.sendAssistantError(c, msg.RequestID, "the question must be between 1 and 4000 characters")
+        return
+    }
+    if len(msg.History) > maxHistoryLength {
+        h.sendAssistantError(c, msg.RequestID, "the history can have at most 20 messages")
+        return
+    }
+    if !c.asking.CompareAndSwap(false, true) {
+        h.sendAssistantError(c, msg.RequestID, "wait for the current answer to finish")
+        return
+    }
+
+    room, roomContext := h.assistantContext(c.room, msg.FileName)
+    go func() {
+        defer c.asking.Store(false)
+        started := false
+        err := h.assistant.Ask(c.ctx, assistant.Request{
+            UserID: c.uid,
+            Room:   room,
+            Roles:  c.roles,
+            Prompt: assistant.BuildPrompt(roomContext, msg.History, question),
+        }, func(text string) error {
+            started = true
+            chunk, _ := json.Marshal(Message{
+                Action:    "assistant_chunk",
+                Room:      c.room,
+                RequestID: msg.RequestID,
+                Text:      text,
+            })
+            return c.send(chunk)
+        })
+        if err != nil {
+            // the connection going away cancels the answer, nobody is left to tell
+            if c.ctx.Err() != nil {
+                return
+            }
+            // refusals (policy, quota) are worth showing, provider failures are not
+            if !started && assistantRefusal(err) {
+                h.sendAssistantError(c, msg.RequestID, err.Error())
+            } else {
+                h.sendAssistantError(c, msg.RequestID, "the assistant failed to answer")
+            }
+            return
+        }
+        done, _ := json.Marshal(Message{
+            Action:    "assistant_done",
+            Room:      c.room,
+            RequestID: msg.RequestID,
+            Timestamp: time.Now(),
+        })
+        if err := c.send(done); err != nil {
+            log.Printf("Error sending assistant answer to %s: %v", c.user, err)
+        }
+    }()
+}
+
+func assistantRefusal(err error) bool {
+    var quotaErr *assistant.QuotaError
+    return errors.Is(err, assistant.ErrDisabled) || errors.Is(err, assistant.ErrRoomPolicy) ||
+        errors.Is(err, assistant.ErrRole) || errors.As(err, &quotaErr)
+}
+
+// the room's settings and problems from the database, the code as it is in the editor right now
+func (h *Hub) assistantContext(roomId, activeFile string) (*models.Room, assistant.RoomContext) {
+    var room models.Room
+    if err := h.db.Preload("Problems").Select("id", "room_id", "org_id", "language", "settings").Where("room_id = ?", roomId).First(&room).Error; err != nil {
+        log.Printf("Failed to load room %s for the assistant: %v", roomId, err)
+        room.RoomID = roomId
+    }
+
+    h.roomsMutex.Lock()
+    defer h.roomsMutex.Unlock()
+    roomContext := assistant.RoomContext{
+        Language:   room.Language,
+        ActiveFile: activeFile,
+        Problems:   room.Problems,
+    }
+    if state := h.state[roomId]; state != nil {
+        roomContext.Files = append([]models.CodeFile(nil), state.files...)
+        if state.language != "" {
+            roomContext.Language = state.language
+        }
+    }
+    return &room, roomContext
+}
+
+func (h *Hub) sendAssistantError(c *Client, requestID, text string) {
+    msgBytes, _ := json.Marshal(Message{
+        Action:    "error",
+        Room:      c.room,
+        RequestID: requestID,
+        Error:     text,
+        Timestamp: time.Now(),
+    })
+    if err := c.send(msgBytes); err != nil {
+        log.Printf("Error sending error message to %s: %v", c.user, err)
+    }
+}
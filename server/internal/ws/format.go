@@ -0,0 +1,95 @@
+package ws
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "geekCode/internal/formatter"
+    "geekCode/internal/models"
+    "log"
+    "time"
+)
+
+var (
+    ErrNoFile      = errors.New("the file does not exist in this room")
+    ErrFileChanged = errors.New("the file changed while it was being formatted, try again")
+)
+
+// FormatFile formats a file of the shared document and applies the result as one edit that goes to
+// everybody in the room. an empty name means the only file. the formatter runs without holding the
+// lock, when somebody typed in the meantime nothing is applied and ErrFileChanged comes back
+func (h *Hub) FormatFile(ctx context.Context, roomId, user, fileName string) (models.CodeFile, error) {
+    file, found := findFile(h.seedDocument(roomId), fileName)
+    if !found {
+        return models.CodeFile{}, ErrNoFile
+    }
+    language := file.Language
+    if language == "" {
+        h.roomsMutex.Lock()
+        language = h.stateFor(roomId).language
+        h.roomsMutex.Unlock()
+    }
+
+    formatted, err := h.formatter.Format(ctx, language, file.Content)
+    if err != nil || formatted == file.Content {
+        return file, err
+    }
+
+    h.roomsMutex.Lock()
+    state := h.stateFor(roomId)
+    if current, _ := findFile(state.files, file.Name); current.Content != file.Content {
+        h.roomsMutex.Unlock()
+        return file, ErrFileChanged
+    }
+    state.updateFile(file.Name, file.Language, formatted)
+    state.lastActivity = time.Now()
+    h.documentChanged(roomId, state)
+    h.roomsMutex.Unlock()
+
+    file.Content = formatted
+    change, _ := json.Marshal(map[string]interface{}{
+        "code":      file.Content,
+        "language":  file.Language,
+        "fileName":  file.Name,
+        "formatted": true, // clients apply it even when they sent the request
+    })
+    msgBytes, _ := json.Marshal(Message{
+        Action:    "edit",
+        Room:      roomId,
+        User:      user,
+        Change:    change,
+        Timestamp: time.Now(),
+    })
+    h.broadcastToRoom(roomId, msgBytes, nil)
+    return file, nil
+}
+
+func (h *Hub) formatCode(c *Client, msg Message) {
+    if _, err := h.FormatFile(c.ctx, c.room, c.user, msg.FileName); err != nil {
+        if !formatRefusal(err) {
+            log.Printf("Formatting %s in room %s failed: %v", msg.FileName, c.room, err)
+            err = errors.New("formatting failed")
+        }
+        h.sendError(c, err.Error())
+    }
+}
+
+// errors worth showing to the user as they are
+func formatRefusal(err error) bool {
+    var syntaxErr *formatter.SyntaxError
+    return errors.Is(err, ErrNoFile) || errors.Is(err, ErrFileChanged) || errors.Is(err, formatter.ErrUnsupported) ||
+        errors.Is(err, formatter.ErrTooLarge) || errors.As(err, &syntaxErr)
+}
+
+// findFile looks a file up by name, an empty name matches a document with a single file
+func findFile(files []models.CodeFile, name string) (models.CodeFile, bool) {
+    if name == "" && len(files) == 1 {
+        return files[0], true
+    }
+    for _, file := range files {
+        if file.Name == name {
+            return file, true
+        }
+    }
+    return models.CodeFile{}, false
+}
@@ -1,14 +1,26 @@
 package ws
 
 import (
-	"encoding/json"
-	"log"
-	"net/http"
-	"sync"
-	"time"
-
-	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
+    "context"
+    "encoding/json"
+    "geekCode/internal/assistant"
+    "geekCode/internal/diagnostics"
+    "geekCode/internal/executor"
+    "geekCode/internal/formatter"
+    "geekCode/internal/languages"
+    "geekCode/internal/models"
+    "geekCode/internal/rbac"
+    "geekCode/internal/services"
+    "log"
+    "net/http"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+    "gorm.io/gorm"
 )
 
 type Client struct {
@@ -17,6 +29,14 @@ type Client struct {
     user     string
     userID   string
     joinedAt time.Time
+    uid      uint        // authenticated user id
+    roles    []rbac.Role // roles on the room, resolved once on connect
+    scopes   []string    // api token scopes, nil for normal logins
+    joined   bool
+    writeMu  sync.Mutex      // gorilla connections allow only one writer at a time
+    ctx      context.Context // cancelled when the connection goes away, stops assistant answers
+    asking   atomic.Bool     // an assistant answer is streaming
+    reported int             // integrity events recorded for this connection
 }
 
 type ClientInfo struct {
@@ -34,70 +54,202 @@ var upgrader = websocket.Upgrader{
     },
 }
 
-var rooms = make(map[string]map[*Client]bool)
-var roomsMutex = &sync.Mutex{}
+// Hub keeps track of the connected clients per room and checks every action against the rbac policy
+type Hub struct {
+    db         *gorm.DB
+    rbac       *rbac.Engine
+    window     services.JoinWindow
+    assistant  *assistant.Service
+    formatter  *formatter.Registry
+    languages  *languages.Registry
+    runs       *executor.Queue // nil unless EXEC_ENABLED, clients run the code themselves then
+    observers  []DocumentObserver
+    rooms      map[string]map[*Client]bool
+    state      map[string]*roomState // kept after everybody left until the room ends or goes idle
+    roomsMutex sync.Mutex
+}
+
+func NewHub(db *gorm.DB, engine *rbac.Engine, window services.JoinWindow, assistantService *assistant.Service, formatters *formatter.Registry, runtimes *languages.Registry, runs *executor.Queue) *Hub {
+    h := &Hub{
+        db:        db,
+        rbac:      engine,
+        window:    window,
+        assistant: assistantService,
+        formatter: formatters,
+        languages: runtimes,
+        runs:      runs,
+        rooms:     make(map[string]map[*Client]bool),
+        state:     make(map[string]*roomState),
+    }
+    go h.sweepIdleRooms()
+    return h
+}
+
+// DocumentObserver hears about the shared document, like the language servers do. it is called with
+// the hub's lock held, so it must not block or call back into the hub
+type DocumentObserver interface {
+    DocumentChanged(roomId string, files []models.CodeFile)
+    RoomClosed(roomId string)
+}
+
+// Observe registers an observer, only at startup before connections are served
+func (h *Hub) Observe(observer DocumentObserver) {
+    h.observers = append(h.observers, observer)
+}
 
 type Message struct {
-    Action      string          `json:"action"`
-    Room        string          `json:"room,omitempty"`
-    User        string          `json:"user,omitempty"`
-    UserID      string          `json:"userId,omitempty"`
-    Change      json.RawMessage `json:"change,omitempty"`
-    Clients     []ClientInfo    `json:"clients,omitempty"`
-    ClientCount int             `json:"clientCount,omitempty"`
-    Timestamp   time.Time       `json:"timestamp,omitempty"`
-    Code        string          `json:"code,omitempty"`
-    Language    string          `json:"language,omitempty"`
-    FileName    string          `json:"fileName,omitempty"`
-    Output      string          `json:"output,omitempty"`
-    Error       string          `json:"error,omitempty"`
+    Action      string                   `json:"action"`
+    Room        string                   `json:"room,omitempty"`
+    User        string                   `json:"user,omitempty"`
+    UserID      string                   `json:"userId,omitempty"`
+    Change      json.RawMessage          `json:"change,omitempty"`
+    Clients     []ClientInfo             `json:"clients,omitempty"`
+    ClientCount int                      `json:"clientCount,omitempty"`
+    Timestamp   time.Time                `json:"timestamp,omitempty"`
+    Code        string                   `json:"code,omitempty"`
+    Language    string                   `json:"language,omitempty"`
+    FileName    string                   `json:"fileName,omitempty"`
+    Output      string                   `json:"output,omitempty"`
+    Error       string                   `json:"error,omitempty"`
+    Reason      string                   `json:"reason,omitempty"`
+    Files       []models.CodeFile        `json:"files,omitempty"`
+    RequestID   string                   `json:"requestId,omitempty"` // set by the client to match assistant answers to questions
+    Question    string                   `json:"question,omitempty"`
+    History     []assistant.Message      `json:"history,omitempty"`
+    Text        string                   `json:"text,omitempty"`
+    Kind        string                   `json:"kind,omitempty"`       // integrity_event: paste, focus_lost or tab_hidden
+    Chars       int                      `json:"chars,omitempty"`      // integrity_event: pasted characters
+    DurationMs  int64                    `json:"durationMs,omitempty"` // integrity_event: how long the focus was away
+    Integrity   *models.IntegrityEvent   `json:"integrity,omitempty"`
+    Result      *executor.Result         `json:"result,omitempty"` // run_result of a run the server did
+    Diagnostics []diagnostics.Diagnostic `json:"diagnostics,omitempty"`
+    Position    int                      `json:"position,omitempty"` // run_queued: place in line, 1 is next
 }
 
-func HandleWebSocket(c *gin.Context) {
+// close code sent when a room is ended, archived or deleted while people are in it
+const CloseRoomClosed = 4000
+
+// permission each action needs, actions that aren't listed (join, leave) need none beyond room.join
+var actionPermissions = map[string]rbac.Permission{
+    "edit":            rbac.RoomEdit,
+    "code_change":     rbac.RoomEdit,
+    "language_change": rbac.RoomEdit,
+    "run_code":        rbac.RoomRun,
+    "run_result":      rbac.RoomRun,
+    "format_code":     rbac.RoomEdit,
+    "get_room_info":   rbac.RoomView,
+    "assistant_ask":   rbac.AssistantUse,
+}
+
+// the auth middleware runs before this, so userId is the authenticated user
+func (h *Hub) HandleWebSocket(c *gin.Context) {
     roomId := c.Param("roomId")
+    userId := c.MustGet("userId").(uint)
     log.Printf("WebSocket connection request for room: %s", roomId)
 
+    var room models.Room
+    if err := h.db.Where("room_id = ?", roomId).First(&room).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Room not found!"})
+        return
+    }
+    // scheduled rooms open a little before their start, even when the scheduler hasn't caught up yet
+    if room.Status == models.Scheduled && room.ScheduledStart != nil {
+        opensAt := h.window.Opens(*room.ScheduledStart)
+        if time.Now().Before(opensAt) {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Room is not open yet", "opensAt": opensAt})
+            return
+        }
+        h.db.Model(&models.Room{}).Where("id = ? AND status = ?", room.ID, models.Scheduled).Update("status", models.Active)
+        room.Status = models.Active
+    }
+    if room.Status != models.Active || (room.AutoEndAt != nil && time.Now().After(*room.AutoEndAt)) {
+        c.JSON(http.StatusGone, gin.H{"error": "Room is no longer active"})
+        return
+    }
+    var user models.User
+    if err := h.db.First(&user, userId).Error; err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+        return
+    }
+
+    roles, err := h.rbac.RoomRoles(userId, &room)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+        return
+    }
+    // having the link is what makes someone a candidate
+    if len(roles) == 0 {
+        roles = []rbac.Role{rbac.RoleCandidate}
+    }
+    scopes := c.GetStringSlice("scopes")
+    if !h.rbac.Allows(roles, rbac.RoomJoin) || !rbac.ScopeAllows(scopes, rbac.RoomJoin) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + string(rbac.RoomJoin)})
+        return
+    }
+
     conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
     if err != nil {
         log.Printf("Error upgrading to websocket: %v", err)
         return
     }
 
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
     client := &Client{
         conn:     conn,
         room:     roomId,
+        user:     user.Username,
+        userID:   strconv.FormatUint(uint64(user.ID), 10),
+        uid:      user.ID,
+        roles:    roles,
+        scopes:   scopes,
         joinedAt: time.Now(),
+        ctx:      ctx,
     }
 
     log.Printf("WebSocket connection established for room: %s", roomId)
-    go client.readMessages()
-    
-    // Keep the connection alive
-    select {}
+    // blocks until the connection goes away
+    h.readMessages(client)
 }
 
-func registerClient(c *Client) {
-    roomsMutex.Lock()
-    defer roomsMutex.Unlock()
+// the client's roles must grant the permission and an api token must also have it in scope
+func (h *Hub) allowed(c *Client, perm rbac.Permission) bool {
+    return h.rbac.Allows(c.roles, perm) && rbac.ScopeAllows(c.scopes, perm)
+}
 
-    if rooms[c.room] == nil {
-        rooms[c.room] = make(map[*Client]bool)
+func (c *Client) send(msg []byte) error {
+    c.writeMu.Lock()
+    defer c.writeMu.Unlock()
+    return c.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+func (h *Hub) registerClient(c *Client) {
+    h.roomsMutex.Lock()
+    if h.rooms[c.room] == nil {
+        h.rooms[c.room] = make(map[*Client]bool)
     }
 
-    rooms[c.room][c] = true
-    log.Printf("Client %s joined room %s, total clients: %d", c.user, c.room, len(rooms[c.room]))
+    h.rooms[c.room][c] = true
+    log.Printf("Client %s joined room %s, total clients: %d", c.user, c.room, len(h.rooms[c.room]))
+    h.roomsMutex.Unlock()
+
+    // participants are remembered so the candidate keeps access to the room over http too
+    participant := models.Client{RoomID: c.room, UserID: c.uid}
+    if err := h.db.Where(participant).Attrs(models.Client{JoinedAt: c.joinedAt}).FirstOrCreate(&participant).Error; err != nil {
+        log.Printf("Failed to record participant %s in room %s: %v", c.user, c.room, err)
+    }
 
     // Broadcasting updated client count and list
-    broadcastRoomUpdate(c.room)
+    h.broadcastRoomUpdate(c.room)
 }
 
-func unregisterClient(c *Client) {
+func (h *Hub) unregisterClient(c *Client) {
     //handling the room mutex
-    roomsMutex.Lock()
-    defer roomsMutex.Unlock()
-
-    clients, found := rooms[c.room]
-    if !found {
+    h.roomsMutex.Lock()
+    clients, found := h.rooms[c.room]
+    if !found || !clients[c] {
+        h.roomsMutex.Unlock()
+        c.conn.Close()
         return
     }
 
@@ -105,20 +257,53 @@ func unregisterClient(c *Client) {
     clientCount := len(clients)
 
     if clientCount == 0 {
-        delete(rooms, c.room)
+        delete(h.rooms, c.room)
     }
+    h.roomsMutex.Unlock()
 
     log.Printf("Client %s left room %s, total clients: %d", c.user, c.room, clientCount)
 
     c.conn.Close()
 
     if clientCount > 0 {
-        broadcastRoomUpdate(c.room)
+        h.broadcastRoomUpdate(c.room)
+    }
+}
+
+// CloseRoom tells everybody in the room why it is going away and disconnects them
+func (h *Hub) CloseRoom(roomId, reason string) {
+    h.roomsMutex.Lock()
+    clients := h.rooms[roomId]
+    delete(h.rooms, roomId)
+    delete(h.state, roomId)
+    for _, observer := range h.observers {
+        observer.RoomClosed(roomId)
+    }
+    h.roomsMutex.Unlock()
+
+    msgBytes, _ := json.Marshal(Message{
+        Action:    "room_closed",
+        Room:      roomId,
+        Reason:    reason,
+        Timestamp: time.Now(),
+    })
+    closeFrame := websocket.FormatCloseMessage(CloseRoomClosed, reason)
+
+    for client := range clients {
+        if err := client.send(msgBytes); err != nil {
+            log.Printf("Error sending close notice to %s: %v", client.user, err)
+        }
+        client.writeMu.Lock()
+        client.conn.WriteControl(websocket.CloseMessage, closeFrame, time.Now().Add(time.Second))
+        client.writeMu.Unlock()
+        // the read loop fails on the closed connection and cleans up after itself
+        client.conn.Close()
     }
+    log.Printf("Closed room %s (%s), disconnected %d clients", roomId, reason, len(clients))
 }
 
-func (c *Client) readMessages() {
-    defer unregisterClient(c)
+func (h *Hub) readMessages(c *Client) {
+    defer h.unregisterClient(c)
 
     for {
         _, msgBytes, err := c.conn.ReadMessage()
@@ -133,40 +318,100 @@ func (c *Client) readMessages() {
             continue
         }
 
-        log.Printf("Received message: %s from user: %s", msg.Action, msg.User)
+        log.Printf("Received message: %s from user: %s", msg.Action, c.user)
+
+        if msg.Action != "join" && msg.Action != "leave" && !c.joined {
+            h.sendError(c, "join the room first")
+            continue
+        }
+        if perm, found := actionPermissions[msg.Action]; found && !h.allowed(c, perm) {
+            h.sendError(c, "missing permission "+string(perm))
+            continue
+        }
+        if err := h.checkMessage(&msg); err != nil {
+            h.sendError(c, err.Error())
+            continue
+        }
+
+        // the sender and room always come from the authenticated connection, never from the payload
+        msg.Room = c.room
+        msg.User = c.user
+        msg.UserID = c.userID
+        msgBytes, _ = json.Marshal(msg)
+        if c.joined {
+            if edit := h.track(c, &msg); edit != nil {
+                h.checkEdit(c, edit)
+            }
+        }
 
         switch msg.Action {
         case "join":
-            c.user = msg.User
-            c.userID = msg.UserID
-            c.room = msg.Room
-            registerClient(c)
-            broadcastSystemMessage(c.room, c.user+" joined the room", c)
+            if c.joined {
+                continue
+            }
+            // the room may have been closed between the upgrade and the join
+            if !h.roomActive(c.room) {
+                h.sendError(c, "Room is no longer active")
+                return
+            }
+            c.joined = true
+            h.registerClient(c)
+            // late joiners (and the first one, from the template) get the current document
+            if files := h.seedDocument(c.room); len(files) > 0 {
+                stateBytes, _ := json.Marshal(Message{
+                    Action:    "document_state",
+                    Room:      c.room,
+                    Files:     files,
+                    Timestamp: time.Now(),
+                })
+                if err := c.send(stateBytes); err != nil {
+                    log.Printf("Error sending document to %s: %v", c.user, err)
+                }
+            }
+            h.broadcastSystemMessage(c.room, c.user+" joined the room", c)
 
         case "edit":
-            log.Printf("Broadcasting edit message in room: %s", msg.Room)
-            broadcastToRoom(msg.Room, msgBytes, c)
+            log.Printf("Broadcasting edit message in room: %s", c.room)
+            h.broadcastToRoom(c.room, msgBytes, c)
 
         case "code_change":
-            log.Printf("Broadcasting code change in room: %s", msg.Room)
-            broadcastToRoom(msg.Room, msgBytes, c)
+            log.Printf("Broadcasting code change in room: %s", c.room)
+            h.broadcastToRoom(c.room, msgBytes, c)
 
         case "language_change":
-            log.Printf("Broadcasting language change in room: %s", msg.Room)
-            broadcastToRoom(msg.Room, msgBytes, c)
+            log.Printf("Broadcasting language change in room: %s", c.room)
+            h.broadcastToRoom(c.room, msgBytes, c)
 
         case "run_code":
-            log.Printf("Code execution requested in room: %s", msg.Room)
-            // For now, just broadcast the run request
-            // In a real implementation, you'd execute the code here
-            broadcastToRoom(msg.Room, msgBytes, c)
+            log.Printf("Code execution requested in room: %s", c.room)
+            // everybody sees that a run started, the result follows as run_result
+            h.broadcastToRoom(c.room, msgBytes, c)
+            if h.runs != nil {
+                h.runCode(c, msg)
+            }
+
+        case "run_result":
+            // output of a run, shared with everybody else in the room
+            h.broadcastToRoom(c.room, msgBytes, c)
+            h.diagnoseRun(c.room, msg.Language, msg.FileName, msg.Error)
+
+        case "format_code":
+            // everybody, the sender included, gets the result as an edit
+            h.formatCode(c, msg)
 
         case "get_room_info":
-            sendRoomInfo(c)
+            h.sendRoomInfo(c)
+
+        case "assistant_ask":
+            // only the asker gets the answer
+            h.askAssistant(c, msg)
+
+        case "integrity_event":
+            // recorded for the interviewers, never broadcast to the room
+            h.reportIntegrity(c, msg)
 
         case "leave":
-            broadcastSystemMessage(c.room, c.user+" left the room", c)
-            unregisterClient(c)
+            h.broadcastSystemMessage(c.room, c.user+" left the room", c)
             return
 
         default:
@@ -175,11 +420,17 @@ func (c *Client) readMessages() {
     }
 }
 
-func broadcastToRoom(roomId string, msg []byte, sender *Client) {
-    roomsMutex.Lock()
-    clients, found := rooms[roomId]
+func (h *Hub) roomActive(roomId string) bool {
+    var count int64
+    h.db.Model(&models.Room{}).Where("room_id = ? AND status = ?", roomId, models.Active).Count(&count)
+    return count > 0
+}
+
+func (h *Hub) broadcastToRoom(roomId string, msg []byte, sender *Client) {
+    h.roomsMutex.Lock()
+    clients, found := h.rooms[roomId]
     if !found {
-        roomsMutex.Unlock()
+        h.roomsMutex.Unlock()
         return
     }
 
@@ -189,35 +440,48 @@ func broadcastToRoom(roomId string, msg []byte, sender *Client) {
             targets = append(targets, client)
         }
     }
-    roomsMutex.Unlock()
+    h.roomsMutex.Unlock()
 
     log.Printf("Broadcasting to %d clients in room %s", len(targets), roomId)
     for _, client := range targets {
-        if err := client.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+        if err := client.send(msg); err != nil {
             log.Printf("Broadcast write error to %s: %v", client.user, err)
         }
     }
 }
 
-func broadcastSystemMessage(roomId, text string, exclude *Client) {
+func (h *Hub) broadcastSystemMessage(roomId, text string, exclude *Client) {
+    change, _ := json.Marshal(map[string]string{"text": text})
     sysMsg := Message{
         Action:    "system",
         Room:      roomId,
-        Change:    json.RawMessage(`{"text":"` + text + `"}`),
+        Change:    change,
         Timestamp: time.Now(),
     }
     msgBytes, _ := json.Marshal(sysMsg)
 
-    broadcastToRoom(roomId, msgBytes, exclude)
+    h.broadcastToRoom(roomId, msgBytes, exclude)
 }
 
-func getRoomInfo(roomId string) ([]ClientInfo, int) {
-    roomsMutex.Lock()
-    defer roomsMutex.Unlock()
+func (h *Hub) sendError(client *Client, text string) {
+    msgBytes, _ := json.Marshal(Message{
+        Action:    "error",
+        Room:      client.room,
+        Error:     text,
+        Timestamp: time.Now(),
+    })
+    if err := client.send(msgBytes); err != nil {
+        log.Printf("Error sending error message to %s: %v", client.user, err)
+    }
+}
+
+func (h *Hub) getRoomInfo(roomId string) ([]ClientInfo, int) {
+    h.roomsMutex.Lock()
+    defer h.roomsMutex.Unlock()
 
-    clients, found := rooms[roomId]
+    clients, found := h.rooms[roomId]
     if !found {
-			log.Printf("No clients found in room: %s", roomId)
+        log.Printf("No clients found in room: %s", roomId)
         return []ClientInfo{}, 0
     }
 
@@ -233,8 +497,8 @@ func getRoomInfo(roomId string) ([]ClientInfo, int) {
     return clientList, len(clientList)
 }
 
-func broadcastRoomUpdate(roomId string) {
-    clientList, clientCount := getRoomInfo(roomId)
+func (h *Hub) broadcastRoomUpdate(roomId string) {
+    clientList, clientCount := h.getRoomInfo(roomId)
 
     updateMsg := Message{
         Action:      "room_update",
@@ -245,11 +509,11 @@ func broadcastRoomUpdate(roomId string) {
     }
 
     msgBytes, _ := json.Marshal(updateMsg)
-    broadcastToRoom(roomId, msgBytes, nil)
+    h.broadcastToRoom(roomId, msgBytes, nil)
 }
 
-func sendRoomInfo(client *Client) {
-    clientList, clientCount := getRoomInfo(client.room)
+func (h *Hub) sendRoomInfo(client *Client) {
+    clientList, clientCount := h.getRoomInfo(client.room)
 
     msg := Message{
         Action:      "room_info",
@@ -260,7 +524,7 @@ func sendRoomInfo(client *Client) {
     }
 
     msgBytes, _ := json.Marshal(msg)
-    if err := client.conn.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
+    if err := client.send(msgBytes); err != nil {
         log.Printf("Error sending room info to %s: %v", client.user, err)
     }
-}
\ No newline at end of file
+}
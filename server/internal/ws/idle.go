@@ -0,0 +1,89 @@
+package ws
+
+import (
+    "geekCode/internal/models"
+    "log"
+    "time"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// the document of a room nobody is in is saved and let go after this long, it is loaded again when
+// somebody comes back
+const idleStateTTL = 30 * time.Minute
+
+const idleSweepInterval = time.Minute
+
+func (h *Hub) sweepIdleRooms() {
+    ticker := time.NewTicker(idleSweepInterval)
+    defer ticker.Stop()
+    for now := range ticker.C {
+        h.evictIdle(now)
+    }
+}
+
+// evictIdle saves and drops the state of the rooms that have been empty and quiet for idleStateTTL
+func (h *Hub) evictIdle(now time.Time) {
+    type idleRoom struct {
+        state        *roomState
+        lastActivity time.Time
+        submission   *models.Submission
+    }
+    idle := map[string]idleRoom{}
+    h.roomsMutex.Lock()
+    for roomId, state := range h.state {
+        if len(h.rooms[roomId]) > 0 || now.Sub(state.lastActivity) < idleStateTTL {
+            continue
+        }
+        idle[roomId] = idleRoom{state: state, lastActivity: state.lastActivity, submission: state.submission(roomId)}
+    }
+    h.roomsMutex.Unlock()
+
+    for roomId, room := range idle {
+        if len(room.submission.Files) == 0 && len(room.submission.Runs) == 0 {
+            continue
+        }
+        if err := saveSubmission(h.db, room.submission); err != nil {
+            // kept for the next sweep rather than losing the code
+            log.Printf("Failed to save the document of idle room %s: %v", roomId, err)
+            delete(idle, roomId)
+        }
+    }
+
+    h.roomsMutex.Lock()
+    defer h.roomsMutex.Unlock()
+    evicted := 0
+    for roomId, room := range idle {
+        // somebody may have come back while it was being saved
+        if h.state[roomId] != room.state || room.state.lastActivity != room.lastActivity || len(h.rooms[roomId]) > 0 {
+            continue
+        }
+        delete(h.state, roomId)
+        evicted++
+    }
+    if evicted > 0 {
+        log.Printf("Let go of %d idle rooms, %d rooms left in memory", evicted, len(h.state))
+    }
+}
+
+// saveSubmission stores the room's document, replacing what was saved for it before
+func saveSubmission(db *gorm.DB, submission *models.Submission) error {
+    return db.Clauses(clause.OnConflict{
+        Columns:   []clause.Column{{Name: "room_id"}},
+        DoUpdates: clause.AssignmentColumns([]string{"language", "files", "runs", "timeline", "updated_at"}),
+    }).Create(submission).Error
+}
+
+// savedSubmission is what saveSubmission stored for the room, nil when there is nothing
+func (h *Hub) savedSubmission(roomId string) *models.Submission {
+    var saved models.Submission
+    if err := h.db.Where("room_id = ?", roomId).Limit(1).Find(&saved).Error; err != nil {
+        log.Printf("Failed to load the saved document of room %s: %v", roomId, err)
+        return nil
+    }
+    if saved.ID == 0 {
+        return nil
+    }
+    return &saved
+}
@@ -0,0 +1,79 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"geekCode/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testHub(t *testing.T) *Hub {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Room{}, &models.Submission{}); err != nil {
+		t.Fatal(err)
+	}
+	return &Hub{db: db, rooms: make(map[string]map[*Client]bool), state: make(map[string]*roomState)}
+}
+
+func TestEvictIdleRooms(t *testing.T) {
+	h := testHub(t)
+	now := time.Now()
+	files := []models.CodeFile{{Name: "main.py", Language: "python", Content: "print(42)"}}
+	h.state["idle"] = &roomState{lastActivity: now.Add(-2 * idleStateTTL), language: "python", files: files, seeded: true,
+		runs: []models.RunRecord{{User: "ada", Output: "42"}}}
+	h.state["recent"] = &roomState{lastActivity: now.Add(-time.Minute), files: files, seeded: true}
+	h.state["occupied"] = &roomState{lastActivity: now.Add(-2 * idleStateTTL), files: files, seeded: true}
+	h.rooms["occupied"] = map[*Client]bool{{}: true}
+
+	h.evictIdle(now)
+	if h.state["idle"] != nil {
+		t.Error("idle room kept its state")
+	}
+	if h.state["recent"] == nil || h.state["occupied"] == nil {
+		t.Error("a recent or occupied room lost its state")
+	}
+
+	// the room's code and language are still known without the state
+	live := h.Snapshots("idle")["idle"]
+	if live.LastActivity == nil || live.Language != "python" {
+		t.Errorf("snapshot after eviction is %+v", live)
+	}
+	submission := h.Submission("idle")
+	if submission == nil || len(submission.Files) != 1 || len(submission.Runs) != 1 {
+		t.Fatalf("submission after eviction is %+v", submission)
+	}
+
+	// whoever comes back gets the code the room had, not the starter files
+	h.db.Create(&models.Room{RoomID: "idle", Name: "idle", CreatedBy: 1, Files: []models.CodeFile{{Name: "main.py", Content: "# starter"}}})
+	document := h.seedDocument("idle")
+	if len(document) != 1 || document[0].Content != "print(42)" {
+		t.Fatalf("document after coming back is %+v", document)
+	}
+	if runs := h.state["idle"].runs; len(runs) != 1 {
+		t.Errorf("%d runs after coming back, want 1", len(runs))
+	}
+}
+
+func TestEvictIdleRoomWithoutCode(t *testing.T) {
+	h := testHub(t)
+	now := time.Now()
+	h.state["empty"] = &roomState{lastActivity: now.Add(-2 * idleStateTTL), language: "go"}
+
+	h.evictIdle(now)
+	if h.state["empty"] != nil {
+		t.Error("idle room kept its state")
+	}
+	if submission := h.Submission("empty"); submission != nil {
+		t.Errorf("saved %+v for a room without code", submission)
+	}
+}
@@ -0,0 +1,90 @@
+package ws
+
+import (
+    "encoding/json"
+    "geekCode/internal/models"
+    "geekCode/internal/rbac"
+    "log"
+    "time"
+)
+
+// a client can't fill the table, events past this are dropped for the rest of the connection
+const maxIntegrityEvents = 500
+
+// what the browser may report, large edits are only ever detected by the hub
+var clientIntegrityKinds = map[string]models.IntegrityKind{
+    string(models.IntegrityPaste):     models.IntegrityPaste,
+    string(models.IntegrityFocusLost): models.IntegrityFocusLost,
+    string(models.IntegrityTabHidden): models.IntegrityTabHidden,
+}
+
+// reportIntegrity records an event the candidate's browser noticed
+func (h *Hub) reportIntegrity(c *Client, msg Message) {
+    kind, ok := clientIntegrityKinds[msg.Kind]
+    if !ok {
+        h.sendError(c, "unknown integrity event "+msg.Kind)
+        return
+    }
+    if msg.Chars < 0 || msg.DurationMs < 0 {
+        h.sendError(c, "invalid integrity event")
+        return
+    }
+    h.recordIntegrity(c, models.IntegrityEvent{
+        Kind:       kind,
+        Source:     "client",
+        FileName:   msg.FileName,
+        Chars:      msg.Chars,
+        DurationMs: msg.DurationMs,
+    })
+}
+
+// checkEdit flags a single edit that inserted a lot at once, whether or not the browser reported a paste
+func (h *Hub) checkEdit(c *Client, edit *models.EditSnapshot) {
+    if edit.Delta < notableEditChars {
+        return
+    }
+    h.recordIntegrity(c, models.IntegrityEvent{
+        Kind:     models.IntegrityLargeEdit,
+        Source:   "server",
+        FileName: edit.FileName,
+        Chars:    edit.Delta,
+    })
+}
+
+// recordIntegrity stores the event and pushes it to the interviewers in the room. people who can see
+// the timeline aren't proctored themselves, so their events are ignored
+func (h *Hub) recordIntegrity(c *Client, event models.IntegrityEvent) {
+    if h.allowed(c, rbac.IntegrityView) || c.reported >= maxIntegrityEvents {
+        return
+    }
+    c.reported++
+
+    event.RoomID = c.room
+    event.UserID = c.uid
+    event.User = c.user
+    if err := h.db.Create(&event).Error; err != nil {
+        log.Printf("Failed to record integrity event for %s in room %s: %v", c.user, c.room, err)
+        return
+    }
+
+    msgBytes, _ := json.Marshal(Message{
+        Action:    "integrity_alert",
+        Room:      c.room,
+        Integrity: &event,
+        Timestamp: time.Now(),
+    })
+    h.roomsMutex.Lock()
+    targets := make([]*Client, 0)
+    for client := range h.rooms[c.room] {
+        if h.allowed(client, rbac.IntegrityView) {
+            targets = append(targets, client)
+        }
+    }
+    h.roomsMutex.Unlock()
+
+    for _, client := range targets {
+        if err := client.send(msgBytes); err != nil {
+            log.Printf("Error sending integrity alert to %s: %v", client.user, err)
+        }
+    }
+}
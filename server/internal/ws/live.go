@@ -0,0 +1,331 @@
+package ws
+
+import (
+    "encoding/json"
+    "geekCode/internal/models"
+    "log"
+    "strings"
+    "time"
+)
+
+// a run without a result is considered finished after this long
+const runTimeout = 2 * time.Minute
+
+const (
+    notableEditChars = 200 // a single change of at least this many characters ends up in the timeline
+    maxTimeline      = 50
+    maxRuns          = 20
+    maxRunOutput     = 4096
+)
+
+// what the hub knows about a room besides who is connected
+type roomState struct {
+    lastActivity time.Time
+    language     string
+    running      *models.LiveExecution
+    files        []models.CodeFile // the shared document, seeded from the room's starter files
+    seeded       bool
+    runs         []models.RunRecord    // latest results, oldest first
+    timeline     []models.EditSnapshot // notable edits, oldest first
+}
+
+// stateFor returns the state of the room, creating it when needed. callers hold roomsMutex
+func (h *Hub) stateFor(roomId string) *roomState {
+    state := h.state[roomId]
+    if state == nil {
+        state = &roomState{}
+        h.state[roomId] = state
+    }
+    return state
+}
+
+// track updates the room state from a message a client sent, called for every accepted action.
+// it returns the edit when the message was a notable one
+func (h *Hub) track(c *Client, msg *Message) *models.EditSnapshot {
+    h.roomsMutex.Lock()
+    defer h.roomsMutex.Unlock()
+
+    state := h.stateFor(c.room)
+    state.lastActivity = time.Now()
+
+    switch msg.Action {
+    case "language_change":
+        if msg.Language != "" {
+            state.language = msg.Language
+        }
+    case "code_change":
+        if msg.Language != "" {
+            state.language = msg.Language
+        }
+        edit := state.recordEdit(c.user, msg.FileName, msg.Language, msg.Code)
+        h.documentChanged(c.room, state)
+        return edit
+    case "edit":
+        // the editor sends the whole file and its language with every change
+        var change struct {
+            Code     *string `json:"code"`
+            Language string  `json:"language"`
+            FileName string  `json:"fileName"`
+        }
+        if json.Unmarshal(msg.Change, &change) != nil {
+            break
+        }
+        if change.Language != "" {
+            state.language = change.Language
+        }
+        if change.Code != nil {
+            edit := state.recordEdit(c.user, change.FileName, change.Language, *change.Code)
+            h.documentChanged(c.room, state)
+            return edit
+        }
+    case "run_code":
+        state.running = &models.LiveExecution{
+            User:      c.user,
+            Language:  msg.Language,
+            FileName:  msg.FileName,
+            StartedAt: time.Now(),
+        }
+        if msg.Language != "" {
+            state.language = msg.Language
+        }
+    case "run_result":
+        state.finishRun(c.user, msg)
+    }
+    return nil
+}
+
+// finishRun clears the running run and keeps its result
+func (s *roomState) finishRun(user string, msg *Message) {
+    s.running = nil
+    s.runs = append(s.runs, models.RunRecord{
+        User:     user,
+        Language: msg.Language,
+        FileName: msg.FileName,
+        Output:   truncate(msg.Output, maxRunOutput),
+        Error:    truncate(msg.Error, maxRunOutput),
+        At:       time.Now(),
+    })
+    if len(s.runs) > maxRuns {
+        s.runs = s.runs[len(s.runs)-maxRuns:]
+    }
+}
+
+// recordEdit applies the change and notes it in the timeline when it's a big one
+func (s *roomState) recordEdit(user, fileName, language, content string) *models.EditSnapshot {
+    name, before, known := s.updateFile(fileName, language, content)
+    if !known {
+        // with no earlier version to compare to (a new file, or one the starter files didn't have when
+        // the hub restarted) the content only sets the baseline
+        return nil
+    }
+    inserted, removed := changedSpan(before, content)
+    delta := inserted
+    if inserted < notableEditChars {
+        if removed < notableEditChars {
+            return nil
+        }
+        delta = -removed
+    }
+    edit := models.EditSnapshot{
+        User:     user,
+        FileName: name,
+        Delta:    delta,
+        Size:     len(content),
+        At:       time.Now(),
+    }
+    s.timeline = append(s.timeline, edit)
+    if len(s.timeline) > maxTimeline {
+        s.timeline = s.timeline[len(s.timeline)-maxTimeline:]
+    }
+    return &edit
+}
+
+// changedSpan trims what the two versions have in common at both ends and returns the size of the
+// part that was inserted and the part it replaced, so replacing a block with a paste of the same size
+// still counts as a large insert
+func changedSpan(before, after string) (inserted, removed int) {
+    prefix := 0
+    for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+        prefix++
+    }
+    suffix := 0
+    for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+        before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+        suffix++
+    }
+    return len(after) - prefix - suffix, len(before) - prefix - suffix
+}
+
+func truncate(text string, max int) string {
+    if len(text) <= max {
+        return text
+    }
+    return strings.ToValidUTF8(text[:max], "") + "\n... (truncated)"
+}
+
+// Snapshots returns the live state of the given rooms. rooms nobody used since startup come back empty,
+// rooms whose document was let go of only have the time and language it was saved with
+func (h *Hub) Snapshots(roomIds ...string) map[string]models.LiveRoom {
+    h.roomsMutex.Lock()
+    snapshots := make(map[string]models.LiveRoom, len(roomIds))
+    var saved []string
+    for _, roomId := range roomIds {
+        live := models.LiveRoom{Participants: []models.LiveParticipant{}}
+        for client := range h.rooms[roomId] {
+            live.Participants = append(live.Participants, models.LiveParticipant{
+                User:     client.user,
+                UserID:   client.userID,
+                JoinedAt: client.joinedAt,
+            })
+        }
+        live.ParticipantCount = len(live.Participants)
+
+        if state := h.state[roomId]; state != nil {
+            lastActivity := state.lastActivity
+            live.LastActivity = &lastActivity
+            live.Language = state.language
+            if state.running != nil && time.Since(state.running.StartedAt) < runTimeout {
+                running := *state.running
+                live.Running = &running
+            }
+        } else {
+            saved = append(saved, roomId)
+        }
+        snapshots[roomId] = live
+    }
+    h.roomsMutex.Unlock()
+
+    if len(saved) == 0 {
+        return snapshots
+    }
+    var submissions []models.Submission
+    if err := h.db.Select("room_id", "language", "updated_at").Where("room_id IN ?", saved).Find(&submissions).Error; err != nil {
+        log.Printf("Failed to load saved documents for snapshots: %v", err)
+        return snapshots
+    }
+    for _, submission := range submissions {
+        live := snapshots[submission.RoomID]
+        updatedAt := submission.UpdatedAt
+        live.LastActivity = &updatedAt
+        live.Language = submission.Language
+        snapshots[submission.RoomID] = live
+    }
+    return snapshots
+}
+
+// documentChanged tells the observers about the room's files. callers hold roomsMutex
+func (h *Hub) documentChanged(roomId string, state *roomState) {
+    if len(h.observers) == 0 {
+        return
+    }
+    files := append([]models.CodeFile(nil), state.files...)
+    for _, observer := range h.observers {
+        observer.DocumentChanged(roomId, files)
+    }
+}
+
+// updateFile replaces the file's content, returning the file name used, the previous content and
+// whether the file was there before
+func (s *roomState) updateFile(name, language, content string) (string, string, bool) {
+    if name == "" {
+        // older clients don't send the file name, with a single file it's clear which one they mean
+        if len(s.files) == 1 {
+            name = s.files[0].Name
+        } else {
+            name = "main"
+        }
+    }
+    for i := range s.files {
+        if s.files[i].Name == name {
+            before := s.files[i].Content
+            s.files[i].Content = content
+            if language != "" {
+                s.files[i].Language = language
+            }
+            return name, before, true
+        }
+    }
+    s.files = append(s.files, models.CodeFile{Name: name, Language: language, Content: content})
+    return name, "", false
+}
+
+// seedDocument fills the shared document the first time somebody joins, from what was saved when the
+// room went idle or ended, or else from the room's starter files
+func (h *Hub) seedDocument(roomId string) []models.CodeFile {
+    h.roomsMutex.Lock()
+    seeded := h.stateFor(roomId).seeded
+    h.roomsMutex.Unlock()
+
+    var room models.Room
+    var saved *models.Submission
+    if !seeded {
+        if saved = h.savedSubmission(roomId); saved == nil {
+            if err := h.db.Select("files", "language").Where("room_id = ?", roomId).First(&room).Error; err != nil {
+                log.Printf("Failed to load starter files for room %s: %v", roomId, err)
+            }
+        }
+    }
+
+    h.roomsMutex.Lock()
+    defer h.roomsMutex.Unlock()
+    state := h.stateFor(roomId)
+    if !state.seeded {
+        if saved != nil {
+            state.files = saved.Files
+            state.runs = saved.Runs
+            state.timeline = saved.Timeline
+            if state.language == "" {
+                state.language = saved.Language
+            }
+        } else {
+            state.files = append([]models.CodeFile(nil), room.Files...)
+            if state.language == "" {
+                state.language = room.Language
+            }
+        }
+        state.seeded = true
+        h.documentChanged(roomId, state)
+    }
+    return append([]models.CodeFile(nil), state.files...)
+}
+
+// Files returns the current content of the shared document
+func (h *Hub) Files(roomId string) []models.CodeFile {
+    h.roomsMutex.Lock()
+    defer h.roomsMutex.Unlock()
+
+    state := h.state[roomId]
+    if state == nil {
+        return nil
+    }
+    return append([]models.CodeFile(nil), state.files...)
+}
+
+// Submission captures the document, runs and notable edits of the room. when the hub let go of the
+// room it is what was saved then, nil when nothing ever was
+func (h *Hub) Submission(roomId string) *models.Submission {
+    h.roomsMutex.Lock()
+    state := h.state[roomId]
+    if state != nil {
+        defer h.roomsMutex.Unlock()
+        return state.submission(roomId)
+    }
+    h.roomsMutex.Unlock()
+
+    saved := h.savedSubmission(roomId)
+    if saved == nil {
+        return nil
+    }
+    return &models.Submission{RoomID: roomId, Language: saved.Language, Files: saved.Files, Runs: saved.Runs, Timeline: saved.Timeline}
+}
+
+// submission copies the state into a submission of the room, callers hold roomsMutex
+func (s *roomState) submission(roomId string) *models.Submission {
+    return &models.Submission{
+        RoomID:   roomId,
+        Language: s.language,
+        Files:    append([]models.CodeFile(nil), s.files...),
+        Runs:     append([]models.RunRecord(nil), s.runs...),
+        Timeline: append([]models.EditSnapshot(nil), s.timeline...),
+    }
+}
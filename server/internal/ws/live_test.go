@@ -0,0 +1,53 @@
+package ws
+
+import (
+	"strings"
+	"testing"
+
+	"geekCode/internal/models"
+)
+
+func TestRecordEdit(t *testing.T) {
+	block := strings.Repeat("a", 500)
+	paste := strings.Repeat("b", 500)
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   int // delta of the noted edit, 0 when it isn't notable
+	}{
+		{"small change", "func main() {}", "func main() { return }", 0},
+		{"large insert", "x := 1\n", "x := 1\n" + paste, 500},
+		{"large removal", "x := 1\n" + block, "x := 1\n", -500},
+		{"block replaced by a paste of the same size", "head\n" + block + "\ntail", "head\n" + paste + "\ntail", 500},
+		{"typing in a large file", block + block, block + "z" + block, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &roomState{files: []models.CodeFile{{Name: "main.go", Content: tt.before}}}
+			edit := s.recordEdit("ada", "main.go", "go", tt.after)
+			switch {
+			case tt.want == 0 && edit != nil:
+				t.Fatalf("noted an edit of %d", edit.Delta)
+			case tt.want != 0 && edit == nil:
+				t.Fatalf("edit wasn't noted, want %d", tt.want)
+			case edit != nil && edit.Delta != tt.want:
+				t.Fatalf("delta %d, want %d", edit.Delta, tt.want)
+			}
+			if s.files[0].Content != tt.after {
+				t.Fatal("file wasn't updated")
+			}
+		})
+	}
+}
+
+func TestRecordEditWithoutBaseline(t *testing.T) {
+	// after a restart the hub may only learn about a file from its first edit
+	s := &roomState{}
+	if edit := s.recordEdit("ada", "main.go", "go", strings.Repeat("a", 1000)); edit != nil {
+		t.Fatalf("first sight of a file was noted as an edit of %d", edit.Delta)
+	}
+	if edit := s.recordEdit("ada", "main.go", "go", strings.Repeat("a", 1000)+strings.Repeat("b", 300)); edit == nil || edit.Delta != 300 {
+		t.Fatalf("got %+v, want an edit of 300", edit)
+	}
+}
@@ -0,0 +1,188 @@
+package ws
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "geekCode/internal/diagnostics"
+    "geekCode/internal/executor"
+    "geekCode/internal/models"
+    "log"
+    "time"
+)
+
+var errUnsupportedLanguage = errors.New("unsupported language")
+
+// checkMessage rejects messages the registry or the executor disagree with, before they are tracked
+// or broadcast. language changes are rewritten to the runtime's name, so aliases don't spread
+func (h *Hub) checkMessage(msg *Message) error {
+    switch msg.Action {
+    case "language_change":
+        if msg.Language == "" {
+            return nil
+        }
+        runtime, found := h.languages.Get(msg.Language)
+        if !found {
+            return errors.New("unsupported language " + msg.Language)
+        }
+        msg.Language = runtime.Name
+    case "run_result":
+        if h.runs != nil {
+            return errors.New("runs are executed by the server")
+        }
+    }
+    return nil
+}
+
+// runCode queues a run of the shared document on the server. the room hears where it is in line
+// and when it starts, the result goes to everybody, the one who started it included
+func (h *Hub) runCode(c *Client, msg Message) {
+    reply := Message{
+        Action:   "run_result",
+        Room:     c.room,
+        User:     c.user,
+        UserID:   c.userID,
+        Language: msg.Language,
+        FileName: msg.FileName,
+    }
+    req, err := h.runRequest(c, msg)
+    if err == nil {
+        err = h.runs.Submit(&executor.Job{
+            Room:    c.room,
+            User:    c.userID,
+            Context: c.ctx,
+            Request: req,
+            Queued: func(position int) {
+                h.publishRunState(c, req.Main, "run_queued", position)
+            },
+            Started: func() {
+                h.publishRunState(c, req.Main, "run_started", 0)
+            },
+            Done: func(result *executor.Result, err error) {
+                if err != nil {
+                    h.publishRun(c.room, c.user, h.runFailed(c, &reply, err))
+                    return
+                }
+                reply.Language = result.Language
+                reply.FileName = result.FileName
+                reply.Output = result.Stdout
+                reply.Error = result.Stderr
+                reply.Result = result
+                h.publishRun(c.room, c.user, &reply)
+            },
+        })
+    }
+    if err != nil {
+        h.publishRun(c.room, c.user, h.runFailed(c, &reply, err))
+    }
+}
+
+// runFailed fills in the reply for a run that didn't get to run, errors the user can't do anything
+// about are logged and replaced
+func (h *Hub) runFailed(c *Client, reply *Message, err error) *Message {
+    switch {
+    case errors.Is(err, errUnsupportedLanguage), errors.Is(err, executor.ErrNoSource),
+        errors.Is(err, executor.ErrQueueFull), errors.Is(err, executor.ErrUserBusy):
+    case errors.Is(err, context.Canceled):
+        err = errors.New("the run was cancelled")
+    default:
+        log.Printf("Run in room %s failed: %v", c.room, err)
+        err = errors.New("the run could not be started")
+    }
+    reply.Error = err.Error()
+    return reply
+}
+
+// runRequest collects the room's files. the runner's copy of the file wins over the hub's, they only
+// differ while edits are still on their way
+func (h *Hub) runRequest(c *Client, msg Message) (executor.Request, error) {
+    runtime, found := h.languages.Get(msg.Language)
+    if !found {
+        runtime, found = h.languages.ForFile(msg.FileName)
+    }
+    if !found {
+        return executor.Request{}, fmt.Errorf("%w %s", errUnsupportedLanguage, msg.Language)
+    }
+
+    files := h.Files(c.room)
+    main := msg.FileName
+    if msg.Code != "" {
+        if main == "" {
+            main = runtime.FileName
+        }
+        replaced := false
+        for i := range files {
+            if files[i].Name == main {
+                files[i].Content = msg.Code
+                replaced = true
+            }
+        }
+        if !replaced {
+            files = append(files, models.CodeFile{Name: main, Language: runtime.Name, Content: msg.Code})
+        }
+    }
+    return executor.Request{Runtime: runtime, Files: files, Main: main}, nil
+}
+
+// publishRunState tells the room a queued run moved up in line or started
+func (h *Hub) publishRunState(c *Client, fileName, action string, position int) {
+    msgBytes, _ := json.Marshal(Message{
+        Action:    action,
+        Room:      c.room,
+        User:      c.user,
+        UserID:    c.userID,
+        FileName:  fileName,
+        Position:  position,
+        Timestamp: time.Now(),
+    })
+    h.broadcastToRoom(c.room, msgBytes, nil)
+}
+
+// publishRun records the result in the room state and sends it to everybody
+func (h *Hub) publishRun(roomId, user string, reply *Message) {
+    reply.Timestamp = time.Now()
+    h.roomsMutex.Lock()
+    h.stateFor(roomId).finishRun(user, reply)
+    h.roomsMutex.Unlock()
+
+    msgBytes, _ := json.Marshal(reply)
+    h.broadcastToRoom(roomId, msgBytes, nil)
+    if reply.Result != nil {
+        h.publishDiagnostics(roomId, reply.Language, reply.FileName, reply.Result.Diagnostics)
+    }
+}
+
+// diagnoseRun parses the errors of a run a client did itself, with the parser of its language
+func (h *Hub) diagnoseRun(roomId, language, fileName, stderr string) {
+    runtime, found := h.languages.Get(language)
+    if !found {
+        runtime, found = h.languages.ForFile(fileName)
+    }
+    if !found {
+        return
+    }
+    files := h.Files(roomId)
+    names := make([]string, 0, len(files)+1)
+    if fileName != "" {
+        names = append(names, fileName)
+    }
+    for _, file := range files {
+        names = append(names, file.Name)
+    }
+    h.publishDiagnostics(roomId, runtime.Name, fileName, diagnostics.Parse(runtime.Diagnostics, stderr, names))
+}
+
+// publishDiagnostics sends the problems a run found to everybody. it is sent after every run,
+// without diagnostics when there were none, so editors drop the markers of the previous one
+func (h *Hub) publishDiagnostics(roomId, language, fileName string, found []diagnostics.Diagnostic) {
+    msgBytes, _ := json.Marshal(Message{
+        Action:      "diagnostics",
+        Room:        roomId,
+        Language:    language,
+        FileName:    fileName,
+        Diagnostics: found,
+        Timestamp:   time.Now(),
+    })
+    h.broadcastToRoom(roomId, msgBytes, nil)
+}